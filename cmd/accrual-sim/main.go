@@ -0,0 +1,83 @@
+// Command accrual-sim runs a local accrual service for development and
+// end-to-end tests of the order processor. See internal/accrualsim for the
+// HTTP contract and the /sim scripting API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/rs/zerolog"
+	"gophemart/internal/accrualsim"
+	"gophemart/pkg/logger"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	logger.Init(zerolog.InfoLevel)
+
+	var (
+		address  = flag.String("a", envOr("RUN_ADDRESS", ":9099"), "address to listen on")
+		rulesRaw = flag.String("rules", os.Getenv("ACCRUAL_SIM_RULES"), `reward rules as JSON, e.g. [{"match":"Bork","reward":10,"reward_type":"%"}]`)
+		cfg      accrualsim.Config
+	)
+	flag.DurationVar(&cfg.ProcessingAfter, "processing-after", time.Second, "how long an order stays REGISTERED")
+	flag.DurationVar(&cfg.ProcessedAfter, "processed-after", 3*time.Second, "how long after registration an order is PROCESSED")
+	flag.IntVar(&cfg.RequestsPerMinute, "rpm", 0, "order polls allowed per minute before answering 429 (0 — unlimited)")
+	flag.Float64Var(&cfg.AutoAccrual, "auto-accrual", 0, "register unknown orders on first poll with this reward (0 — answer 204)")
+	flag.Parse()
+
+	sim := accrualsim.New(cfg)
+	if *rulesRaw != "" {
+		var rules []accrualsim.Rule
+		if err := json.Unmarshal([]byte(*rulesRaw), &rules); err != nil {
+			logger.Error().Err(err).Msg("Failed to parse reward rules")
+			os.Exit(1)
+		}
+		for _, rule := range rules {
+			if err := sim.AddRule(rule); err != nil {
+				logger.Error().Err(err).Str("match", rule.Match).Msg("Failed to add reward rule")
+				os.Exit(1)
+			}
+		}
+	}
+
+	server := &http.Server{
+		Addr:              *address,
+		Handler:           sim.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Info().
+			Str("address", *address).
+			Int("rpm", cfg.RequestsPerMinute).
+			Float64("auto_accrual", cfg.AutoAccrual).
+			Msg("Accrual simulator started")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("Accrual simulator failed")
+			os.Exit(1)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to shut down accrual simulator")
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
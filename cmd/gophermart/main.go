@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
-	"github.com/rs/zerolog"
 	"gophemart/internal/app/service"
 	"gophemart/internal/config"
 	"gophemart/internal/handler/http"
+	"gophemart/internal/metrics"
 	"gophemart/internal/repository/postgresql"
+	"gophemart/internal/tracing"
 	"gophemart/internal/transport/accrual"
+	"gophemart/internal/transport/events"
 	"gophemart/internal/worker"
 	"gophemart/pkg/database"
 	"gophemart/pkg/jwt"
@@ -23,10 +27,15 @@ import (
 )
 
 func main() {
+	cfg := config.MustLoad()
 
-	logger.Init(zerolog.DebugLevel)
+	closeLog, err := logger.Setup(loggerConfig(cfg.Logger))
+	if err != nil {
+		log.Printf("Failed to set up logger: %v", err)
+		return
+	}
+	defer closeLog()
 
-	cfg := config.MustLoad()
 	db, err := database.NewPostgresDB(cfg.Database)
 	if err != nil {
 		return
@@ -35,6 +44,33 @@ func main() {
 		sqlDB, _ := db.DB()
 		sqlDB.Close()
 	}()
+	if sqlDB, err := db.DB(); err == nil {
+		metrics.RegisterDB(sqlDB)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("exporter", cfg.Tracing.Exporter).
+			Msg("Failed to set up tracing")
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn().
+				Err(err).
+				Msg("Failed to flush pending spans")
+		}
+	}()
+	if err := tracing.RegisterGORM(db); err != nil {
+		logger.Error().
+			Err(err).
+			Msg("Failed to register GORM tracing callbacks")
+		return
+	}
 
 	if err := database.Migrate(db); err != nil {
 		logger.Error().
@@ -45,65 +81,199 @@ func main() {
 	}
 	repo := postgresql.NewRepository(db)
 	jwtManager := jwt.NewManager(cfg.Auth.JWTSecret, 30*24*time.Hour)
-	accrualClient := accrual.NewClient(cfg.Accural)
+	accrualClient := accrual.NewClient(cfg.Accural,
+		accrual.WithRateLimiter(accrual.NewRateLimiter(cfg.AccrualClient.MinRPS, cfg.AccrualClient.MaxRPS)),
+		accrual.WithRetry(accrual.RetryPolicy{
+			MaxAttempts: cfg.AccrualClient.RetryAttempts,
+			BaseDelay:   cfg.AccrualClient.RetryBaseDelay,
+			MaxDelay:    cfg.AccrualClient.RetryMaxDelay,
+		}),
+		accrual.WithCircuitBreaker(accrual.NewCircuitBreaker(
+			cfg.AccrualClient.BreakerThreshold,
+			cfg.AccrualClient.BreakerOpenTimeout,
+		)),
+		accrual.WithHTTPClient(&n.Client{
+			Timeout: cfg.AccrualClient.Timeout,
+			Transport: accrual.NewTransport(accrual.TransportConfig{
+				MaxIdleConns:        cfg.AccrualClient.MaxIdleConns,
+				MaxIdleConnsPerHost: cfg.AccrualClient.MaxIdleConnsPerHost,
+				IdleConnTimeout:     cfg.AccrualClient.IdleConnTimeout,
+			}),
+		}),
+		accrual.WithCache(cfg.AccrualClient.CacheTTL, cfg.AccrualClient.CacheMaxEntries),
+		accrual.WithRequestObserver(metrics.ObserveAccrualRequest),
+	)
+	metrics.RegisterAccrualClient(accrualClient)
+
+	var processorOpts []worker.ProcessorOption
+	switch cfg.AccrualClient.Mode {
+	case "", "poll":
+	case "push":
+		processorOpts = append(processorOpts, worker.WithRegistrar(accrualClient))
+	default:
+		logger.Error().
+			Str("mode", cfg.AccrualClient.Mode).
+			Msg("Unknown accrual_client.mode, expected poll or push")
+		return
+	}
+	orderProcessor := worker.NewOrderProcessor(
+		repo.Order,
+		accrualClient,
+		cfg.Worker,
+		processorOpts...,
+	)
+	orderEvents := postgresql.NewOrderEvents(db, cfg.Database.PostgresDatabase.URI)
 
 	authService := service.NewAuthService(repo.User, cfg.Auth.JWTSecret)
-	orderService := service.NewOrderService(repo.Order, repo.User, accrualClient)
-	balanceService := service.NewBalanceService(repo.User, repo.Order, repo.Withdrawal)
+	orderService := service.NewOrderService(repo.Order, repo.User, orderProcessor, orderEvents)
+	balanceService := service.NewBalanceService(repo.User, repo.Order, repo.Withdrawal, cfg.Withdrawal.CancelWindow)
+	webhookService := service.NewWebhookService(repo.Webhook)
+	streamService := service.NewStreamService(repo.UserEvent, cfg.Stream.Buffer, cfg.Stream.Retention)
+	idempotencyService := service.NewIdempotencyService(repo.Idempotency, cfg.Idempotency.TTL, cfg.Idempotency.LockTimeout)
 
 	authHandler := http.NewAuthHandler(authService, jwtManager)
 	orderHandler := http.NewOrderHandler(orderService)
 	balanceHandler := http.NewBalanceHandler(balanceService)
+	adminHandler := http.NewAdminHandler(balanceService, orderService, accrualClient)
+	webhookHandler := http.NewWebhookHandler(webhookService)
+	streamHandler := http.NewStreamHandler(streamService, cfg.Stream.HeartbeatInterval)
+	// A worker is only stale once it has missed a whole cycle and the sweep
+	// after it; a shorter worker_max_age would flag busy workers.
+	workerMaxAge := max(cfg.Health.WorkerMaxAge, orderProcessor.MaxCycleDuration()+cfg.Worker.PollInterval)
+	workerCheck := service.WorkerCheck("worker", orderProcessor, workerMaxAge)
+	workerCheck.Optional = true
+	healthService := service.NewHealthService(cfg.Health.CheckTimeout,
+		service.HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}},
+		service.HealthCheck{Name: "migrations", Check: func(ctx context.Context) error {
+			return database.CheckMigrations(ctx, db)
+		}},
+		service.HealthCheck{Name: "accrual", Check: accrualClient.Ping, Optional: true},
+		workerCheck,
+	)
+	healthHandler := http.NewHealthHandler(healthService)
 
 	e := echo.New()
 
-	e.Use(middleware.Logger())
+	e.Use(http.RequestIDMiddleware())
+	e.Use(http.AccessLogMiddleware(logger.Writer(), func(c echo.Context) bool {
+		return c.Path() == "/healthz" || c.Path() == "/readyz"
+	}))
+	e.Use(http.TracingMiddleware())
+	e.Use(http.MetricsMiddleware())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"http://localhost", "*"},
 		AllowMethods:     []string{n.MethodGet, n.MethodPost, n.MethodPut, n.MethodDelete},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderCookie},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderCookie, echo.HeaderXRequestID},
+		ExposeHeaders:    []string{echo.HeaderXRequestID},
 		AllowCredentials: true,
 
 		MaxAge: 86400,
 	}))
-	api := e.Group("/api")
-
-	api.POST("/user/register", authHandler.Register)
-	api.POST("/user/login", authHandler.Login)
-	authGroup := api.Group("")
-
-	authGroup.Use(http.AuthMiddleware(jwtManager))
+	http.RegisterRoutes(e, jwtManager, cfg.Admin.Token, http.Handlers{
+		Auth:    authHandler,
+		Order:   orderHandler,
+		Balance: balanceHandler,
+		Admin:   adminHandler,
+		Webhook: webhookHandler,
+		Stream:  streamHandler,
+		Health:  healthHandler,
 
-	authGroup.POST("/user/orders", orderHandler.UploadOrder)
-	authGroup.GET("/user/orders", orderHandler.GetOrders)
-	authGroup.GET("/user/balance", balanceHandler.GetBalance)
-	authGroup.POST("/user/balance/withdraw", balanceHandler.Withdraw)
-	authGroup.GET("/user/withdrawals", balanceHandler.GetWithdrawals)
+		Idempotency: idempotencyService,
+	})
+	var metricsServer *n.Server
+	switch {
+	case cfg.Metrics.Path == "":
+	case cfg.Metrics.Address != "":
+		mux := n.NewServeMux()
+		mux.Handle(cfg.Metrics.Path, metrics.Handler())
+		metricsServer = &n.Server{
+			Addr:              cfg.Metrics.Address,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+	default:
+		// Metrics reveal traffic and internals, so the public listener only
+		// serves them to operators.
+		e.GET(cfg.Metrics.Path, echo.WrapHandler(metrics.Handler()), http.AdminMiddleware(cfg.Admin.Token))
+	}
 	for _, route := range e.Routes() {
 		log.Printf("Registered: %-6s %s", route.Method, route.Path)
 	}
 
-	orderProcessor := worker.NewOrderProcessor(
-		repo.Order,
-		repo.User,
-		accrualClient,
-	)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go orderProcessor.Run(ctx, 5*time.Second)
+	go orderEvents.Listen(ctx, func(string) {
+		orderProcessor.Wake()
+	})
+
+	go reloadLogLevelOnHangup(ctx)
+
+	go postgresql.ListenUserEvents(ctx, cfg.Database.PostgresDatabase.URI, func(userID string, eventID uint) {
+		streamService.Notify(ctx, userID, eventID)
+	})
+	go streamService.Run(ctx)
+	go idempotencyService.Run(ctx)
+
+	publisher, closePublisher, err := newEventPublisher(cfg.Outbox)
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("publisher", cfg.Outbox.Publisher).
+			Msg("Failed to create event publisher")
+		return
+	}
+	defer closePublisher()
+	if publisher != nil {
+		dispatcher := worker.NewOutboxDispatcher(repo.Outbox, publisher, cfg.Outbox)
+		go dispatcher.Run(ctx, cfg.Outbox.PollInterval)
+	} else {
+		logger.Info().Msg("Event publishing disabled, events stay in the outbox table")
+	}
+
+	webhookDispatcher := worker.NewWebhookDispatcher(repo.Webhook, cfg.Webhooks)
+	go webhookDispatcher.Run(ctx, cfg.Webhooks.PollInterval)
+
+	processorDone := make(chan struct{})
+	go func() {
+		orderProcessor.Run(ctx, cfg.Worker.PollInterval)
+		close(processorDone)
+	}()
 
 	go func() {
 		if err := e.Start(cfg.Server.Address); err != nil {
 			log.Println("Err ", err)
 		}
 	}()
+	if metricsServer != nil {
+		go func() {
+			logger.Info().
+				Str("address", cfg.Metrics.Address).
+				Msg("Serving metrics on a separate listener")
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, n.ErrServerClosed) {
+				logger.Error().Err(err).Msg("Metrics server failed")
+			}
+		}()
+	}
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	<-quit
 
+	healthService.SetShuttingDown()
+	if cfg.Health.ShutdownDelay > 0 {
+		logger.Info().
+			Dur("delay", cfg.Health.ShutdownDelay).
+			Msg("Readiness probe failing, waiting before shutdown")
+		time.Sleep(cfg.Health.ShutdownDelay)
+	}
+
 	ctx2, cancel2 := context.WithTimeout(ctx, cfg.Server.ShutdownTimeout)
 
 	defer cancel2()
@@ -112,7 +282,103 @@ func main() {
 	} else {
 		logger.Info().Msg("Server stopped gracefully")
 	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx2); err != nil {
+			logger.Error().Err(err).Msg("Failed to shut down metrics server")
+		}
+	}
 	cancel()
 
+	select {
+	case <-processorDone:
+		logger.Info().Msg("Order processor stopped gracefully")
+	case <-time.After(cfg.Server.ShutdownTimeout):
+		logger.Warn().Msg("Timed out waiting for order processor to drain")
+	}
+
 	logger.Info().Msg("Application stopped")
 }
+
+func loggerConfig(cfg config.LoggerConfig) logger.Config {
+	return logger.Config{
+		Level:  cfg.Level,
+		Format: cfg.Format,
+		Output: cfg.Output,
+		File: logger.FileConfig{
+			Path:       cfg.File.Path,
+			MaxSizeMB:  cfg.File.MaxSizeMB,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAgeDays: cfg.File.MaxAgeDays,
+			Compress:   cfg.File.Compress,
+		},
+		WithCaller: cfg.WithCaller,
+		Sampling: logger.SamplingConfig{
+			Burst:  cfg.Sampling.Burst,
+			Period: cfg.Sampling.Period,
+			Every:  cfg.Sampling.Every,
+		},
+		Redaction: logger.RedactionConfig{
+			Mode:    cfg.Redaction.Mode,
+			Fields:  cfg.Redaction.Fields,
+			HashKey: cfg.Redaction.HashKey,
+		},
+	}
+}
+
+// reloadLogLevelOnHangup applies logger.level from the config file on SIGHUP.
+func reloadLogLevelOnHangup(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+
+		name, err := config.ReloadLoggerLevel()
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("Failed to reload config on SIGHUP")
+			continue
+		}
+		level, err := logger.ParseLevel(name)
+		if err != nil {
+			logger.Error().
+				Err(err).
+				Msg("Failed to reload log level on SIGHUP")
+			continue
+		}
+		logger.SetLevel(level)
+		logger.Info().
+			Str("level", level.String()).
+			Msg("Log level reloaded")
+	}
+}
+
+// newEventPublisher returns nil when publishing is disabled.
+func newEventPublisher(cfg config.OutboxConfig) (events.Publisher, func(), error) {
+	noop := func() {}
+	switch cfg.Publisher {
+	case "", "none":
+		return nil, noop, nil
+	case "stdout":
+		return events.NewWriterPublisher(os.Stdout), noop, nil
+	case "file":
+		publisher, closer, err := events.NewFilePublisher(cfg.FilePath)
+		if err != nil {
+			return nil, noop, err
+		}
+		return publisher, func() { closer.Close() }, nil
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, noop, fmt.Errorf("outbox.webhook_url is required for the webhook publisher")
+		}
+		return events.NewWebhookPublisher(cfg.WebhookURL, cfg.PublishTimeout), noop, nil
+	default:
+		return nil, noop, fmt.Errorf("unknown outbox publisher %q", cfg.Publisher)
+	}
+}
@@ -0,0 +1,238 @@
+package accrualsim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophemart/pkg/logger"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// fault is a scripted misbehaviour of GET /api/orders/{number}.
+type fault struct {
+	order      string
+	status     int
+	delay      time.Duration
+	retryAfter int
+	body       string
+	remaining  int
+}
+
+// FaultRequest is the body of POST /sim/faults.
+type FaultRequest struct {
+	// Order limits the fault to one order; empty matches every order.
+	Order string `json:"order,omitempty"`
+	// Status is the response code to send; 0 answers normally after Delay.
+	Status int `json:"status,omitempty"`
+	// Delay is a Go duration ("2s") to wait before answering.
+	Delay string `json:"delay,omitempty"`
+	// RetryAfter is sent in the Retry-After header of a 429, in seconds.
+	RetryAfter int    `json:"retry_after,omitempty"`
+	Body       string `json:"body,omitempty"`
+	// Count is how many polls the fault affects; 0 means one.
+	Count int `json:"count,omitempty"`
+}
+
+// AddFault scripts the next matching polls to fail.
+func (s *Simulator) AddFault(req FaultRequest) error {
+	var delay time.Duration
+	if req.Delay != "" {
+		d, err := time.ParseDuration(req.Delay)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid delay %q", req.Delay)
+		}
+		delay = d
+	}
+	if req.Status != 0 && (req.Status < 100 || req.Status > 599) {
+		return fmt.Errorf("invalid status %d", req.Status)
+	}
+	count := req.Count
+	if count <= 0 {
+		count = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{
+		order:      req.Order,
+		status:     req.Status,
+		delay:      delay,
+		retryAfter: req.RetryAfter,
+		body:       req.Body,
+		remaining:  count,
+	})
+	return nil
+}
+
+func (s *Simulator) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// takeFault returns the first fault matching number and uses it up once.
+func (s *Simulator) takeFault(number string) *fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if f.order != "" && f.order != number {
+			continue
+		}
+		f.remaining--
+		if f.remaining == 0 {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+		}
+		taken := *f
+		return &taken
+	}
+	return nil
+}
+
+// Handler serves the accrual API under /api and the scripting API under /sim.
+func (s *Simulator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/orders/{number}", s.getOrder)
+	mux.HandleFunc("POST /api/orders", s.registerOrder)
+	mux.HandleFunc("POST /api/goods", s.addRule)
+
+	mux.HandleFunc("POST /sim/faults", s.addFault)
+	mux.HandleFunc("DELETE /sim/faults", s.clearFaults)
+	mux.HandleFunc("POST /sim/orders/{number}/status", s.setStatus)
+	mux.HandleFunc("POST /sim/reset", s.reset)
+	mux.HandleFunc("GET /sim/stats", s.stats)
+	return mux
+}
+
+func (s *Simulator) getOrder(w http.ResponseWriter, r *http.Request) {
+	number := r.PathValue("number")
+
+	if f := s.takeFault(number); f != nil {
+		if f.delay > 0 {
+			select {
+			case <-time.After(f.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.status != 0 {
+			logger.Info().
+				Str("order_number", number).
+				Int("status_code", f.status).
+				Msg("Injecting scripted accrual failure")
+			if f.status == http.StatusTooManyRequests && f.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(f.retryAfter))
+			}
+			w.WriteHeader(f.status)
+			w.Write([]byte(f.body))
+			return
+		}
+	}
+
+	if wait, ok := s.allow(); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per minute allowed", s.cfg.RequestsPerMinute)
+		return
+	}
+
+	info, ok := s.OrderInfo(number)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+type registerOrderRequest struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+func (s *Simulator) registerOrder(w http.ResponseWriter, r *http.Request) {
+	var req registerOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request format", http.StatusBadRequest)
+		return
+	}
+	err := s.RegisterOrder(req.Order, req.Goods)
+	switch {
+	case errors.Is(err, ErrInvalidOrder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrOrderExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *Simulator) addRule(w http.ResponseWriter, r *http.Request) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "invalid request format", http.StatusBadRequest)
+		return
+	}
+	err := s.AddRule(rule)
+	switch {
+	case errors.Is(err, ErrInvalidRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrRuleExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Simulator) addFault(w http.ResponseWriter, r *http.Request) {
+	var req FaultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := s.AddFault(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Simulator) clearFaults(w http.ResponseWriter, _ *http.Request) {
+	s.ClearFaults()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) setStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request format", http.StatusBadRequest)
+		return
+	}
+	err := s.SetStatus(r.PathValue("number"), req.Status)
+	switch {
+	case errors.Is(err, ErrInvalidStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrOrderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Simulator) reset(w http.ResponseWriter, _ *http.Request) {
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) stats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int64{"requests": s.Requests()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
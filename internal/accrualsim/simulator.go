@@ -0,0 +1,276 @@
+// Package accrualsim is a local stand-in for the external accrual service.
+// It speaks the same HTTP contract accrual.Client expects and lets tests
+// script failures through a separate /sim API.
+package accrualsim
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Order statuses reported by the simulator, as in the real accrual service.
+const (
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Reward types of a rule: a percentage of the good's price or fixed points.
+const (
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+var (
+	ErrInvalidOrder  = errors.New("invalid order number")
+	ErrInvalidStatus = errors.New("invalid order status")
+	ErrInvalidRule   = errors.New("invalid reward rule")
+	ErrOrderExists   = errors.New("order already registered")
+	ErrRuleExists    = errors.New("reward rule already registered")
+	ErrOrderNotFound = errors.New("order not registered")
+)
+
+// Config controls timing and limits of the simulator.
+type Config struct {
+	// ProcessingAfter is how long an order stays REGISTERED.
+	ProcessingAfter time.Duration
+	// ProcessedAfter is how long after registration the order is PROCESSED.
+	ProcessedAfter time.Duration
+	// RequestsPerMinute limits order polls; 0 disables the limit.
+	RequestsPerMinute int
+	// AutoAccrual, when positive, registers unknown orders with a valid
+	// number on their first poll, rewarding them with this many points.
+	AutoAccrual float64
+}
+
+// Good is an item of a registered order.
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// Rule rewards goods whose description contains Match, case-insensitively.
+type Rule struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+// OrderInfo is the answer to GET /api/orders/{number}.
+type OrderInfo struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual,omitempty"`
+}
+
+type order struct {
+	goods        []Good
+	registeredAt time.Time
+	// fixedAccrual replaces the rules for auto-registered orders.
+	fixedAccrual *float64
+	// forced overrides the time-based progression when set via /sim.
+	forced string
+}
+
+// Simulator keeps orders and reward rules in memory.
+type Simulator struct {
+	cfg Config
+	now func() time.Time
+
+	mu     sync.Mutex
+	orders map[string]*order
+	rules  []Rule
+	faults []*fault
+
+	windowStart time.Time
+	windowCount int
+	requests    int64
+}
+
+func New(cfg Config) *Simulator {
+	if cfg.ProcessedAfter < cfg.ProcessingAfter {
+		cfg.ProcessedAfter = cfg.ProcessingAfter
+	}
+	return &Simulator{
+		cfg:    cfg,
+		now:    time.Now,
+		orders: make(map[string]*order),
+	}
+}
+
+// RegisterOrder accepts an order for processing.
+func (s *Simulator) RegisterOrder(number string, goods []Good) error {
+	if !isValidLuhn(number) {
+		return ErrInvalidOrder
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[number]; ok {
+		return ErrOrderExists
+	}
+	s.orders[number] = &order{goods: goods, registeredAt: s.now()}
+	return nil
+}
+
+// AddRule registers a reward rule. Match strings are unique.
+func (s *Simulator) AddRule(rule Rule) error {
+	if rule.Match == "" || rule.Reward < 0 ||
+		(rule.RewardType != RewardPercent && rule.RewardType != RewardPoints) {
+		return ErrInvalidRule
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if strings.EqualFold(r.Match, rule.Match) {
+			return ErrRuleExists
+		}
+	}
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+// SetStatus pins an order to status regardless of elapsed time.
+func (s *Simulator) SetStatus(number, status string) error {
+	switch status {
+	case StatusRegistered, StatusProcessing, StatusInvalid, StatusProcessed:
+	default:
+		return ErrInvalidStatus
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[number]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	o.forced = status
+	return nil
+}
+
+// Reset forgets all orders, rules, faults and rate-limit state.
+func (s *Simulator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders = make(map[string]*order)
+	s.rules = nil
+	s.faults = nil
+	s.windowStart = time.Time{}
+	s.windowCount = 0
+	s.requests = 0
+}
+
+// Requests returns the number of order polls received.
+func (s *Simulator) Requests() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// OrderInfo reports the order as of now; ok is false for unknown orders.
+func (s *Simulator) OrderInfo(number string) (OrderInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		if s.cfg.AutoAccrual <= 0 || !isValidLuhn(number) {
+			return OrderInfo{}, false
+		}
+		accrual := s.cfg.AutoAccrual
+		o = &order{registeredAt: s.now(), fixedAccrual: &accrual}
+		s.orders[number] = o
+	}
+
+	info := OrderInfo{Order: number, Status: s.statusOf(o)}
+	if info.Status == StatusProcessed {
+		info.Accrual = s.accrualOf(o)
+	}
+	return info, true
+}
+
+func (s *Simulator) statusOf(o *order) string {
+	if o.forced != "" {
+		return o.forced
+	}
+	elapsed := s.now().Sub(o.registeredAt)
+	switch {
+	case elapsed < s.cfg.ProcessingAfter:
+		return StatusRegistered
+	case elapsed < s.cfg.ProcessedAfter:
+		return StatusProcessing
+	case o.fixedAccrual == nil && len(o.goods) == 0:
+		return StatusInvalid
+	default:
+		return StatusProcessed
+	}
+}
+
+// accrualOf applies the first matching rule to every good.
+func (s *Simulator) accrualOf(o *order) float64 {
+	if o.fixedAccrual != nil {
+		return *o.fixedAccrual
+	}
+	var total float64
+	for _, good := range o.goods {
+		description := strings.ToLower(good.Description)
+		for _, rule := range s.rules {
+			if !strings.Contains(description, strings.ToLower(rule.Match)) {
+				continue
+			}
+			if rule.RewardType == RewardPercent {
+				total += good.Price * rule.Reward / 100
+			} else {
+				total += rule.Reward
+			}
+			break
+		}
+	}
+	return total
+}
+
+// allow counts a poll against the per-minute limit and, when the limit is
+// exhausted, returns how long until the next window opens.
+func (s *Simulator) allow() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.cfg.RequestsPerMinute <= 0 {
+		return 0, true
+	}
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.cfg.RequestsPerMinute {
+		return s.windowStart.Add(time.Minute).Sub(now), false
+	}
+	s.windowCount++
+	return 0, true
+}
+
+func isValidLuhn(number string) bool {
+	if number == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,171 @@
+package accrualsim
+
+import (
+	"context"
+	"errors"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/transport/accrual"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func newTestSimulator(t *testing.T, cfg Config) (*Simulator, *testClock, *httptest.Server) {
+	t.Helper()
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	sim := New(cfg)
+	sim.now = clock.now
+	server := httptest.NewServer(sim.Handler())
+	t.Cleanup(server.Close)
+	return sim, clock, server
+}
+
+func post(t *testing.T, url, body string) int {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSimulator_ProgressionAndRewards(t *testing.T) {
+	_, clock, server := newTestSimulator(t, Config{ProcessingAfter: time.Second, ProcessedAfter: 3 * time.Second})
+	client := accrual.NewClient(server.URL)
+	ctx := context.Background()
+
+	assert.Equal(t, http.StatusOK, post(t, server.URL+"/api/goods", `{"match":"Bork","reward":10,"reward_type":"%"}`))
+	assert.Equal(t, http.StatusOK, post(t, server.URL+"/api/goods", `{"match":"kettle","reward":15,"reward_type":"pt"}`))
+	assert.Equal(t, http.StatusConflict, post(t, server.URL+"/api/goods", `{"match":"bork","reward":1,"reward_type":"pt"}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server.URL+"/api/goods", `{"match":"x","reward":1,"reward_type":"usd"}`))
+
+	assert.Equal(t, http.StatusAccepted, post(t, server.URL+"/api/orders",
+		`{"order":"12345678903","goods":[{"description":"Чайник Bork","price":7000},{"description":"Electric kettle","price":100},{"description":"Spoon","price":5}]}`))
+	assert.Equal(t, http.StatusConflict, post(t, server.URL+"/api/orders", `{"order":"12345678903","goods":[]}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server.URL+"/api/orders", `{"order":"12345678902","goods":[]}`))
+	assert.Equal(t, http.StatusAccepted, post(t, server.URL+"/api/orders", `{"order":"79927398713"}`))
+
+	info, err := client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, entity.AccrualRegistered, info.Status)
+
+	clock.t = clock.t.Add(time.Second)
+	info, err = client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, entity.AccrualProcessing, info.Status)
+
+	clock.t = clock.t.Add(2 * time.Second)
+	info, err = client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.AccrualOrderInfo{Order: "12345678903", Status: entity.AccrualProcessed, Accrual: 715}, info)
+
+	info, err = client.GetOrderInfo(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, entity.AccrualInvalid, info.Status, "orders without goods are rejected")
+
+	info, err = client.GetOrderInfo(ctx, "4561261212345467")
+	assert.NoError(t, err)
+	assert.Nil(t, info, "unknown orders answer 204")
+}
+
+func TestSimulator_AutoAccrual(t *testing.T) {
+	_, _, server := newTestSimulator(t, Config{AutoAccrual: 500})
+	client := accrual.NewClient(server.URL)
+
+	info, err := client.GetOrderInfo(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.AccrualOrderInfo{Order: "12345678903", Status: entity.AccrualProcessed, Accrual: 500}, info)
+
+	info, err = client.GetOrderInfo(context.Background(), "12345678902")
+	assert.NoError(t, err)
+	assert.Nil(t, info, "numbers failing the Luhn check are never registered")
+}
+
+func TestSimulator_RateLimit(t *testing.T) {
+	_, clock, server := newTestSimulator(t, Config{RequestsPerMinute: 2, AutoAccrual: 1})
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(server.URL + "/api/orders/12345678903")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	clock.t = clock.t.Add(20 * time.Second)
+	client := accrual.NewClient(server.URL)
+	_, err := client.GetOrderInfo(context.Background(), "12345678903")
+	var rlErr *entity.AccrualRateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, 40*time.Second, rlErr.RetryAfter)
+	assert.InDelta(t, 2.0/60, client.RateLimitState().Rate, 1e-9, "the client follows the advertised limit")
+
+	clock.t = clock.t.Add(40 * time.Second)
+	resp, err := http.Get(server.URL + "/api/orders/12345678903")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a new window opens after a minute")
+}
+
+func TestSimulator_ScriptedFaults(t *testing.T) {
+	sim, _, server := newTestSimulator(t, Config{AutoAccrual: 1})
+	client := accrual.NewClient(server.URL,
+		accrual.WithRetry(accrual.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		accrual.WithCircuitBreaker(accrual.NewCircuitBreaker(0, 0)),
+	)
+	ctx := context.Background()
+
+	assert.Equal(t, http.StatusCreated, post(t, server.URL+"/sim/faults", `{"order":"12345678903","status":503,"count":2}`))
+	info, err := client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err, "two 503s are absorbed by the client's retries")
+	assert.Equal(t, entity.AccrualProcessed, info.Status)
+
+	assert.Equal(t, http.StatusCreated, post(t, server.URL+"/sim/faults", `{"status":429,"retry_after":7}`))
+	_, err = client.GetOrderInfo(ctx, "79927398713")
+	var rlErr *entity.AccrualRateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, 7*time.Second, rlErr.RetryAfter)
+
+	assert.Equal(t, http.StatusCreated, post(t, server.URL+"/sim/faults", `{"delay":"1h"}`))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = accrual.NewClient(server.URL).GetOrderInfo(timeoutCtx, "12345678903")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	assert.Equal(t, http.StatusBadRequest, post(t, server.URL+"/sim/faults", `{"delay":"soon"}`))
+	sim.AddFault(FaultRequest{Status: 500, Count: 10})
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/sim/faults", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Nil(t, sim.takeFault("12345678903"))
+}
+
+func TestSimulator_ForcedStatusAndReset(t *testing.T) {
+	sim, _, server := newTestSimulator(t, Config{ProcessingAfter: time.Hour, ProcessedAfter: time.Hour})
+	require.NoError(t, sim.RegisterOrder("12345678903", []Good{{Description: "x", Price: 1}}))
+
+	assert.Equal(t, http.StatusNoContent, post(t, server.URL+"/sim/orders/12345678903/status", `{"status":"INVALID"}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, server.URL+"/sim/orders/12345678903/status", `{"status":"DONE"}`))
+	assert.Equal(t, http.StatusNotFound, post(t, server.URL+"/sim/orders/79927398713/status", `{"status":"INVALID"}`))
+
+	info, ok := sim.OrderInfo("12345678903")
+	require.True(t, ok)
+	assert.Equal(t, StatusInvalid, info.Status)
+
+	assert.Equal(t, http.StatusNoContent, post(t, server.URL+"/sim/reset", ``))
+	_, ok = sim.OrderInfo("12345678903")
+	assert.False(t, ok)
+}
@@ -0,0 +1,114 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AccrualStatus is the status of an order in the accrual system.
+type AccrualStatus string
+
+const (
+	AccrualRegistered AccrualStatus = "REGISTERED"
+	AccrualProcessing AccrualStatus = "PROCESSING"
+	AccrualInvalid    AccrualStatus = "INVALID"
+	AccrualProcessed  AccrualStatus = "PROCESSED"
+)
+
+// AccrualOrderInfo is what the accrual system knows about an order.
+type AccrualOrderInfo struct {
+	Order   string        `json:"order"`
+	Status  AccrualStatus `json:"status"`
+	Accrual float64       `json:"accrual,omitempty"`
+}
+
+var (
+	// ErrAccrualCircuitOpen means requests to the accrual system are
+	// suspended after repeated failures.
+	ErrAccrualCircuitOpen = errors.New("accrual service circuit breaker is open")
+	// ErrAccrualAlreadyRegistered means the accrual system already knows the
+	// order that was pushed to it.
+	ErrAccrualAlreadyRegistered = errors.New("order already registered in accrual service")
+)
+
+// AccrualRateLimitError means the accrual system asked to wait RetryAfter
+// before sending more requests.
+type AccrualRateLimitError struct {
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *AccrualRateLimitError) Error() string {
+	return fmt.Sprintf("%s (retry after %v)", e.Message, e.RetryAfter)
+}
+
+// AccrualBreakerStatus is the state of the accrual client's circuit breaker.
+type AccrualBreakerStatus int
+
+const (
+	// AccrualBreakerClosed lets every request through.
+	AccrualBreakerClosed AccrualBreakerStatus = iota
+	// AccrualBreakerOpen rejects requests until the open timeout elapses.
+	AccrualBreakerOpen
+	// AccrualBreakerHalfOpen lets a single probe through; its outcome closes
+	// or reopens the breaker.
+	AccrualBreakerHalfOpen
+)
+
+func (s AccrualBreakerStatus) String() string {
+	switch s {
+	case AccrualBreakerClosed:
+		return "closed"
+	case AccrualBreakerOpen:
+		return "open"
+	case AccrualBreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// AccrualBreakerState is a snapshot of the circuit breaker.
+type AccrualBreakerState struct {
+	Status AccrualBreakerStatus
+	// OpenUntil is when an open breaker lets the next probe through.
+	OpenUntil time.Time
+	// Failures counts consecutive failures while closed.
+	Failures int
+}
+
+// Open reports whether requests are rejected at now.
+func (s AccrualBreakerState) Open(now time.Time) bool {
+	return s.Status == AccrualBreakerOpen && now.Before(s.OpenUntil)
+}
+
+// AccrualRateLimiterState is a snapshot of the shared accrual rate limiter.
+type AccrualRateLimiterState struct {
+	// PausedUntil is the moment requests may resume after a 429; zero when not paused.
+	PausedUntil time.Time
+	// Rate is the current request budget per second; zero means unlimited.
+	Rate float64
+	// RateLimited counts 429 responses observed since start.
+	RateLimited int64
+}
+
+// Paused reports whether requests are suspended at now.
+func (s AccrualRateLimiterState) Paused(now time.Time) bool {
+	return now.Before(s.PausedUntil)
+}
+
+// AccrualCacheStats is a snapshot of the accrual client's order lookup
+// counters.
+type AccrualCacheStats struct {
+	// Hits counts lookups answered from the cache.
+	Hits int64
+	// Misses counts lookups that went on to the accrual service.
+	Misses int64
+	// Shared counts misses that joined a request already in flight for the
+	// same order instead of sending their own.
+	Shared int64
+	// Entries is the number of cached answers, expired ones included until
+	// they are evicted.
+	Entries int
+}
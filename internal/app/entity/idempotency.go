@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+)
+
+// IdempotencyRecord stores the outcome of a request made with an
+// Idempotency-Key header so that retries can be answered without re-executing it.
+type IdempotencyRecord struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	UserID      string    `gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	Key         string    `gorm:"uniqueIndex:idx_idempotency_user_key;type:varchar(255);not null"`
+	RequestHash string    `gorm:"type:varchar(64);not null"`
+	Completed   bool      `gorm:"not null;default:false"`
+	StatusCode  int       `gorm:"not null;default:0"`
+	ContentType string    `gorm:"type:varchar(255)"`
+	Body        []byte    `gorm:"type:bytea"`
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -13,6 +15,55 @@ const (
 	OrderProcessed  OrderStatus = "PROCESSED"
 )
 
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// orderTransitions lists, for every status, the statuses an order may move to.
+// INVALID and PROCESSED are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderNew:        {OrderProcessing, OrderInvalid, OrderProcessed},
+	OrderProcessing: {OrderInvalid, OrderProcessed},
+	OrderInvalid:    nil,
+	OrderProcessed:  nil,
+}
+
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// IsFinal reports whether the accrual system is done with the order.
+func (s OrderStatus) IsFinal() bool {
+	return s == OrderInvalid || s == OrderProcessed
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns ErrIllegalTransition unless from may move to to.
+func ValidateTransition(from, to OrderStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	return nil
+}
+
+// StatusesBefore returns the statuses from which an order may move to status.
+func StatusesBefore(status OrderStatus) []OrderStatus {
+	var from []OrderStatus
+	for s := range orderTransitions {
+		if s.CanTransitionTo(status) {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
 type Order struct {
 	ID         uint        `gorm:"primaryKey;autoIncrement"`
 	UserID     string      `gorm:"index;not null"`
@@ -20,6 +71,26 @@ type Order struct {
 	Status     OrderStatus `gorm:"type:varchar(20);index;not null"`
 	Accrual    float64     `gorm:"type:decimal(10,2);default:0.0"`
 	UploadedAt time.Time   `gorm:"not null"`
-	CreatedAt  time.Time   `gorm:"autoCreateTime"`
-	UpdatedAt  time.Time   `gorm:"autoUpdateTime"`
+	// LeaseExpiresAt is set while a worker holds the order; see OrderRepository.ClaimPending.
+	LeaseExpiresAt *time.Time `gorm:"index"`
+	// NextAttemptAt delays the next accrual poll; AttemptCount counts polls
+	// that did not reach a final status.
+	NextAttemptAt *time.Time `gorm:"index"`
+	AttemptCount  int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"type:text"`
+	// ParkedAt is set once the order exhausted its attempts; parked orders are
+	// not polled until requeued.
+	ParkedAt *time.Time `gorm:"index"`
+	// Goods are sent along when the order is registered with the accrual
+	// system; AccrualRegisteredAt is set once the accrual system accepted it.
+	Goods               []Good `gorm:"serializer:json;type:jsonb"`
+	AccrualRegisteredAt *time.Time
+	CreatedAt           time.Time `gorm:"autoCreateTime"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime"`
+}
+
+// Good is an item of an order as the accrual system prices it.
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
 }
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderStatus_Transitions(t *testing.T) {
+	statuses := []OrderStatus{OrderNew, OrderProcessing, OrderInvalid, OrderProcessed}
+	allowed := map[OrderStatus]map[OrderStatus]bool{
+		OrderNew:        {OrderProcessing: true, OrderInvalid: true, OrderProcessed: true},
+		OrderProcessing: {OrderInvalid: true, OrderProcessed: true},
+		OrderInvalid:    {},
+		OrderProcessed:  {},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[from][to]
+			t.Run(string(from)+"->"+string(to), func(t *testing.T) {
+				assert.Equal(t, want, from.CanTransitionTo(to))
+
+				err := ValidateTransition(from, to)
+				if want {
+					assert.NoError(t, err)
+				} else {
+					require.ErrorIs(t, err, ErrIllegalTransition)
+				}
+			})
+		}
+	}
+}
+
+func TestOrderStatus_UnknownStatus(t *testing.T) {
+	unknown := OrderStatus("REGISTERED")
+
+	assert.False(t, unknown.IsValid())
+	assert.False(t, OrderNew.CanTransitionTo(unknown))
+	assert.False(t, unknown.CanTransitionTo(OrderProcessed))
+	assert.Empty(t, StatusesBefore(unknown))
+}
+
+func TestOrderStatus_IsFinal(t *testing.T) {
+	assert.False(t, OrderNew.IsFinal())
+	assert.False(t, OrderProcessing.IsFinal())
+	assert.True(t, OrderInvalid.IsFinal())
+	assert.True(t, OrderProcessed.IsFinal())
+}
+
+func TestStatusesBefore(t *testing.T) {
+	assert.Empty(t, StatusesBefore(OrderNew))
+	assert.ElementsMatch(t, []OrderStatus{OrderNew}, StatusesBefore(OrderProcessing))
+	assert.ElementsMatch(t, []OrderStatus{OrderNew, OrderProcessing}, StatusesBefore(OrderProcessed))
+	assert.ElementsMatch(t, []OrderStatus{OrderNew, OrderProcessing}, StatusesBefore(OrderInvalid))
+}
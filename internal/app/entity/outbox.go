@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"time"
+)
+
+// Domain event types written to the outbox.
+const (
+	EventOrderProcessed     = "OrderProcessed"
+	EventPointsAccrued      = "PointsAccrued"
+	EventPointsWithdrawn    = "PointsWithdrawn"
+	EventWithdrawalReversed = "WithdrawalReversed"
+)
+
+// OutboxEvent is a domain event committed in the same transaction as the
+// change it describes and published later by the outbox dispatcher.
+type OutboxEvent struct {
+	ID      uint   `gorm:"primaryKey;autoIncrement"`
+	Type    string `gorm:"type:varchar(64);not null"`
+	Payload []byte `gorm:"type:jsonb;not null"`
+	// NextAttemptAt doubles as the dispatcher's lease: a claimed event is
+	// pushed into the future so that other replicas skip it.
+	NextAttemptAt time.Time  `gorm:"index;not null"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"type:text"`
+	PublishedAt   *time.Time `gorm:"index"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox"
+}
+
+// OrderProcessedEvent is emitted when an order reaches a final status.
+type OrderProcessedEvent struct {
+	OrderNumber string      `json:"order_number"`
+	UserID      string      `json:"user_id"`
+	Status      OrderStatus `json:"status"`
+	Accrual     float64     `json:"accrual,omitempty"`
+}
+
+// PointsAccruedEvent is emitted when an order's accrual is credited.
+type PointsAccruedEvent struct {
+	OrderNumber string  `json:"order_number"`
+	UserID      string  `json:"user_id"`
+	Amount      float64 `json:"amount"`
+}
+
+// PointsWithdrawnEvent is emitted when points are spent on an order.
+type PointsWithdrawnEvent struct {
+	OrderNumber string  `json:"order_number"`
+	UserID      string  `json:"user_id"`
+	Amount      float64 `json:"amount"`
+}
+
+// WithdrawalReversedEvent is emitted when a withdrawal is reversed and its
+// points are returned to the balance.
+type WithdrawalReversedEvent struct {
+	OrderNumber string  `json:"order_number"`
+	UserID      string  `json:"user_id"`
+	Amount      float64 `json:"amount"`
+	Reason      string  `json:"reason"`
+}
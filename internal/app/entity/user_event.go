@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"time"
+)
+
+// User event types streamed to the user's clients.
+const (
+	UserEventOrder   = "order"
+	UserEventBalance = "balance"
+)
+
+// UserEvent is a change to a user's orders or balance, kept for a while so
+// that stream clients can resume from the last event they saw.
+type UserEvent struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    string    `gorm:"index;not null"`
+	Type      string    `gorm:"type:varchar(32);not null"`
+	Payload   []byte    `gorm:"type:jsonb;not null"`
+	CreatedAt time.Time `gorm:"index;autoCreateTime"`
+}
+
+// OrderUpdate is the payload of an "order" event; it matches an item of
+// GET /api/user/orders.
+type OrderUpdate struct {
+	Number     string      `json:"number"`
+	Status     OrderStatus `json:"status"`
+	Accrual    *float64    `json:"accrual,omitempty"`
+	UploadedAt string      `json:"uploaded_at"`
+}
+
+// BalanceUpdate is the payload of a "balance" event; it matches
+// GET /api/user/balance.
+type BalanceUpdate struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
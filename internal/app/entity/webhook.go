@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"time"
+)
+
+const EventOrderStatusChanged = "OrderStatusChanged"
+
+// Webhook is a URL registered by a user to be told about their orders.
+// Secret signs every delivery with HMAC-SHA256.
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	UserID    string    `gorm:"index;not null"`
+	URL       string    `gorm:"type:text;not null"`
+	Secret    string    `gorm:"type:varchar(255);not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "PENDING"
+	DeliveryDelivered WebhookDeliveryStatus = "DELIVERED"
+	DeliveryFailed    WebhookDeliveryStatus = "FAILED"
+)
+
+// WebhookDelivery is one event sent to one webhook, together with the
+// outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID        uint                  `gorm:"primaryKey;autoIncrement"`
+	WebhookID uint                  `gorm:"index;not null"`
+	Webhook   *Webhook              `gorm:"constraint:OnDelete:CASCADE"`
+	UserID    string                `gorm:"index;not null"`
+	EventType string                `gorm:"type:varchar(64);not null"`
+	Payload   []byte                `gorm:"type:jsonb;not null"`
+	Status    WebhookDeliveryStatus `gorm:"type:varchar(20);not null;default:'PENDING'"`
+	// NextAttemptAt doubles as the dispatcher's lease, as in OutboxEvent.
+	NextAttemptAt  time.Time `gorm:"index;not null"`
+	Attempts       int       `gorm:"not null;default:0"`
+	LastStatusCode int       `gorm:"not null;default:0"`
+	LastError      string    `gorm:"type:text"`
+	LastAttemptAt  *time.Time
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// OrderStatusChangedEvent is delivered to a user's webhooks whenever the
+// worker moves one of their orders to a new status.
+type OrderStatusChangedEvent struct {
+	OrderNumber string      `json:"order_number"`
+	UserID      string      `json:"user_id"`
+	Status      OrderStatus `json:"status"`
+	Accrual     float64     `json:"accrual,omitempty"`
+	ChangedAt   time.Time   `json:"changed_at"`
+}
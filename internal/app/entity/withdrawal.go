@@ -4,12 +4,22 @@ import (
 	"time"
 )
 
+type WithdrawalStatus string
+
+const (
+	WithdrawalCompleted WithdrawalStatus = "COMPLETED"
+	WithdrawalReversed  WithdrawalStatus = "REVERSED"
+)
+
 type Withdrawal struct {
-	ID          uint      `gorm:"primaryKey;autoIncrement"`
-	UserID      string    `gorm:"index;not null"`
-	OrderNumber string    `gorm:"not null"`
-	Sum         float64   `gorm:"type:decimal(10,2);not null"`
-	ProcessedAt time.Time `gorm:"not null"`
-	CreatedAt   time.Time `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+	ID             uint             `gorm:"primaryKey;autoIncrement"`
+	UserID         string           `gorm:"index;not null"`
+	OrderNumber    string           `gorm:"uniqueIndex;not null"`
+	Sum            float64          `gorm:"type:decimal(10,2);not null"`
+	Status         WithdrawalStatus `gorm:"type:varchar(20);not null;default:'COMPLETED'"`
+	ReversalReason string           `gorm:"type:text"`
+	ReversedAt     *time.Time
+	ProcessedAt    time.Time `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
 }
@@ -0,0 +1,29 @@
+package provider
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"time"
+)
+
+// AccrualProvider answers what the accrual system knows about an order.
+// accrual.Client talks to the real service; accrual.Fake and accrual.Replay
+// stand in for it in tests.
+type AccrualProvider interface {
+	// GetOrderInfo returns nil and no error for orders the accrual system
+	// does not know. A *entity.AccrualRateLimitError or
+	// entity.ErrAccrualCircuitOpen means the provider is temporarily
+	// unavailable, not that the order is bad.
+	GetOrderInfo(ctx context.Context, number string) (*entity.AccrualOrderInfo, error)
+	// PausedUntil reports whether requests must not be sent at now and,
+	// if so, when they may resume.
+	PausedUntil(now time.Time) (time.Time, bool)
+}
+
+// AccrualRegistrar pushes newly uploaded orders to the accrual system when
+// gophermart runs in push mode.
+type AccrualRegistrar interface {
+	// RegisterOrder returns entity.ErrAccrualAlreadyRegistered if the accrual
+	// system already knows the order, which callers treat as success.
+	RegisterOrder(ctx context.Context, number string, goods []entity.Good) error
+}
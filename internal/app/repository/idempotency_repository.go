@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	Create(ctx context.Context, record *entity.IdempotencyRecord) error
+	Find(ctx context.Context, userID, key string) (*entity.IdempotencyRecord, error)
+	Complete(ctx context.Context, id uint, statusCode int, contentType string, body []byte) error
+	// Touch marks an incomplete record as still being worked on by moving its
+	// UpdatedAt to now.
+	Touch(ctx context.Context, id uint) error
+	Delete(ctx context.Context, id uint) error
+	// DeleteExpiredBefore deletes records that expired before the given time,
+	// along with their stored responses.
+	DeleteExpiredBefore(ctx context.Context, before time.Time) (int64, error)
+}
@@ -2,17 +2,46 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"gophemart/internal/app/entity"
+	"time"
 )
 
+// ErrLeaseLost means the order's lease expired and the order may have been
+// claimed by another worker since.
+var ErrLeaseLost = errors.New("order lease lost")
+
 type OrderRepository interface {
 	Create(ctx context.Context, order *entity.Order) error
 	FindByNumber(ctx context.Context, number string) (*entity.Order, error)
 	FindByUserID(ctx context.Context, userID string) ([]entity.Order, error)
 	Update(ctx context.Context, order *entity.Order) error
+	// UpdateStatus moves the order to status and, for PROCESSED, credits accrual
+	// to its owner. The change and its outbox events commit atomically.
 	UpdateStatus(ctx context.Context, orderNumber string, status entity.OrderStatus, accrual float64) error
 	FindUnprocessed(ctx context.Context) ([]entity.Order, error)
 	FindPending(ctx context.Context) ([]entity.Order, error)
+	// CountPending counts orders still waiting for a final accrual answer,
+	// parked ones excluded.
+	CountPending(ctx context.Context) (int64, error)
+	// ClaimPending leases up to limit pending orders to the caller for leaseDuration.
+	// Orders leased by another worker are skipped until their lease expires.
+	ClaimPending(ctx context.Context, limit int, leaseDuration time.Duration) ([]entity.Order, error)
+	// ReleaseClaim, ScheduleRetry and Park only apply while the order still holds
+	// the lease leaseExpiresAt returned by ClaimPending; otherwise they return
+	// ErrLeaseLost and change nothing.
+	ReleaseClaim(ctx context.Context, orderNumber string, leaseExpiresAt time.Time) error
+	// MarkRegistered records that the accrual system accepted the order.
+	MarkRegistered(ctx context.Context, orderNumber string) error
+	// ScheduleRetry records a failed attempt and releases the claim until nextAttemptAt.
+	ScheduleRetry(ctx context.Context, orderNumber string, leaseExpiresAt time.Time, attemptCount int, nextAttemptAt time.Time, lastError string) error
+	// Park moves the order to the dead-letter state; it is not claimed until Requeue.
+	Park(ctx context.Context, orderNumber string, leaseExpiresAt time.Time, attemptCount int, lastError string) error
+	FindParked(ctx context.Context) ([]entity.Order, error)
+	// NextAttemptAt returns the earliest scheduled retry among unleased pending
+	// orders, or nil if none is scheduled.
+	NextAttemptAt(ctx context.Context) (*time.Time, error)
+	Requeue(ctx context.Context, orderNumber string) error
 	CreateWithdrawal(ctx context.Context, withdrawal *entity.Withdrawal) error
 
 	GetWithdrawalsByUser(ctx context.Context, userID string) ([]entity.Withdrawal, error)
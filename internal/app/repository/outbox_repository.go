@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"time"
+)
+
+type OutboxRepository interface {
+	// ClaimBatch leases up to limit due, unpublished events for leaseDuration,
+	// oldest first. Events leased by another dispatcher are skipped.
+	ClaimBatch(ctx context.Context, limit int, leaseDuration time.Duration) ([]entity.OutboxEvent, error)
+	MarkPublished(ctx context.Context, id uint) error
+	ScheduleRetry(ctx context.Context, id uint, attempts int, nextAttemptAt time.Time, lastError string) error
+	// DeletePublishedBefore deletes events published before the given time;
+	// unpublished events are kept however old they are.
+	DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"time"
+)
+
+type UserEventRepository interface {
+	FindByID(ctx context.Context, id uint) (*entity.UserEvent, error)
+	// FindAfter returns up to limit events of the user with ID greater than afterID, oldest first.
+	FindAfter(ctx context.Context, userID string, afterID uint, limit int) ([]entity.UserEvent, error)
+	// LatestID returns the ID of the user's newest event, or 0 if there is none.
+	LatestID(ctx context.Context, userID string) (uint, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
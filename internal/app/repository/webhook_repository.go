@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"time"
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *entity.Webhook) error
+	FindByUserID(ctx context.Context, userID string) ([]entity.Webhook, error)
+	Delete(ctx context.Context, userID string, id uint) error
+	// FindDeliveries returns the latest deliveries to the user's webhook, newest first.
+	FindDeliveries(ctx context.Context, userID string, webhookID uint, limit int) ([]entity.WebhookDelivery, error)
+	// ClaimDeliveries leases up to limit due pending deliveries, with Webhook loaded.
+	ClaimDeliveries(ctx context.Context, limit int, leaseDuration time.Duration) ([]entity.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id uint, attempts, statusCode int) error
+	// RecordFailure stores a failed attempt; a nil nextAttemptAt gives up on the delivery.
+	RecordFailure(ctx context.Context, id uint, attempts, statusCode int, lastError string, nextAttemptAt *time.Time) error
+	// DeleteFinishedBefore deletes delivered and failed deliveries created
+	// before the given time; pending ones are kept.
+	DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error)
+}
@@ -3,9 +3,15 @@ package repository
 import (
 	"context"
 	"gophemart/internal/app/entity"
+	"time"
 )
 
 type WithdrawalRepository interface {
-	Create(ctx context.Context, withdrawal *entity.Withdrawal) error
+	// Withdraw records the withdrawal and debits the user's balance in one transaction.
+	Withdraw(ctx context.Context, withdrawal *entity.Withdrawal) error
 	FindByUserID(ctx context.Context, userID string) ([]entity.Withdrawal, error)
+	// Reverse marks the withdrawal for orderNumber as reversed and returns its sum
+	// to the user's balance in one transaction. An empty userID matches any owner;
+	// a non-zero processedAfter rejects withdrawals processed before it.
+	Reverse(ctx context.Context, userID, orderNumber, reason string, processedAfter time.Time) (*entity.Withdrawal, error)
 }
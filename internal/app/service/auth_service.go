@@ -27,21 +27,21 @@ func NewAuthService(userRepo repository.UserRepository, jwtSecret string) *AuthS
 }
 
 func (s *AuthService) Register(ctx context.Context, login, password string) (*entity.User, error) {
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "Register").
 		Str("login", login).
 		Msg("Starting user registration")
 
 	existingUser, err := s.userRepo.FindByLogin(ctx, login)
 	if err != nil && !errors.Is(err, repository.ErrRocordNotFound) {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("login", login).
 			Msg("Error checking user existence")
 		return nil, err
 	}
 	if existingUser != nil {
-		logger.Warn().
+		logger.FromContext(ctx).Warn().
 			Str("login", login).
 			Msg("User already exists, registration aborted")
 		return nil, ErrUserAlreadyExists
@@ -49,7 +49,7 @@ func (s *AuthService) Register(ctx context.Context, login, password string) (*en
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("login", login).
 			Msg("Password hashing failed")
@@ -62,14 +62,14 @@ func (s *AuthService) Register(ctx context.Context, login, password string) (*en
 	}
 
 	if err = s.userRepo.Create(ctx, user); err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("login", login).
 			Msg("Failed to create user in database")
 		return nil, err
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", fmt.Sprintf("%d", user.ID)).
 		Str("login", login).
 		Msg("User successfully registered")
@@ -77,26 +77,32 @@ func (s *AuthService) Register(ctx context.Context, login, password string) (*en
 }
 
 func (s *AuthService) Login(ctx context.Context, login, password string) (*entity.User, error) {
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "Login").
 		Str("login", login).
 		Msg("Attempting user login")
 	user, err := s.userRepo.FindByLogin(ctx, login)
 	if err != nil {
-		logger.Error().
+		if errors.Is(err, repository.ErrRocordNotFound) {
+			logger.FromContext(ctx).Warn().
+				Str("login", login).
+				Msg("Unknown login provided")
+			return nil, ErrInvalidCredentials
+		}
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("login", login).
 			Msg("Database error during login")
 		return nil, err
 	}
 	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		logger.Warn().
+		logger.FromContext(ctx).Warn().
 			Str("user_id", fmt.Sprintf("%d", user.ID)).
 			Str("login", login).
 			Msg("Invalid password provided")
 		return nil, ErrInvalidCredentials
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", fmt.Sprintf("%d", user.ID)).
 		Str("login", login).
 		Msg("User successfully authenticated")
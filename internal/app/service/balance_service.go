@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
 	"gophemart/internal/app/entity"
 	"gophemart/internal/app/repository"
+	"gophemart/internal/metrics"
 	"gophemart/internal/repository/postgresql"
+	"gophemart/internal/tracing"
 	"gophemart/pkg/logger"
 	"math"
 	"time"
@@ -16,6 +19,7 @@ type BalanceService struct {
 	userRepo       repository.UserRepository
 	orderRepo      repository.OrderRepository
 	withdrawalRepo repository.WithdrawalRepository
+	cancelWindow   time.Duration
 }
 
 var (
@@ -23,29 +27,40 @@ var (
 	ErrInvalidOrderNumber = errors.New("invalid order number")
 	ErrInvalidOrder       = errors.New("invalid order")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidAmount      = errors.New("invalid withdrawal amount")
+
+	ErrWithdrawalNotFound        = errors.New("withdrawal not found")
+	ErrWithdrawalAlreadyReversed = errors.New("withdrawal already reversed")
+	ErrCancellationWindowExpired = errors.New("withdrawal cancellation window expired")
 )
 
+const userCancellationReason = "cancelled by user"
+
 func NewBalanceService(
 	userRepo repository.UserRepository,
 	orderRepo repository.OrderRepository,
-	withdrawalRepo repository.WithdrawalRepository) *BalanceService {
+	withdrawalRepo repository.WithdrawalRepository,
+	cancelWindow time.Duration) *BalanceService {
 	return &BalanceService{
 		userRepo:       userRepo,
 		orderRepo:      orderRepo,
 		withdrawalRepo: withdrawalRepo,
+		cancelWindow:   cancelWindow,
 	}
 }
 
 func (s *BalanceService) GetWithdrawals(
 	ctx context.Context,
 	userID string,
-) ([]entity.Withdrawal, error) {
-	logger.Info().
+) (_ []entity.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.GetWithdrawals", attribute.String("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Info().
 		Str("method", "GetWithdrawals").
 		Str("userID", userID)
 	withdrawals, err := s.orderRepo.GetWithdrawalsByUser(ctx, userID)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("userID", userID).
 			Msg("failed to get withdrawals")
@@ -54,8 +69,10 @@ func (s *BalanceService) GetWithdrawals(
 
 	return withdrawals, nil
 }
-func (s *BalanceService) GetBalance(ctx context.Context, userID string) (*entity.User, error) {
-	logger.Info().
+func (s *BalanceService) GetBalance(ctx context.Context, userID string) (_ *entity.User, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.GetBalance", attribute.String("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Info().
 		Str("method", "GetBalance").
 		Str("user_id", userID).
 		Msg("Fetching user balance")
@@ -63,18 +80,18 @@ func (s *BalanceService) GetBalance(ctx context.Context, userID string) (*entity
 	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
 		if errors.Is(err, postgresql.ErrNotFound) {
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("user_id", userID).
 				Msg("User not found when fetching balance")
 			return nil, ErrUserNotFound
 		}
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Msg("Database error when fetching balance")
 		return nil, fmt.Errorf("database error: %w", err)
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", userID).
 		Float64("current_balance", user.CurrentBalance).
 		Float64("withdrawn", user.Withdrawn).
@@ -87,69 +104,139 @@ func (s *BalanceService) GetWithdtawals(ctx context.Context, userID string) ([]e
 	return s.withdrawalRepo.FindByUserID(ctx, userID)
 }
 
-func (s *BalanceService) Withdraw(ctx context.Context, userID, orderNumber string, sum float64) error {
-	logger.Info().
+func (s *BalanceService) Withdraw(ctx context.Context, userID, orderNumber string, sum float64) (err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.Withdraw",
+		attribute.String("user_id", userID),
+		attribute.String("order_number", orderNumber),
+		attribute.Float64("sum", sum),
+	)
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Info().
 		Str("method", "Withdraw").
 		Str("user_id", userID).
 		Str("order_number", orderNumber).
 		Float64("sum", sum).
 		Msg("Processing withdrawal request")
 
-	user, err := s.userRepo.FindByID(ctx, userID)
-	if err != nil {
-		logger.Error().
-			Err(err).
+	if !isValidAmount(sum) {
+		logger.FromContext(ctx).Warn().
 			Str("user_id", userID).
-			Str("method", "Withdraw").
-			Msg("Failed to find user")
-		return fmt.Errorf("failed to find user: %w", err)
-	}
-
-	if user.CurrentBalance < sum {
-		logger.Warn().
-			Str("user_id", userID).
-			Float64("current_balance", user.CurrentBalance).
-			Float64("requested_sum", sum).
-			Msg("Insufficient funds for withdrawal")
-		return ErrInsufficientFunds
-	}
-
-	newBalance := math.Round((user.CurrentBalance-sum)*100) / 100
-	newWithdrawn := math.Round((user.Withdrawn+sum)*100) / 100
-
-	err = s.userRepo.UpdateBalance(ctx, userID, newBalance, newWithdrawn)
-	if err != nil {
-		logger.Error().
-			Err(err).
-			Str("user_id", userID).
-			Str("order", orderNumber).
+			Str("order_number", orderNumber).
 			Float64("sum", sum).
-			Msg("Failed to update user balance")
-		return fmt.Errorf("failed to update balance: %w", err)
+			Msg("Invalid withdrawal amount")
+		return ErrInvalidAmount
 	}
 
 	withdrawal := &entity.Withdrawal{
 		UserID:      userID,
 		OrderNumber: orderNumber,
 		Sum:         sum,
+		Status:      entity.WithdrawalCompleted,
 		ProcessedAt: time.Now().UTC(),
 	}
 
-	err = s.orderRepo.CreateWithdrawal(ctx, withdrawal)
+	err = s.withdrawalRepo.Withdraw(ctx, withdrawal)
 	if err != nil {
-		logger.Error().
+		switch {
+		case errors.Is(err, postgresql.ErrInsufficientBalance):
+			logger.FromContext(ctx).Warn().
+				Str("user_id", userID).
+				Str("order_number", orderNumber).
+				Float64("requested_sum", sum).
+				Msg("Insufficient funds for withdrawal")
+			return ErrInsufficientFunds
+		case errors.Is(err, postgresql.ErrDuplicateWithdrawal):
+			logger.FromContext(ctx).Warn().
+				Str("user_id", userID).
+				Str("order_number", orderNumber).
+				Msg("Withdrawal for this order already exists")
+			return ErrDuplicateOrder
+		case errors.Is(err, postgresql.ErrNotFound):
+			return ErrUserNotFound
+		}
+
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Str("order", orderNumber).
 			Float64("sum", sum).
-			Msg("Failed to create withdrawal record")
-		return fmt.Errorf("failed to create withdrawal: %w", err)
+			Msg("Failed to process withdrawal")
+		return fmt.Errorf("failed to withdraw: %w", err)
 	}
-	logger.Info().
+	metrics.AddPointsWithdrawn(sum)
+	logger.FromContext(ctx).Info().
 		Str("user_id", userID).
 		Str("order_number", orderNumber).
 		Float64("sum", sum).
-		Float64("new_balance", newBalance).
 		Msg("Withdrawal processed successfully")
 	return nil
 }
+
+// CancelWithdrawal lets a user undo their own withdrawal within the cancellation window.
+func (s *BalanceService) CancelWithdrawal(ctx context.Context, userID, orderNumber string) (_ *entity.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.CancelWithdrawal", attribute.String("user_id", userID), attribute.String("order_number", orderNumber))
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Info().
+		Str("method", "CancelWithdrawal").
+		Str("user_id", userID).
+		Str("order_number", orderNumber).
+		Msg("Processing withdrawal cancellation")
+
+	processedAfter := time.Now().UTC().Add(-s.cancelWindow)
+	return s.reverse(ctx, userID, orderNumber, userCancellationReason, processedAfter)
+}
+
+// ReverseWithdrawal undoes any withdrawal regardless of owner or age.
+func (s *BalanceService) ReverseWithdrawal(ctx context.Context, orderNumber, reason string) (_ *entity.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceService.ReverseWithdrawal", attribute.String("order_number", orderNumber))
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Info().
+		Str("method", "ReverseWithdrawal").
+		Str("order_number", orderNumber).
+		Str("reason", reason).
+		Msg("Processing withdrawal reversal")
+
+	return s.reverse(ctx, "", orderNumber, reason, time.Time{})
+}
+
+func (s *BalanceService) reverse(
+	ctx context.Context,
+	userID, orderNumber, reason string,
+	processedAfter time.Time,
+) (*entity.Withdrawal, error) {
+	withdrawal, err := s.withdrawalRepo.Reverse(ctx, userID, orderNumber, reason, processedAfter)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresql.ErrNotFound):
+			return nil, ErrWithdrawalNotFound
+		case errors.Is(err, postgresql.ErrWithdrawalReversed):
+			return nil, ErrWithdrawalAlreadyReversed
+		case errors.Is(err, postgresql.ErrReversalWindowClosed):
+			return nil, ErrCancellationWindowExpired
+		}
+
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("user_id", userID).
+			Str("order_number", orderNumber).
+			Msg("Failed to reverse withdrawal")
+		return nil, fmt.Errorf("failed to reverse withdrawal: %w", err)
+	}
+
+	logger.FromContext(ctx).Info().
+		Str("user_id", withdrawal.UserID).
+		Str("order_number", orderNumber).
+		Float64("sum", withdrawal.Sum).
+		Str("reason", reason).
+		Msg("Withdrawal reversed successfully")
+	return withdrawal, nil
+}
+
+// isValidAmount reports whether sum is positive and has at most two decimal places.
+func isValidAmount(sum float64) bool {
+	if sum <= 0 || math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return false
+	}
+	cents := sum * 100
+	return math.Abs(cents-math.Round(cents)) < 1e-6
+}
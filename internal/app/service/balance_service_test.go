@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidAmount(t *testing.T) {
+	tests := []struct {
+		sum   float64
+		valid bool
+	}{
+		{sum: 751, valid: true},
+		{sum: 0.01, valid: true},
+		{sum: 19.99, valid: true},
+		{sum: 1234567.89, valid: true},
+		{sum: 0, valid: false},
+		{sum: -5, valid: false},
+		{sum: 0.001, valid: false},
+		{sum: 10.555, valid: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, isValidAmount(tt.sum), "sum %v", tt.sum)
+	}
+}
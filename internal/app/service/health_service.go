@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// HealthCheck probes one dependency of the service; a nil error means it is
+// usable. A failing Optional check only degrades the replica: it can still
+// serve most requests, and taking every replica out of rotation because of a
+// shared dependency would not help.
+type HealthCheck struct {
+	Name     string
+	Check    func(ctx context.Context) error
+	Optional bool
+}
+
+// ComponentHealth is the outcome of one HealthCheck.
+type ComponentHealth struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+	Optional bool
+}
+
+// Readiness reports whether the replica should receive traffic. Degraded is
+// set when only optional checks fail.
+type Readiness struct {
+	Ready        bool
+	Degraded     bool
+	ShuttingDown bool
+	Components   []ComponentHealth
+}
+
+// HealthService answers liveness and readiness probes. The replica is ready
+// while every required check passes and it is not shutting down.
+type HealthService struct {
+	checks       []HealthCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+func NewHealthService(timeout time.Duration, checks ...HealthCheck) *HealthService {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	return &HealthService{checks: checks, timeout: timeout}
+}
+
+// SetShuttingDown makes the replica report itself not ready, so that load
+// balancers stop sending requests before the server stops.
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// Readiness runs every check concurrently, each bounded by the check
+// timeout. Components are reported in the order the checks were given.
+func (s *HealthService) Readiness(ctx context.Context) Readiness {
+	components := make([]ComponentHealth, len(s.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			components[i] = s.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	shuttingDown := s.shuttingDown.Load()
+	ready := !shuttingDown
+	degraded := false
+	for _, c := range components {
+		switch {
+		case c.Err == nil:
+		case c.Optional:
+			degraded = true
+		default:
+			ready = false
+		}
+	}
+	return Readiness{Ready: ready, Degraded: degraded, ShuttingDown: shuttingDown, Components: components}
+}
+
+func (s *HealthService) run(ctx context.Context, check HealthCheck) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	return ComponentHealth{Name: check.Name, Err: err, Duration: time.Since(start), Optional: check.Optional}
+}
+
+// WorkerHeartbeat is implemented by background workers that record when
+// they last completed a cycle.
+type WorkerHeartbeat interface {
+	LastCycleAt() time.Time
+}
+
+// WorkerCheck fails when worker has not completed a cycle within maxAge.
+func WorkerCheck(name string, worker WorkerHeartbeat, maxAge time.Duration) HealthCheck {
+	return HealthCheck{
+		Name: name,
+		Check: func(context.Context) error {
+			last := worker.LastCycleAt()
+			if last.IsZero() {
+				return errors.New("no cycle completed yet")
+			}
+			if age := time.Since(last); age > maxAge {
+				return fmt.Errorf("last cycle completed %s ago", age.Round(time.Second))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubHeartbeat struct {
+	last time.Time
+}
+
+func (h stubHeartbeat) LastCycleAt() time.Time {
+	return h.last
+}
+
+func passing(name string) HealthCheck {
+	return HealthCheck{Name: name, Check: func(context.Context) error { return nil }}
+}
+
+func TestHealthService_ReadyWhenEveryCheckPasses(t *testing.T) {
+	s := NewHealthService(time.Second, passing("database"), passing("accrual"))
+
+	readiness := s.Readiness(context.Background())
+
+	assert.True(t, readiness.Ready)
+	require.Len(t, readiness.Components, 2)
+	assert.Equal(t, "database", readiness.Components[0].Name)
+	assert.Equal(t, "accrual", readiness.Components[1].Name)
+	assert.NoError(t, readiness.Components[0].Err)
+}
+
+func TestHealthService_NotReadyWhenACheckFails(t *testing.T) {
+	s := NewHealthService(time.Second,
+		passing("database"),
+		HealthCheck{Name: "accrual", Check: func(context.Context) error { return errors.New("connection refused") }},
+	)
+
+	readiness := s.Readiness(context.Background())
+
+	assert.False(t, readiness.Ready)
+	assert.False(t, readiness.ShuttingDown)
+	assert.NoError(t, readiness.Components[0].Err)
+	assert.EqualError(t, readiness.Components[1].Err, "connection refused")
+}
+
+func TestHealthService_DegradedWhenAnOptionalCheckFails(t *testing.T) {
+	s := NewHealthService(time.Second,
+		passing("database"),
+		HealthCheck{Name: "accrual", Check: func(context.Context) error { return errors.New("connection refused") }, Optional: true},
+	)
+
+	readiness := s.Readiness(context.Background())
+
+	assert.True(t, readiness.Ready)
+	assert.True(t, readiness.Degraded)
+	assert.True(t, readiness.Components[1].Optional)
+	assert.EqualError(t, readiness.Components[1].Err, "connection refused")
+}
+
+func TestHealthService_BoundsSlowChecks(t *testing.T) {
+	s := NewHealthService(20*time.Millisecond, HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	start := time.Now()
+	readiness := s.Readiness(context.Background())
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, readiness.Ready)
+	assert.ErrorIs(t, readiness.Components[0].Err, context.DeadlineExceeded)
+}
+
+func TestHealthService_NotReadyWhileShuttingDown(t *testing.T) {
+	s := NewHealthService(time.Second, passing("database"))
+	s.SetShuttingDown()
+
+	readiness := s.Readiness(context.Background())
+
+	assert.False(t, readiness.Ready)
+	assert.True(t, readiness.ShuttingDown)
+	assert.NoError(t, readiness.Components[0].Err)
+}
+
+func TestWorkerCheck(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Error(t, WorkerCheck("worker", stubHeartbeat{}, time.Minute).Check(ctx), "no cycle yet")
+	assert.NoError(t, WorkerCheck("worker", stubHeartbeat{last: time.Now()}, time.Minute).Check(ctx))
+	assert.ErrorContains(t,
+		WorkerCheck("worker", stubHeartbeat{last: time.Now().Add(-2 * time.Minute)}, time.Minute).Check(ctx),
+		"last cycle completed 2m0s ago")
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/repository/postgresql"
+	"gophemart/pkg/logger"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+)
+
+const (
+	idempotencyPollInterval  = 50 * time.Millisecond
+	idempotencyCleanupPeriod = time.Hour
+)
+
+type IdempotencyService struct {
+	repo        repository.IdempotencyRepository
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+// IdempotentResponse is the stored outcome of the first request made with a key.
+type IdempotentResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyLock is held by the request that executes the operation for a key.
+type IdempotencyLock struct {
+	id uint
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository, ttl, lockTimeout time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		repo:        repo,
+		ttl:         ttl,
+		lockTimeout: lockTimeout,
+	}
+}
+
+// Fingerprint identifies the request payload a key was first used with.
+func Fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin reserves key for userID. If the caller obtains the lock it must run the
+// operation and call Complete or Release. If the key was already completed the
+// stored response is returned instead. While another request holds the key,
+// Begin blocks until it completes or ctx is done.
+func (s *IdempotencyService) Begin(
+	ctx context.Context,
+	userID, key, fingerprint string,
+) (*IdempotencyLock, *IdempotentResponse, error) {
+	for {
+		now := time.Now().UTC()
+		record := &entity.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: fingerprint,
+			ExpiresAt:   now.Add(s.ttl),
+		}
+
+		err := s.repo.Create(ctx, record)
+		if err == nil {
+			logger.FromContext(ctx).Debug().
+				Str("user_id", userID).
+				Str("idempotency_key", key).
+				Msg("Idempotency key reserved")
+			return &IdempotencyLock{id: record.ID}, nil, nil
+		}
+		if !errors.Is(err, postgresql.ErrDuplicateKey) {
+			return nil, nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		existing, err := s.repo.Find(ctx, userID, key)
+		if errors.Is(err, postgresql.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find idempotency key: %w", err)
+		}
+
+		// An incomplete record is only taken over once its holder stopped
+		// refreshing it, see KeepAlive.
+		if existing.ExpiresAt.Before(now) || (!existing.Completed && existing.UpdatedAt.Add(s.lockTimeout).Before(now)) {
+			logger.FromContext(ctx).Warn().
+				Str("user_id", userID).
+				Str("idempotency_key", key).
+				Bool("completed", existing.Completed).
+				Msg("Discarding expired idempotency key")
+			if err := s.repo.Delete(ctx, existing.ID); err != nil {
+				return nil, nil, fmt.Errorf("failed to delete expired idempotency key: %w", err)
+			}
+			continue
+		}
+
+		if existing.RequestHash != fingerprint {
+			logger.FromContext(ctx).Warn().
+				Str("user_id", userID).
+				Str("idempotency_key", key).
+				Msg("Idempotency key reused with a different request")
+			return nil, nil, ErrIdempotencyKeyReused
+		}
+
+		if existing.Completed {
+			logger.FromContext(ctx).Info().
+				Str("user_id", userID).
+				Str("idempotency_key", key).
+				Int("status_code", existing.StatusCode).
+				Msg("Replaying stored idempotent response")
+			return nil, &IdempotentResponse{
+				StatusCode:  existing.StatusCode,
+				ContentType: existing.ContentType,
+				Body:        existing.Body,
+			}, nil
+		}
+
+		logger.FromContext(ctx).Debug().
+			Str("user_id", userID).
+			Str("idempotency_key", key).
+			Msg("Waiting for in-flight request with the same idempotency key")
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+// KeepAlive refreshes lock until the returned function is called, so that a
+// request running longer than the lock timeout is not mistaken for an
+// abandoned one and executed a second time.
+func (s *IdempotencyService) KeepAlive(ctx context.Context, lock *IdempotencyLock) (stop func()) {
+	interval := s.lockTimeout / 3
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.repo.Touch(ctx, lock.id); err != nil {
+					logger.FromContext(ctx).Warn().
+						Err(err).
+						Uint("idempotency_record_id", lock.id).
+						Msg("Failed to extend idempotency key lock")
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Run deletes expired keys and their stored responses until ctx is
+// cancelled. Begin only discards an expired key when it is used again.
+func (s *IdempotencyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyCleanupPeriod)
+	defer ticker.Stop()
+
+	for {
+		s.cleanup(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *IdempotencyService) cleanup(ctx context.Context) {
+	deleted, err := s.repo.DeleteExpiredBefore(ctx, time.Now().UTC())
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Failed to delete expired idempotency keys")
+		return
+	}
+	if deleted > 0 {
+		logger.FromContext(ctx).Debug().Int64("deleted", deleted).Msg("Deleted expired idempotency keys")
+	}
+}
+
+// Complete stores the response for the key held by lock.
+func (s *IdempotencyService) Complete(ctx context.Context, lock *IdempotencyLock, resp IdempotentResponse) error {
+	if err := s.repo.Complete(ctx, lock.id, resp.StatusCode, resp.ContentType, resp.Body); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release drops the reservation without storing a response so the request can be retried.
+func (s *IdempotencyService) Release(ctx context.Context, lock *IdempotencyLock) error {
+	if err := s.repo.Delete(ctx, lock.id); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -4,18 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
 	"gophemart/internal/app/entity"
 	"gophemart/internal/app/repository"
 	"gophemart/internal/repository/postgresql"
-	"gophemart/internal/transport/accrual"
+	"gophemart/internal/tracing"
 	"gophemart/pkg/logger"
 	"time"
 )
 
 type OrderService struct {
-	orderRepo     repository.OrderRepository
-	userRepo      repository.UserRepository
-	accrualClient *accrual.Client
+	orderRepo repository.OrderRepository
+	userRepo  repository.UserRepository
+	notifiers []OrderNotifier
+}
+
+// OrderNotifier is told about every newly uploaded order so that it is
+// processed without waiting for the next polling sweep.
+type OrderNotifier interface {
+	OrderUploaded(ctx context.Context, number string)
 }
 
 var (
@@ -24,18 +31,27 @@ var (
 	ErrOrderBelongsToAnotherUser = errors.New("order belongs to another user")
 	ErrOrderAlreadyExists        = errors.New("order already exists")
 	ErrDuplicateOrder            = errors.New("order already exists")
+	ErrParkedOrderNotFound       = errors.New("parked order not found")
 )
 
-func NewOrderService(orderRepo repository.OrderRepository, userRepo repository.UserRepository, accrualClient *accrual.Client) *OrderService {
+func NewOrderService(
+	orderRepo repository.OrderRepository,
+	userRepo repository.UserRepository,
+	notifiers ...OrderNotifier,
+) *OrderService {
 	return &OrderService{
-		orderRepo:     orderRepo,
-		userRepo:      userRepo,
-		accrualClient: accrualClient,
+		orderRepo: orderRepo,
+		userRepo:  userRepo,
+		notifiers: notifiers,
 	}
 }
 
-func (s *OrderService) UploadOrder(ctx context.Context, userID string, number string) error {
-	logger.Info().
+// UploadOrder stores a new order. Goods are optional; in push mode the order
+// processor forwards them to the accrual system.
+func (s *OrderService) UploadOrder(ctx context.Context, userID string, number string, goods []entity.Good) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.UploadOrder", attribute.String("user_id", userID), attribute.String("order_number", number))
+	defer func() { tracing.End(span, err) }()
+	logger.FromContext(ctx).Info().
 		Str("method", "UploadOrder").
 		Str("user_id", userID).
 		Str("order_number", number).
@@ -43,7 +59,7 @@ func (s *OrderService) UploadOrder(ctx context.Context, userID string, number st
 
 	existingOrder, err := s.orderRepo.FindByNumber(ctx, number)
 	if err != nil && !errors.Is(err, postgresql.ErrNotFound) {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Str("order_number", number).
@@ -53,13 +69,13 @@ func (s *OrderService) UploadOrder(ctx context.Context, userID string, number st
 
 	if existingOrder != nil {
 		if existingOrder.UserID == userID {
-			logger.Info().
+			logger.FromContext(ctx).Info().
 				Str("user_id", userID).
 				Str("order_number", number).
 				Msg("Order already uploaded by same user")
 			return ErrOrderAlreadyUploaded
 		}
-		logger.Warn().
+		logger.FromContext(ctx).Warn().
 			Str("user_id", userID).
 			Str("order_number", number).
 			Str("order_owner", existingOrder.UserID).
@@ -67,40 +83,48 @@ func (s *OrderService) UploadOrder(ctx context.Context, userID string, number st
 		return ErrOrderBelongsToAnotherUser
 	}
 
+	now := time.Now()
 	newOrder := &entity.Order{
-		Number:    number,
-		UserID:    userID,
-		Status:    "NEW",
-		CreatedAt: time.Now(),
+		Number:     number,
+		UserID:     userID,
+		Status:     entity.OrderNew,
+		Goods:      goods,
+		UploadedAt: now,
+		CreatedAt:  now,
 	}
 
 	if err := s.orderRepo.Create(ctx, newOrder); err != nil {
 		if errors.Is(err, postgresql.ErrDuplicateKey) {
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("user_id", userID).
 				Str("order_number", number).
 				Msg("Order already exists (race condition detected)")
-			return s.UploadOrder(ctx, userID, number)
+			return s.UploadOrder(ctx, userID, number, goods)
 		}
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Str("order_number", number).
 			Msg("Failed to create order in database")
 		return fmt.Errorf("failed to create order: %w", err)
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", userID).
 		Str("order_number", number).
 		Str("order_status", "NEW").
 		Msg("Order successfully uploaded")
+	for _, n := range s.notifiers {
+		n.OrderUploaded(ctx, number)
+	}
 	return nil
 
 }
 
-func (s *OrderService) GetUserOrders(ctx context.Context, userID string) ([]entity.Order, error) {
+func (s *OrderService) GetUserOrders(ctx context.Context, userID string) (_ []entity.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetUserOrders", attribute.String("user_id", userID))
+	defer func() { tracing.End(span, err) }()
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "GetUserOrders").
 		Str("user_id", userID).
 		Msg("Fetching user orders")
@@ -108,13 +132,13 @@ func (s *OrderService) GetUserOrders(ctx context.Context, userID string) ([]enti
 	orders, err := s.orderRepo.FindByUserID(ctx, userID)
 	if err != nil {
 		if errors.Is(err, repository.ErrRocordNotFound) {
-			logger.Info().
+			logger.FromContext(ctx).Info().
 				Str("user_id", userID).
 				Msg("No orders found for user")
 			return []entity.Order{}, nil
 		}
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Str("method", "GetUserOrders").
@@ -123,10 +147,48 @@ func (s *OrderService) GetUserOrders(ctx context.Context, userID string) ([]enti
 		return nil, fmt.Errorf("failed to get user orders: %w", err)
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", userID).
 		Int("order_count", len(orders)).
 		Msg("Successfully retrieved user orders")
 
 	return orders, nil
 }
+
+// ListParkedOrders returns orders the worker gave up on after too many failed attempts.
+func (s *OrderService) ListParkedOrders(ctx context.Context) (_ []entity.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.ListParkedOrders")
+	defer func() { tracing.End(span, err) }()
+	orders, err := s.orderRepo.FindParked(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "ListParkedOrders").
+			Msg("Failed to retrieve parked orders")
+		return nil, fmt.Errorf("failed to get parked orders: %w", err)
+	}
+	return orders, nil
+}
+
+// RequeueOrder returns a parked order to the worker with a fresh attempt budget.
+func (s *OrderService) RequeueOrder(ctx context.Context, number string) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.RequeueOrder", attribute.String("order_number", number))
+	defer func() { tracing.End(span, err) }()
+	if err := s.orderRepo.Requeue(ctx, number); err != nil {
+		if errors.Is(err, postgresql.ErrNotFound) {
+			return ErrParkedOrderNotFound
+		}
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "RequeueOrder").
+			Str("order_number", number).
+			Msg("Failed to requeue order")
+		return fmt.Errorf("failed to requeue order: %w", err)
+	}
+
+	logger.FromContext(ctx).Info().
+		Str("method", "RequeueOrder").
+		Str("order_number", number).
+		Msg("Parked order requeued")
+	return nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/repository/postgresql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubOrderRepository struct {
+	repository.OrderRepository
+	orders map[string]entity.Order
+}
+
+func (r *stubOrderRepository) FindByNumber(_ context.Context, number string) (*entity.Order, error) {
+	o, ok := r.orders[number]
+	if !ok {
+		return nil, postgresql.ErrNotFound
+	}
+	return &o, nil
+}
+
+func (r *stubOrderRepository) Create(_ context.Context, order *entity.Order) error {
+	r.orders[order.Number] = *order
+	return nil
+}
+
+type recordingNotifier struct {
+	numbers []string
+}
+
+func (n *recordingNotifier) OrderUploaded(_ context.Context, number string) {
+	n.numbers = append(n.numbers, number)
+}
+
+func TestOrderService_UploadOrderNotifies(t *testing.T) {
+	local, replicas := &recordingNotifier{}, &recordingNotifier{}
+	repo := &stubOrderRepository{orders: make(map[string]entity.Order)}
+	s := NewOrderService(repo, nil, local, replicas)
+
+	require.NoError(t, s.UploadOrder(context.Background(), "1", "12345678903", nil))
+	assert.Equal(t, []string{"12345678903"}, local.numbers)
+	assert.Equal(t, []string{"12345678903"}, replicas.numbers)
+
+	err := s.UploadOrder(context.Background(), "1", "12345678903", nil)
+	require.ErrorIs(t, err, ErrOrderAlreadyUploaded)
+	assert.Len(t, local.numbers, 1, "a rejected upload must not wake the worker")
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/pkg/logger"
+	"sync"
+	"time"
+)
+
+const (
+	replayLimit           = 500
+	streamCleanupPeriod   = time.Hour
+	defaultStreamBuffer   = 64
+	defaultEventRetention = 24 * time.Hour
+)
+
+// Subscription receives the live events of one user. The channel is closed
+// when the subscriber falls too far behind or is unsubscribed.
+type Subscription struct {
+	userID string
+	events chan entity.UserEvent
+}
+
+func (s *Subscription) Events() <-chan entity.UserEvent {
+	return s.events
+}
+
+// StreamService fans user events out to the stream clients connected to this
+// replica. Events are committed by the repositories and announced to every
+// replica through Postgres notifications, which are fed into Notify.
+type StreamService struct {
+	eventRepo repository.UserEventRepository
+	buffer    int
+	retention time.Duration
+
+	mu          sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+func NewStreamService(eventRepo repository.UserEventRepository, buffer int, retention time.Duration) *StreamService {
+	if buffer <= 0 {
+		buffer = defaultStreamBuffer
+	}
+	if retention <= 0 {
+		retention = defaultEventRetention
+	}
+	return &StreamService{
+		eventRepo:   eventRepo,
+		buffer:      buffer,
+		retention:   retention,
+		subscribers: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+func (s *StreamService) Subscribe(userID string) *Subscription {
+	sub := &Subscription{userID: userID, events: make(chan entity.UserEvent, s.buffer)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers[userID] == nil {
+		s.subscribers[userID] = make(map[*Subscription]struct{})
+	}
+	s.subscribers[userID][sub] = struct{}{}
+	return sub
+}
+
+func (s *StreamService) Unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(sub)
+}
+
+// remove must be called with s.mu held.
+func (s *StreamService) remove(sub *Subscription) {
+	subs, ok := s.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.events)
+	if len(subs) == 0 {
+		delete(s.subscribers, sub.userID)
+	}
+}
+
+// MissedEvents are the retained events a reconnecting client did not receive.
+type MissedEvents struct {
+	// Events are sent oldest first.
+	Events []entity.UserEvent
+	// Truncated is set instead of Events when more than replayLimit events
+	// were missed: the client has to reload its state and resume from
+	// LatestID.
+	Truncated bool
+	LatestID  uint
+}
+
+// Replay returns the user's events after afterID that are still retained.
+func (s *StreamService) Replay(ctx context.Context, userID string, afterID uint) (*MissedEvents, error) {
+	events, err := s.eventRepo.FindAfter(ctx, userID, afterID, replayLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user events: %w", err)
+	}
+	if len(events) <= replayLimit {
+		return &MissedEvents{Events: events}, nil
+	}
+
+	latest, err := s.eventRepo.LatestID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest user event: %w", err)
+	}
+	logger.FromContext(ctx).Info().
+		Str("user_id", userID).
+		Uint("after_id", afterID).
+		Uint("latest_id", latest).
+		Msg("Too many missed events to replay, resetting the stream")
+	return &MissedEvents{Truncated: true, LatestID: latest}, nil
+}
+
+// Notify delivers a committed event to the user's local subscribers. The
+// event is loaded only when somebody on this replica is listening.
+func (s *StreamService) Notify(ctx context.Context, userID string, eventID uint) {
+	s.mu.Lock()
+	listening := len(s.subscribers[userID]) > 0
+	s.mu.Unlock()
+	if !listening {
+		return
+	}
+
+	event, err := s.eventRepo.FindByID(ctx, eventID)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("user_id", userID).
+			Uint("event_id", eventID).
+			Msg("Failed to load user event")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers[userID] {
+		select {
+		case sub.events <- *event:
+		default:
+			logger.FromContext(ctx).Warn().
+				Str("user_id", userID).
+				Msg("Stream subscriber is too slow, disconnecting")
+			s.remove(sub)
+		}
+	}
+}
+
+// Run deletes events older than the retention period until ctx is cancelled.
+func (s *StreamService) Run(ctx context.Context) {
+	ticker := time.NewTicker(streamCleanupPeriod)
+	defer ticker.Stop()
+
+	for {
+		s.cleanup(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *StreamService) cleanup(ctx context.Context) {
+	deleted, err := s.eventRepo.DeleteBefore(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Failed to delete expired user events")
+		return
+	}
+	if deleted > 0 {
+		logger.FromContext(ctx).Debug().Int64("deleted", deleted).Msg("Deleted expired user events")
+	}
+}
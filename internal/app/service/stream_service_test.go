@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/repository/postgresql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubUserEventRepository struct {
+	repository.UserEventRepository
+	events map[uint]entity.UserEvent
+	loads  int
+}
+
+func (r *stubUserEventRepository) FindByID(_ context.Context, id uint) (*entity.UserEvent, error) {
+	r.loads++
+	e, ok := r.events[id]
+	if !ok {
+		return nil, postgresql.ErrNotFound
+	}
+	return &e, nil
+}
+
+func TestStreamService_NotifyFansOutToUserSubscribers(t *testing.T) {
+	repo := &stubUserEventRepository{events: map[uint]entity.UserEvent{
+		1: {ID: 1, UserID: "1", Type: entity.UserEventOrder},
+	}}
+	s := NewStreamService(repo, 4, time.Hour)
+
+	first := s.Subscribe("1")
+	second := s.Subscribe("1")
+	other := s.Subscribe("2")
+	defer s.Unsubscribe(first)
+	defer s.Unsubscribe(second)
+	defer s.Unsubscribe(other)
+
+	s.Notify(context.Background(), "1", 1)
+
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case e := <-sub.Events():
+			assert.Equal(t, uint(1), e.ID)
+		default:
+			t.Fatal("event not delivered")
+		}
+	}
+	assert.Empty(t, other.Events())
+
+	s.Notify(context.Background(), "3", 1)
+	assert.Equal(t, 1, repo.loads, "events of users without subscribers are not loaded")
+}
+
+func TestStreamService_DropsSlowSubscriber(t *testing.T) {
+	repo := &stubUserEventRepository{events: map[uint]entity.UserEvent{
+		1: {ID: 1, UserID: "1"},
+		2: {ID: 2, UserID: "1"},
+	}}
+	s := NewStreamService(repo, 1, time.Hour)
+	sub := s.Subscribe("1")
+
+	s.Notify(context.Background(), "1", 1)
+	s.Notify(context.Background(), "1", 2)
+
+	e, ok := <-sub.Events()
+	require.True(t, ok)
+	assert.Equal(t, uint(1), e.ID)
+	_, ok = <-sub.Events()
+	assert.False(t, ok, "subscriber that fell behind is disconnected")
+
+	s.Unsubscribe(sub)
+}
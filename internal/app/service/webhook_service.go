@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/repository/postgresql"
+	"gophemart/pkg/logger"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxWebhooksPerUser = 10
+	recentDeliveries   = 50
+	minSecretLength    = 16
+	maxSecretLength    = 255
+)
+
+var (
+	ErrInvalidWebhookURL    = errors.New("webhook url must be an absolute http(s) url")
+	ErrInvalidWebhookSecret = errors.New("webhook secret must be 16 to 255 characters long")
+	ErrTooManyWebhooks      = errors.New("webhook limit reached")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+)
+
+type WebhookService struct {
+	webhookRepo repository.WebhookRepository
+}
+
+func NewWebhookService(webhookRepo repository.WebhookRepository) *WebhookService {
+	return &WebhookService{webhookRepo: webhookRepo}
+}
+
+// Register adds a webhook for the user. An empty secret is replaced by a
+// random one; the caller must hand it to the user since it is not shown again.
+func (s *WebhookService) Register(ctx context.Context, userID, rawURL, secret string) (*entity.Webhook, error) {
+	if !isValidWebhookURL(rawURL) {
+		return nil, ErrInvalidWebhookURL
+	}
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	} else if len(secret) < minSecretLength || len(secret) > maxSecretLength {
+		return nil, ErrInvalidWebhookSecret
+	}
+
+	existing, err := s.webhookRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	if len(existing) >= maxWebhooksPerUser {
+		return nil, ErrTooManyWebhooks
+	}
+
+	webhook := &entity.Webhook{
+		UserID: userID,
+		URL:    rawURL,
+		Secret: secret,
+	}
+	if err := s.webhookRepo.Create(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	logger.FromContext(ctx).Info().
+		Str("method", "RegisterWebhook").
+		Str("user_id", userID).
+		Uint("webhook_id", webhook.ID).
+		Msg("Webhook registered")
+	return webhook, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, userID string) ([]entity.Webhook, error) {
+	webhooks, err := s.webhookRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) Delete(ctx context.Context, userID string, id uint) error {
+	if err := s.webhookRepo.Delete(ctx, userID, id); err != nil {
+		if errors.Is(err, postgresql.ErrNotFound) {
+			return ErrWebhookNotFound
+		}
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	logger.FromContext(ctx).Info().
+		Str("method", "DeleteWebhook").
+		Str("user_id", userID).
+		Uint("webhook_id", id).
+		Msg("Webhook deleted")
+	return nil
+}
+
+// RecentDeliveries returns the latest delivery attempts of the user's webhook, newest first.
+func (s *WebhookService) RecentDeliveries(ctx context.Context, userID string, id uint) ([]entity.WebhookDelivery, error) {
+	webhooks, err := s.webhookRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	owned := false
+	for _, w := range webhooks {
+		if w.ID == id {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries, err := s.webhookRepo.FindDeliveries(ctx, userID, id, recentDeliveries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func isValidWebhookURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
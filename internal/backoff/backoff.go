@@ -0,0 +1,29 @@
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Delay returns the pause after attempt failures in a row: base doubled per
+// attempt, capped at limit, with "equal jitter" so that callers failing
+// together do not retry in lockstep. jitter returns a fraction in [0, 1].
+func Delay(attempt int, base, limit time.Duration, jitter func() float64) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if limit > 0 && delay > limit {
+		delay = limit
+	}
+	half := delay / 2
+	return half + time.Duration(jitter()*float64(delay-half))
+}
+
+// Jitter is the default jitter source for Delay.
+func Jitter() float64 {
+	return rand.Float64()
+}
@@ -0,0 +1,38 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	base, limit := time.Second, 30*time.Second
+	noJitter := func() float64 { return 1 }
+	fullJitter := func() float64 { return 0 }
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 5, want: 16 * time.Second},
+		{attempt: 6, want: 30 * time.Second},
+		{attempt: 100, want: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Delay(tt.attempt, base, limit, noJitter), "attempt %d", tt.attempt)
+		assert.Equal(t, tt.want/2, Delay(tt.attempt, base, limit, fullJitter), "attempt %d", tt.attempt)
+	}
+}
+
+func TestDelay_JitterStaysInRange(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		d := Delay(3, time.Second, time.Minute, Jitter)
+		assert.GreaterOrEqual(t, d, 2*time.Second)
+		assert.LessOrEqual(t, d, 4*time.Second)
+	}
+}
@@ -16,11 +16,23 @@ const (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Auth     AuthConfig     `mapstructure:"auth"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Logger   LoggerConfig   `mapstructure:"logger"`
-	Accural  string         `mapstructure:"accural"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Logger      LoggerConfig      `mapstructure:"logger"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	Withdrawal  WithdrawalConfig  `mapstructure:"withdrawal"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	Worker      WorkerConfig      `mapstructure:"worker"`
+	Outbox      OutboxConfig      `mapstructure:"outbox"`
+	Webhooks    WebhookConfig     `mapstructure:"webhooks"`
+	Stream      StreamConfig      `mapstructure:"stream"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Health      HealthConfig      `mapstructure:"health"`
+	Accural     string            `mapstructure:"accural"`
+
+	AccrualClient AccrualClientConfig `mapstructure:"accrual_client"`
 }
 
 type ServerConfig struct {
@@ -57,9 +69,186 @@ type PostgresDatabaseConfig struct {
 type AuthConfig struct {
 	JWTSecret string `mapstructure:"jwt_secret"`
 }
+
+// LoggerConfig controls the application log. Level can be changed at runtime
+// through the admin API or by sending SIGHUP after editing the config file.
 type LoggerConfig struct {
-	Level  string `mapstructure:"level"`
-	format string `mapstructure:"format"`
+	Level string `mapstructure:"level"`
+	// Format is "text" for humans or "json".
+	Format string `mapstructure:"format"`
+	// Output is "stdout", "stderr" or "file" (File).
+	Output     string             `mapstructure:"output"`
+	File       LogFileConfig      `mapstructure:"file"`
+	WithCaller bool               `mapstructure:"with_caller"`
+	Sampling   LogSamplingConfig  `mapstructure:"sampling"`
+	Redaction  LogRedactionConfig `mapstructure:"redaction"`
+}
+
+// LogFileConfig rotates the log file once it reaches MaxSizeMB; 0 in
+// MaxBackups or MaxAgeDays keeps old files forever.
+type LogFileConfig struct {
+	Path       string `mapstructure:"path"`
+	MaxSizeMB  int    `mapstructure:"max_size_mb"`
+	MaxBackups int    `mapstructure:"max_backups"`
+	MaxAgeDays int    `mapstructure:"max_age_days"`
+	Compress   bool   `mapstructure:"compress"`
+}
+
+// LogRedactionConfig hides personal data in Fields: "mask" keeps a hint of
+// the value, "hash" replaces it with a hash keyed by HashKey and "off" writes
+// it as is, for local development. Passwords, tokens and secrets are never
+// logged, whatever the mode.
+type LogRedactionConfig struct {
+	Mode    string   `mapstructure:"mode"`
+	Fields  []string `mapstructure:"fields"`
+	HashKey string   `mapstructure:"hash_key"`
+}
+
+// LogSamplingConfig thins out debug logs: the first Burst events of every
+// Period are written, then one in Every. Every <= 1 disables sampling.
+type LogSamplingConfig struct {
+	Burst  uint32        `mapstructure:"burst"`
+	Period time.Duration `mapstructure:"period"`
+	Every  uint32        `mapstructure:"every"`
+}
+
+type IdempotencyConfig struct {
+	TTL         time.Duration `mapstructure:"ttl"`
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+}
+
+type WithdrawalConfig struct {
+	CancelWindow time.Duration `mapstructure:"cancel_window"`
+}
+
+// AdminConfig protects /api/admin routes; they are disabled while Token is empty.
+type AdminConfig struct {
+	Token string `mapstructure:"token"`
+}
+
+// WorkerConfig tunes the order processor. PollInterval is only a fallback
+// sweep: uploaded orders wake the worker at once.
+type WorkerConfig struct {
+	Workers       int           `mapstructure:"workers"`
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	OrderTimeout  time.Duration `mapstructure:"order_timeout"`
+	BatchSize     int           `mapstructure:"batch_size"`
+	LeaseDuration time.Duration `mapstructure:"lease_duration"`
+	// Orders without a usable accrual answer are re-polled with exponential
+	// backoff and parked after MaxAttempts consecutive failures.
+	RetryBaseDelay time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `mapstructure:"retry_max_delay"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+}
+
+// OutboxConfig selects where domain events are published: "none" keeps them
+// in the outbox table, "stdout", "file" (FilePath) or "webhook" (WebhookURL).
+type OutboxConfig struct {
+	Publisher      string        `mapstructure:"publisher"`
+	FilePath       string        `mapstructure:"file_path"`
+	WebhookURL     string        `mapstructure:"webhook_url"`
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	BatchSize      int           `mapstructure:"batch_size"`
+	PublishTimeout time.Duration `mapstructure:"publish_timeout"`
+	RetryBaseDelay time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `mapstructure:"retry_max_delay"`
+	// Retention is how long published events are kept; zero keeps them
+	// forever.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// WebhookConfig tunes delivery of user webhooks.
+type WebhookConfig struct {
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	BatchSize      int           `mapstructure:"batch_size"`
+	Concurrency    int           `mapstructure:"concurrency"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	RetryBaseDelay time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `mapstructure:"retry_max_delay"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	// Retention is how long delivered and failed deliveries are kept; zero
+	// keeps them forever.
+	Retention time.Duration `mapstructure:"retention"`
+	// AllowPrivateNetworks lets webhooks target loopback, private and
+	// link-local addresses; for local development only.
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+// StreamConfig tunes the SSE stream of order and balance updates.
+type StreamConfig struct {
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// Retention is how long events stay available for Last-Event-ID resume.
+	Retention time.Duration `mapstructure:"retention"`
+	// Buffer is the number of undelivered events a client may lag behind
+	// before it is disconnected.
+	Buffer int `mapstructure:"buffer"`
+}
+
+// MetricsConfig controls the Prometheus endpoint.
+type MetricsConfig struct {
+	// Path serves metrics outside /api; empty disables the endpoint.
+	Path string `mapstructure:"path"`
+	// Address serves metrics on a separate listener, meant to be reachable
+	// only from the internal network. When empty, metrics are served on the
+	// public listener behind the admin token.
+	Address string `mapstructure:"address"`
+}
+
+// TracingConfig controls OpenTelemetry tracing.
+type TracingConfig struct {
+	// Exporter is "none", "stdout" for local debugging or "otlp" to send
+	// spans over OTLP/HTTP to Endpoint.
+	Exporter    string `mapstructure:"exporter"`
+	Endpoint    string `mapstructure:"endpoint"`
+	Insecure    bool   `mapstructure:"insecure"`
+	ServiceName string `mapstructure:"service_name"`
+	// SampleRatio is the share of new traces recorded; incoming requests
+	// follow the caller's decision.
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// HealthConfig tunes the /readyz probe.
+type HealthConfig struct {
+	// CheckTimeout bounds each component check.
+	CheckTimeout time.Duration `mapstructure:"check_timeout"`
+	// WorkerMaxAge is how long the order processor may go without completing
+	// a cycle. It is raised to the worker lease plus worker.poll_interval, as
+	// a cycle may take the whole lease.
+	WorkerMaxAge time.Duration `mapstructure:"worker_max_age"`
+	// ShutdownDelay keeps serving requests for a while after /readyz starts
+	// failing on shutdown, until load balancers stop sending new ones.
+	ShutdownDelay time.Duration `mapstructure:"shutdown_delay"`
+}
+
+// AccrualClientConfig tunes requests to the accrual service.
+type AccrualClientConfig struct {
+	// Mode is "poll" to only poll orders registered by someone else, or
+	// "push" to register uploaded orders with the accrual system first.
+	Mode string `mapstructure:"mode"`
+
+	// MaxRPS caps requests per second; 0 leaves them unlimited until the first 429.
+	MaxRPS float64 `mapstructure:"max_rps"`
+	MinRPS float64 `mapstructure:"min_rps"`
+
+	// Timeout bounds a single request, retries not included.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// RetryAttempts includes the first request; 1 disables retries.
+	RetryAttempts  int           `mapstructure:"retry_attempts"`
+	RetryBaseDelay time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `mapstructure:"retry_max_delay"`
+	// BreakerThreshold is the number of consecutive failures that opens the
+	// circuit breaker; 0 disables it.
+	BreakerThreshold   int           `mapstructure:"breaker_threshold"`
+	BreakerOpenTimeout time.Duration `mapstructure:"breaker_open_timeout"`
+
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+
+	// CacheTTL keeps final answers (PROCESSED, INVALID) for this long; 0
+	// disables the cache.
+	CacheTTL        time.Duration `mapstructure:"cache_ttl"`
+	CacheMaxEntries int           `mapstructure:"cache_max_entries"`
 }
 
 var (
@@ -91,21 +280,8 @@ func loadConfig() (*Config, error) {
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
 	setDefaults(v)
-
-	configPath := os.Getenv("CONFIG_PATH")
-	if configPath != "" {
-		v.SetConfigFile(configPath)
-	} else {
-		v.SetConfigName("config")
-		v.AddConfigPath(".")
-		v.AddConfigPath("./configs")
-		v.AddConfigPath("/etc/gophermart")
-	}
-
-	if err := v.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, err
-		}
+	if err := readConfigFile(v); err != nil {
+		return nil, err
 	}
 
 	if *gophemartHost != "" {
@@ -135,6 +311,39 @@ func loadConfig() (*Config, error) {
 	return &cfg, nil
 }
 
+func readConfigFile(v *viper.Viper) error {
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath != "" {
+		v.SetConfigFile(configPath)
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("./configs")
+		v.AddConfigPath("/etc/gophermart")
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReloadLoggerLevel reads logger.level again from the environment and the
+// config file, for changing the level without a restart.
+func ReloadLoggerLevel() (string, error) {
+	v := viper.New()
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	setDefaults(v)
+	if err := readConfigFile(v); err != nil {
+		return "", err
+	}
+	return v.GetString("logger.level"), nil
+}
+
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.host", "localhost")
 	v.SetDefault("server.port", "8080")
@@ -160,4 +369,85 @@ func setDefaults(v *viper.Viper) {
 
 	v.SetDefault("logger.level", "info")
 	v.SetDefault("logger.format", "json")
+	v.SetDefault("logger.output", "stdout")
+	v.SetDefault("logger.file.path", "./data/app.log")
+	v.SetDefault("logger.file.max_size_mb", 100)
+	v.SetDefault("logger.file.max_backups", 5)
+	v.SetDefault("logger.file.max_age_days", 30)
+	v.SetDefault("logger.file.compress", false)
+	v.SetDefault("logger.with_caller", true)
+	v.SetDefault("logger.sampling.burst", 100)
+	v.SetDefault("logger.sampling.period", time.Second)
+	v.SetDefault("logger.sampling.every", 0)
+	v.SetDefault("logger.redaction.mode", "mask")
+	v.SetDefault("logger.redaction.fields", []string{"login", "ip", "remote_ip", "order", "order_number"})
+	v.SetDefault("logger.redaction.hash_key", "")
+
+	v.SetDefault("idempotency.ttl", 24*time.Hour)
+	v.SetDefault("idempotency.lock_timeout", time.Minute)
+
+	v.SetDefault("withdrawal.cancel_window", 24*time.Hour)
+
+	v.SetDefault("admin.token", "")
+
+	v.SetDefault("worker.workers", 4)
+	v.SetDefault("worker.poll_interval", time.Minute)
+	v.SetDefault("worker.order_timeout", 15*time.Second)
+	v.SetDefault("worker.batch_size", 100)
+	v.SetDefault("worker.lease_duration", time.Minute)
+	v.SetDefault("worker.retry_base_delay", 5*time.Second)
+	v.SetDefault("worker.retry_max_delay", 30*time.Minute)
+	v.SetDefault("worker.max_attempts", 10)
+
+	v.SetDefault("outbox.publisher", "none")
+	v.SetDefault("outbox.file_path", "./data/events.jsonl")
+	v.SetDefault("outbox.webhook_url", "")
+	v.SetDefault("outbox.poll_interval", time.Second)
+	v.SetDefault("outbox.batch_size", 50)
+	v.SetDefault("outbox.publish_timeout", 5*time.Second)
+	v.SetDefault("outbox.retry_base_delay", time.Second)
+	v.SetDefault("outbox.retry_max_delay", 10*time.Minute)
+	v.SetDefault("outbox.retention", 7*24*time.Hour)
+
+	v.SetDefault("webhooks.poll_interval", time.Second)
+	v.SetDefault("webhooks.batch_size", 50)
+	v.SetDefault("webhooks.concurrency", 4)
+	v.SetDefault("webhooks.timeout", 5*time.Second)
+	v.SetDefault("webhooks.retry_base_delay", 5*time.Second)
+	v.SetDefault("webhooks.retry_max_delay", time.Hour)
+	v.SetDefault("webhooks.max_attempts", 8)
+	v.SetDefault("webhooks.retention", 7*24*time.Hour)
+	v.SetDefault("webhooks.allow_private_networks", false)
+
+	v.SetDefault("stream.heartbeat_interval", 15*time.Second)
+	v.SetDefault("stream.retention", 24*time.Hour)
+	v.SetDefault("stream.buffer", 64)
+
+	v.SetDefault("metrics.path", "/metrics")
+	v.SetDefault("metrics.address", "")
+
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.endpoint", "localhost:4318")
+	v.SetDefault("tracing.insecure", true)
+	v.SetDefault("tracing.service_name", "gophermart")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+
+	v.SetDefault("health.check_timeout", 2*time.Second)
+	v.SetDefault("health.worker_max_age", 5*time.Minute)
+	v.SetDefault("health.shutdown_delay", 0)
+
+	v.SetDefault("accrual_client.mode", "poll")
+	v.SetDefault("accrual_client.max_rps", 0)
+	v.SetDefault("accrual_client.min_rps", 0.5)
+	v.SetDefault("accrual_client.timeout", 10*time.Second)
+	v.SetDefault("accrual_client.retry_attempts", 3)
+	v.SetDefault("accrual_client.retry_base_delay", 100*time.Millisecond)
+	v.SetDefault("accrual_client.retry_max_delay", 2*time.Second)
+	v.SetDefault("accrual_client.breaker_threshold", 5)
+	v.SetDefault("accrual_client.breaker_open_timeout", 30*time.Second)
+	v.SetDefault("accrual_client.max_idle_conns", 100)
+	v.SetDefault("accrual_client.max_idle_conns_per_host", 32)
+	v.SetDefault("accrual_client.idle_conn_timeout", 90*time.Second)
+	v.SetDefault("accrual_client.cache_ttl", time.Minute)
+	v.SetDefault("accrual_client.cache_max_entries", 10000)
 }
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogMiddleware_LogsRouteInsteadOfURI(t *testing.T) {
+	var logged bytes.Buffer
+	e := echo.New()
+	e.Use(RequestIDMiddleware())
+	e.Use(AccessLogMiddleware(&logged, func(c echo.Context) bool { return c.Path() == "/healthz" }))
+	e.POST("/api/user/withdrawals/:order/cancel", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusConflict, "already reversed")
+	})
+	e.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/withdrawals/2377225624/cancel?order=2377225624", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.NotContains(t, logged.String(), "2377225624")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(logged.Bytes(), &entry), "exactly one JSON line is expected")
+	assert.Equal(t, "/api/user/withdrawals/:order/cancel", entry["route"])
+	assert.Equal(t, "req-1", entry["id"])
+	assert.Equal(t, float64(http.StatusConflict), entry["status"])
+	assert.Contains(t, entry["error"], "already reversed")
+}
+
+func TestAccessLogMiddleware_LogsErrorsReturnedThroughTracing(t *testing.T) {
+	var logged bytes.Buffer
+	e := echo.New()
+	e.Use(AccessLogMiddleware(&logged, nil))
+	e.Use(TracingMiddleware())
+	e.Use(MetricsMiddleware())
+	e.GET("/api/user/balance", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "database unavailable")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user/balance", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "the error is answered once")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(logged.Bytes(), &entry))
+	assert.Equal(t, float64(http.StatusServiceUnavailable), entry["status"])
+	assert.Contains(t, entry["error"], "database unavailable")
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"errors"
+	"github.com/labstack/echo"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/service"
+	"gophemart/internal/handler/http/dto"
+	"gophemart/pkg/logger"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AccrualMonitor reports the state of the accrual client for operators.
+type AccrualMonitor interface {
+	RateLimitState() entity.AccrualRateLimiterState
+	BreakerState() entity.AccrualBreakerState
+	CacheStats() entity.AccrualCacheStats
+}
+
+type AdminHandler struct {
+	balanceService *service.BalanceService
+	orderService   *service.OrderService
+	accrual        AccrualMonitor
+}
+
+func NewAdminHandler(
+	balanceService *service.BalanceService,
+	orderService *service.OrderService,
+	accrual AccrualMonitor,
+) *AdminHandler {
+	return &AdminHandler{
+		balanceService: balanceService,
+		orderService:   orderService,
+		accrual:        accrual,
+	}
+}
+
+func (h *AdminHandler) ReverseWithdrawal(c echo.Context) error {
+	orderNumber := c.Param("order")
+
+	var req dto.ReverseWithdrawalRequest
+	if err := c.Bind(&req); err != nil {
+		logger.FromContext(c.Request().Context()).Warn().
+			Err(err).
+			Str("handler", "ReverseWithdrawal").
+			Str("order", orderNumber).
+			Msg("Failed to bind request")
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reason is required")
+	}
+
+	ctx := c.Request().Context()
+	withdrawal, err := h.balanceService.ReverseWithdrawal(ctx, orderNumber, reason)
+	if err != nil {
+		return withdrawalReversalError(ctx, err, "ReverseWithdrawal", "", orderNumber)
+	}
+
+	logger.FromContext(ctx).Info().
+		Str("handler", "ReverseWithdrawal").
+		Str("user_id", withdrawal.UserID).
+		Str("order", orderNumber).
+		Str("reason", reason).
+		Msg("Withdrawal reversed by admin")
+
+	return c.JSON(http.StatusOK, toWithdrawResponce(*withdrawal))
+}
+
+func (h *AdminHandler) GetParkedOrders(c echo.Context) error {
+	orders, err := h.orderService.ListParkedOrders(c.Request().Context())
+	if err != nil {
+		logger.FromContext(c.Request().Context()).Error().
+			Err(err).
+			Str("handler", "GetParkedOrders").
+			Msg("Failed to get parked orders")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	response := make([]dto.ParkedOrderResponce, 0, len(orders))
+	for _, o := range orders {
+		item := dto.ParkedOrderResponce{
+			Number:       o.Number,
+			UserID:       o.UserID,
+			Status:       string(o.Status),
+			AttemptCount: o.AttemptCount,
+			LastError:    o.LastError,
+			UploadedAt:   o.UploadedAt.Format(time.RFC3339),
+		}
+		if o.ParkedAt != nil {
+			item.ParkedAt = o.ParkedAt.Format(time.RFC3339)
+		}
+		response = append(response, item)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *AdminHandler) RequeueOrder(c echo.Context) error {
+	number := c.Param("number")
+
+	err := h.orderService.RequeueOrder(c.Request().Context(), number)
+	if err != nil {
+		if errors.Is(err, service.ErrParkedOrderNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "parked order not found")
+		}
+		logger.FromContext(c.Request().Context()).Error().
+			Err(err).
+			Str("handler", "RequeueOrder").
+			Str("order", number).
+			Msg("Failed to requeue order")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	logger.FromContext(c.Request().Context()).Info().
+		Str("handler", "RequeueOrder").
+		Str("order", number).
+		Msg("Parked order requeued by admin")
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *AdminHandler) GetAccrualStats(c echo.Context) error {
+	now := time.Now()
+	limit := h.accrual.RateLimitState()
+	breaker := h.accrual.BreakerState()
+	cache := h.accrual.CacheStats()
+
+	response := dto.AccrualStatsResponce{
+		RateLimit: dto.AccrualRateLimitStats{
+			RatePerSecond: limit.Rate,
+			RateLimited:   limit.RateLimited,
+		},
+		Breaker: dto.AccrualBreakerStats{
+			Status:   breaker.Status.String(),
+			Failures: breaker.Failures,
+		},
+		Cache: dto.AccrualCacheStats{
+			Hits:    cache.Hits,
+			Misses:  cache.Misses,
+			Shared:  cache.Shared,
+			Entries: cache.Entries,
+		},
+	}
+	if limit.Paused(now) {
+		response.RateLimit.PausedUntil = limit.PausedUntil.Format(time.RFC3339)
+	}
+	if breaker.Open(now) {
+		response.Breaker.OpenUntil = breaker.OpenUntil.Format(time.RFC3339)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *AdminHandler) GetLogLevel(c echo.Context) error {
+	return c.JSON(http.StatusOK, dto.LogLevel{Level: logger.Level().String()})
+}
+
+func (h *AdminHandler) SetLogLevel(c echo.Context) error {
+	var req dto.LogLevel
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+	level, err := logger.ParseLevel(req.Level)
+	if err != nil || req.Level == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown log level")
+	}
+
+	previous := logger.Level()
+	logger.SetLevel(level)
+	logger.FromContext(c.Request().Context()).Warn().
+		Str("handler", "SetLogLevel").
+		Str("previous", previous.String()).
+		Str("level", level.String()).
+		Msg("Log level changed by admin")
+	return c.JSON(http.StatusOK, dto.LogLevel{Level: level.String()})
+}
@@ -25,7 +25,7 @@ func NewAuthHandler(authService *service.AuthService, jwtManager *jwt.Manager) *
 }
 
 func (h *AuthHandler) Register(c echo.Context) error {
-	logger.Info().
+	logger.FromContext(c.Request().Context()).Info().
 		Str("handler", "Register").
 		Str("ip", c.RealIP()).
 		Msg("Registration request received")
@@ -33,13 +33,19 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	req := new(dto.RegisterRequest)
 
 	if err := c.Bind(req); err != nil {
-		logger.Error().
+		logger.FromContext(c.Request().Context()).Error().
 			Err(err).
 			Str("ip", c.RealIP()).
 			Msg("Failed to bind registration request")
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
 	}
-	logger.Info().
+	if req.Login == "" || req.Password == "" {
+		logger.FromContext(c.Request().Context()).Warn().
+			Str("ip", c.RealIP()).
+			Msg("Empty login or password in registration request")
+		return echo.NewHTTPError(http.StatusBadRequest, "login and password are required")
+	}
+	logger.FromContext(c.Request().Context()).Info().
 		Str("login", req.Login).
 		Str("ip", c.RealIP()).
 		Msg("Attempting user registration")
@@ -49,14 +55,14 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrUserAlreadyExists):
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Err(err).
 				Str("login", req.Login).
 				Str("ip", c.RealIP()).
 				Msg("Registration failed - user already exists")
 			return echo.NewHTTPError(http.StatusConflict, "user already exists")
 		default:
-			logger.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Str("login", req.Login).
 				Str("ip", c.RealIP()).
@@ -66,7 +72,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	}
 	token, err := h.jwtManager.GenerateToken(user.ID)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", fmt.Sprintf("%d", user.ID)).
 			Str("login", req.Login).
@@ -74,7 +80,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "")
 	}
 	h.setAuthCookie(c, token)
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", fmt.Sprintf("%d", user.ID)).
 		Str("login", req.Login).
 		Msg("User registered successfully")
@@ -82,20 +88,26 @@ func (h *AuthHandler) Register(c echo.Context) error {
 
 }
 func (h *AuthHandler) Login(c echo.Context) error {
-	logger.Info().
+	logger.FromContext(c.Request().Context()).Info().
 		Str("handler", "Login").
 		Str("ip", c.RealIP()).
 		Msg("Login request received")
 
 	req := new(dto.LoginRequest)
 	if err := c.Bind(req); err != nil {
-		logger.Error().
+		logger.FromContext(c.Request().Context()).Error().
 			Err(err).
 			Str("ip", c.RealIP()).
 			Msg("Failed to bind login request")
 		return c.JSON(http.StatusBadRequest, "")
 	}
-	logger.Info().
+	if req.Login == "" || req.Password == "" {
+		logger.FromContext(c.Request().Context()).Warn().
+			Str("ip", c.RealIP()).
+			Msg("Empty login or password in login request")
+		return echo.NewHTTPError(http.StatusBadRequest, "login and password are required")
+	}
+	logger.FromContext(c.Request().Context()).Info().
 		Str("login", req.Login).
 		Str("ip", c.RealIP()).
 		Msg("Attempting user login")
@@ -103,14 +115,14 @@ func (h *AuthHandler) Login(c echo.Context) error {
 	user, err := h.authService.Login(ctx, req.Login, req.Password)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidCredentials) {
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("login", req.Login).
 				Str("ip", c.RealIP()).
 				Msg("Invalid login credentials")
 			return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
 		}
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("login", req.Login).
 			Str("ip", c.RealIP()).
@@ -120,7 +132,7 @@ func (h *AuthHandler) Login(c echo.Context) error {
 
 	token, err := h.jwtManager.GenerateToken(user.ID)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", fmt.Sprintf("%d", user.ID)).
 			Str("login", req.Login).
@@ -128,7 +140,7 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, "")
 	}
 	h.setAuthCookie(c, token)
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", fmt.Sprintf("%d", user.ID)).
 		Str("login", req.Login).
 		Msg("User logged in successfully")
@@ -146,7 +158,7 @@ func (h *AuthHandler) setAuthCookie(c echo.Context, token string) {
 
 	c.SetCookie(cookie)
 
-	logger.Debug().
+	logger.FromContext(c.Request().Context()).Debug().
 		Str("cookie_name", authCookieName).
 		Time("expires", cookie.Expires).
 		Msg("Authentication cookie set")
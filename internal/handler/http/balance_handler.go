@@ -1,9 +1,11 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/labstack/echo"
+	"gophemart/internal/app/entity"
 	"gophemart/internal/app/service"
 	"gophemart/internal/handler/http/dto"
 	"gophemart/pkg/logger"
@@ -24,23 +26,23 @@ func (h *BalanceHandler) GetBalance(c echo.Context) error {
 	ctx := c.Request().Context()
 	userID, ok := c.Get(userIDKey).(string)
 	if !ok || userID == "" {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Str("handler", "UploadOrder").
 			Msg("UserID not found in context or invalid type")
 		return fmt.Errorf("userID not found or invalid type")
 	}
 	user, err := h.balanceService.GetBalance(ctx, userID)
 	if err != nil {
-		logger.Error().Str("errerr", err.Error()).Msg("UserID not found in context")
+		logger.FromContext(ctx).Error().Str("errerr", err.Error()).Msg("UserID not found in context")
 
-		return c.JSON(http.StatusBadRequest, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
 	}
 
 	response := dto.BalanceResponse{
 		Current:   user.CurrentBalance,
 		Withdrawn: user.Withdrawn,
 	}
-	logger.Error().
+	logger.FromContext(ctx).Error().
 		Str("user_id", userID).
 		Float64("current", user.CurrentBalance).
 		Float64("withdrawn", user.Withdrawn).
@@ -52,7 +54,7 @@ func (h *BalanceHandler) GetBalance(c echo.Context) error {
 func (h *BalanceHandler) Withdraw(c echo.Context) error {
 	userID, ok := c.Get(userIDKey).(string)
 	if !ok || userID == "" {
-		logger.Error().
+		logger.FromContext(c.Request().Context()).Error().
 			Str("handler", "UploadOrder").
 			Msg("UserID not found in context or invalid type")
 		return fmt.Errorf("userID not found or invalid type")
@@ -60,7 +62,7 @@ func (h *BalanceHandler) Withdraw(c echo.Context) error {
 
 	var req dto.WithdrawRequest
 	if err := c.Bind(&req); err != nil {
-		logger.Warn().
+		logger.FromContext(c.Request().Context()).Warn().
 			Err(err).
 			Str("handler", "Withdraw").
 			Str("user_id", userID).
@@ -69,7 +71,7 @@ func (h *BalanceHandler) Withdraw(c echo.Context) error {
 	}
 
 	if !isValidLuhn(req.Order) {
-		logger.Warn().
+		logger.FromContext(c.Request().Context()).Warn().
 			Str("handler", "Withdraw").
 			Str("user_id", userID).
 			Str("order", req.Order).
@@ -84,7 +86,7 @@ func (h *BalanceHandler) Withdraw(c echo.Context) error {
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrInsufficientFunds):
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("handler", "Withdraw").
 				Str("user_id", userID).
 				Str("order", req.Order).
@@ -93,15 +95,23 @@ func (h *BalanceHandler) Withdraw(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusPaymentRequired, "insufficient funds")
 
 		case errors.Is(err, service.ErrDuplicateOrder):
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("handler", "Withdraw").
 				Str("user_id", userID).
 				Str("order", req.Order).
 				Msg("Order already processed")
 			return echo.NewHTTPError(http.StatusConflict, "order already processed")
 
+		case errors.Is(err, service.ErrInvalidAmount):
+			logger.FromContext(ctx).Warn().
+				Str("handler", "Withdraw").
+				Str("user_id", userID).
+				Float64("sum", req.Sum).
+				Msg("Invalid withdrawal amount")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "invalid withdrawal amount")
+
 		case errors.Is(err, service.ErrInvalidOrder):
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("handler", "Withdraw").
 				Str("user_id", userID).
 				Str("order", req.Order).
@@ -109,7 +119,7 @@ func (h *BalanceHandler) Withdraw(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusUnprocessableEntity, "invalid order number")
 
 		default:
-			logger.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Str("handler", "Withdraw").
 				Str("user_id", userID).
@@ -120,7 +130,7 @@ func (h *BalanceHandler) Withdraw(c echo.Context) error {
 		}
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("handler", "Withdraw").
 		Str("user_id", userID).
 		Str("order", req.Order).
@@ -153,7 +163,7 @@ func isValidLuhn(number string) bool {
 func (h *BalanceHandler) GetWithdrawals(c echo.Context) error {
 	userID, ok := c.Get(userIDKey).(string)
 	if !ok || userID == "" {
-		logger.Error().Str("handler", "GetWithdrawals").Msg("UserID not found in context")
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "GetWithdrawals").Msg("UserID not found in context")
 		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
 	}
 
@@ -161,7 +171,7 @@ func (h *BalanceHandler) GetWithdrawals(c echo.Context) error {
 
 	withdrawals, err := h.balanceService.GetWithdrawals(ctx, userID)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Str("handler", "GetWithdrawals").
@@ -170,25 +180,102 @@ func (h *BalanceHandler) GetWithdrawals(c echo.Context) error {
 	}
 
 	if len(withdrawals) == 0 {
-		logger.Info().
+		logger.FromContext(ctx).Info().
 			Str("user_id", userID).
 			Msg("No withdrawals found for user")
-		return c.JSON(http.StatusOK, []dto.WithdrawResponce{})
+		return c.NoContent(http.StatusNoContent)
 	}
 
 	response := make([]dto.WithdrawResponce, 0, len(withdrawals))
 	for _, w := range withdrawals {
-		response = append(response, dto.WithdrawResponce{
-			Order:       w.OrderNumber,
-			Sum:         w.Sum,
-			ProcessedAt: w.ProcessedAt.UTC().Format(time.RFC3339),
-		})
+		response = append(response, toWithdrawResponce(w))
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", userID).
 		Int("count", len(withdrawals)).
 		Msg("Withdrawals retrieved successfully")
 
 	return c.JSON(http.StatusOK, response)
 }
+
+func (h *BalanceHandler) CancelWithdrawal(c echo.Context) error {
+	userID, ok := c.Get(userIDKey).(string)
+	if !ok || userID == "" {
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "CancelWithdrawal").Msg("UserID not found in context")
+		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+
+	orderNumber := c.Param("order")
+	ctx := c.Request().Context()
+
+	withdrawal, err := h.balanceService.CancelWithdrawal(ctx, userID, orderNumber)
+	if err != nil {
+		return withdrawalReversalError(ctx, err, "CancelWithdrawal", userID, orderNumber)
+	}
+
+	logger.FromContext(ctx).Info().
+		Str("handler", "CancelWithdrawal").
+		Str("user_id", userID).
+		Str("order", orderNumber).
+		Msg("Withdrawal cancelled successfully")
+
+	return c.JSON(http.StatusOK, toWithdrawResponce(*withdrawal))
+}
+
+// withdrawalReversalError maps errors of cancelling and reversing withdrawals
+// to HTTP errors, logging them with the request's logger.
+func withdrawalReversalError(ctx context.Context, err error, handler, userID, orderNumber string) error {
+	switch {
+	case errors.Is(err, service.ErrWithdrawalNotFound):
+		logger.FromContext(ctx).Warn().
+			Str("handler", handler).
+			Str("user_id", userID).
+			Str("order", orderNumber).
+			Msg("Withdrawal not found")
+		return echo.NewHTTPError(http.StatusNotFound, "withdrawal not found")
+
+	case errors.Is(err, service.ErrWithdrawalAlreadyReversed):
+		logger.FromContext(ctx).Warn().
+			Str("handler", handler).
+			Str("user_id", userID).
+			Str("order", orderNumber).
+			Msg("Withdrawal already reversed")
+		return echo.NewHTTPError(http.StatusConflict, "withdrawal already reversed")
+
+	case errors.Is(err, service.ErrCancellationWindowExpired):
+		logger.FromContext(ctx).Warn().
+			Str("handler", handler).
+			Str("user_id", userID).
+			Str("order", orderNumber).
+			Msg("Withdrawal cancellation window expired")
+		return echo.NewHTTPError(http.StatusConflict, "cancellation window expired")
+
+	default:
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("handler", handler).
+			Str("user_id", userID).
+			Str("order", orderNumber).
+			Msg("Failed to reverse withdrawal")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func toWithdrawResponce(w entity.Withdrawal) dto.WithdrawResponce {
+	status := w.Status
+	if status == "" {
+		status = entity.WithdrawalCompleted
+	}
+	resp := dto.WithdrawResponce{
+		Order:          w.OrderNumber,
+		Sum:            w.Sum,
+		ProcessedAt:    w.ProcessedAt.UTC().Format(time.RFC3339),
+		Status:         string(status),
+		ReversalReason: w.ReversalReason,
+	}
+	if w.ReversedAt != nil {
+		resp.ReversedAt = w.ReversedAt.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
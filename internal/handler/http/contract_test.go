@@ -0,0 +1,816 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/service"
+	"gophemart/internal/handler/http/openapi"
+	"gophemart/internal/transport/accrual"
+	"gophemart/pkg/jwt"
+	"gophemart/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminToken = "admin-secret"
+
+type contractEnv struct {
+	e        *echo.Echo
+	users    *fakeUserRepository
+	orders   *fakeOrderRepository
+	webhooks *fakeWebhookRepository
+	events   *fakeUserEventRepository
+	stream   *service.StreamService
+	health   *service.HealthService
+	// databaseErr is what the database readiness check reports.
+	databaseErr error
+	// accrualErr is what the optional accrual readiness check reports.
+	accrualErr error
+}
+
+func newContractEnv(t *testing.T) *contractEnv {
+	t.Helper()
+
+	users := newFakeUserRepository()
+	orders := newFakeOrderRepository()
+	jwtManager := jwt.NewManager("test-secret", time.Hour)
+
+	authService := service.NewAuthService(users, "test-secret")
+	accrualClient := accrual.NewClient("http://127.0.0.1:0")
+	orderService := service.NewOrderService(orders, users)
+	withdrawals := &fakeWithdrawalRepository{users: users, orders: orders}
+	balanceService := service.NewBalanceService(users, orders, withdrawals, time.Hour)
+	webhooks := newFakeWebhookRepository()
+	events := &fakeUserEventRepository{}
+	stream := service.NewStreamService(events, 8, time.Hour)
+	env := &contractEnv{users: users, orders: orders, webhooks: webhooks, events: events, stream: stream}
+	env.health = service.NewHealthService(time.Second, service.HealthCheck{
+		Name:  "database",
+		Check: func(context.Context) error { return env.databaseErr },
+	}, service.HealthCheck{
+		Name:     "accrual",
+		Check:    func(context.Context) error { return env.accrualErr },
+		Optional: true,
+	})
+
+	e := echo.New()
+	RegisterRoutes(e, jwtManager, testAdminToken, Handlers{
+		Auth:    NewAuthHandler(authService, jwtManager),
+		Order:   NewOrderHandler(orderService),
+		Balance: NewBalanceHandler(balanceService),
+		Admin:   NewAdminHandler(balanceService, orderService, accrualClient),
+		Webhook: NewWebhookHandler(service.NewWebhookService(webhooks)),
+		Stream:  NewStreamHandler(stream, time.Hour),
+		Health:  NewHealthHandler(env.health),
+
+		Idempotency: service.NewIdempotencyService(newFakeIdempotencyRepository(), time.Hour, time.Minute),
+	})
+
+	env.e = e
+	return env
+}
+
+func (env *contractEnv) do(method, path, contentType, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	return env.doWithHeaders(method, path, contentType, body, cookie, nil)
+}
+
+func (env *contractEnv) doWithHeaders(
+	method, path, contentType, body string,
+	cookie *http.Cookie,
+	headers map[string]string,
+) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	env.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func (env *contractEnv) register(t *testing.T, login string) (*http.Cookie, string) {
+	t.Helper()
+
+	rec := env.do(http.MethodPost, "/api/user/register", echo.MIMEApplicationJSON,
+		`{"login":"`+login+`","password":"secret"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == authCookieName {
+			user, err := env.users.FindByLogin(context.Background(), login)
+			require.NoError(t, err)
+			return c, fmt.Sprintf("%d", user.ID)
+		}
+	}
+	t.Fatal("auth cookie not set")
+	return nil, ""
+}
+
+func decodeKeys(t *testing.T, raw []byte) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &m))
+	return m
+}
+
+func decodeList(t *testing.T, raw []byte) []map[string]interface{} {
+	t.Helper()
+	var l []map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &l))
+	return l
+}
+
+func keysOf(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestContract_Register(t *testing.T) {
+	env := newContractEnv(t)
+
+	rec := env.do(http.MethodPost, "/api/user/register", echo.MIMEApplicationJSON,
+		`{"login":"alice","password":"secret"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Result().Cookies())
+
+	rec = env.do(http.MethodPost, "/api/user/register", echo.MIMEApplicationJSON,
+		`{"login":"alice","password":"other"}`, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/register", echo.MIMEApplicationJSON,
+		`{"login":"","password":""}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/register", echo.MIMEApplicationJSON, `{`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestContract_Login(t *testing.T) {
+	env := newContractEnv(t)
+	env.register(t, "bob")
+
+	rec := env.do(http.MethodPost, "/api/user/login", echo.MIMEApplicationJSON,
+		`{"login":"bob","password":"secret"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Result().Cookies())
+
+	rec = env.do(http.MethodPost, "/api/user/login", echo.MIMEApplicationJSON,
+		`{"login":"bob","password":"wrong"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/login", echo.MIMEApplicationJSON,
+		`{"login":"nobody","password":"secret"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/login", echo.MIMEApplicationJSON, `{`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestContract_UploadOrder(t *testing.T) {
+	env := newContractEnv(t)
+	alice, _ := env.register(t, "alice")
+	bob, _ := env.register(t, "bob")
+
+	rec := env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678903", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678903", alice)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678903", alice)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678903", bob)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678902", alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "", alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestContract_GetOrders(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+
+	rec := env.do(http.MethodGet, "/api/user/orders", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/user/orders", "", "", alice)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	uploadedAt := time.Date(2020, 12, 10, 15, 15, 45, 0, time.FixedZone("MSK", 3*60*60))
+	for i, o := range []entity.Order{
+		{Number: "9278923470", Status: entity.OrderProcessed, Accrual: 500},
+		{Number: "12345678903", Status: entity.OrderProcessing},
+		{Number: "346436439", Status: entity.OrderInvalid},
+		{Number: "79927398713", Status: entity.OrderNew},
+	} {
+		o.UserID = aliceID
+		o.UploadedAt = uploadedAt.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, env.orders.Create(context.Background(), &o))
+	}
+
+	rec = env.do(http.MethodGet, "/api/user/orders", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+
+	body := decodeList(t, rec.Body.Bytes())
+	require.Len(t, body, 4)
+
+	assert.ElementsMatch(t, []string{"number", "status", "accrual", "uploaded_at"}, keysOf(body[0]))
+	assert.Equal(t, "9278923470", body[0]["number"])
+	assert.Equal(t, "PROCESSED", body[0]["status"])
+	assert.Equal(t, float64(500), body[0]["accrual"])
+	assert.Equal(t, "2020-12-10T15:15:45+03:00", body[0]["uploaded_at"])
+
+	for _, item := range body[1:] {
+		assert.ElementsMatch(t, []string{"number", "status", "uploaded_at"}, keysOf(item))
+	}
+	assert.Equal(t, "PROCESSING", body[1]["status"])
+	assert.Equal(t, "INVALID", body[2]["status"])
+	assert.Equal(t, "NEW", body[3]["status"])
+}
+
+func TestContract_GetBalance(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+
+	rec := env.do(http.MethodGet, "/api/user/balance", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 500.5, 42))
+
+	rec = env.do(http.MethodGet, "/api/user/balance", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+
+	body := decodeKeys(t, rec.Body.Bytes())
+	assert.ElementsMatch(t, []string{"current", "withdrawn"}, keysOf(body))
+	assert.Equal(t, 500.5, body["current"])
+	assert.Equal(t, float64(42), body["withdrawn"])
+}
+
+func TestContract_Withdraw(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 1000, 0))
+
+	rec := env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624","sum":751}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624","sum":751}`, alice)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"12345678903","sum":751}`, alice)
+	assert.Equal(t, http.StatusPaymentRequired, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624","sum":1}`, alice)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"12345678903","sum":0.001}`, alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"12345678902","sum":1}`, alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestContract_GetWithdrawals(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+
+	rec := env.do(http.MethodGet, "/api/user/withdrawals", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/user/withdrawals", "", "", alice)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	require.NoError(t, env.orders.CreateWithdrawal(context.Background(), &entity.Withdrawal{
+		UserID:      aliceID,
+		OrderNumber: "2377225624",
+		Sum:         500,
+		Status:      entity.WithdrawalCompleted,
+		ProcessedAt: time.Date(2020, 12, 9, 16, 9, 57, 0, time.UTC),
+	}))
+
+	rec = env.do(http.MethodGet, "/api/user/withdrawals", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+
+	body := decodeList(t, rec.Body.Bytes())
+	require.Len(t, body, 1)
+	assert.ElementsMatch(t, []string{"order", "sum", "processed_at", "status"}, keysOf(body[0]))
+	assert.Equal(t, "2377225624", body[0]["order"])
+	assert.Equal(t, float64(500), body[0]["sum"])
+	assert.Equal(t, "2020-12-09T16:09:57Z", body[0]["processed_at"])
+	assert.Equal(t, "COMPLETED", body[0]["status"])
+}
+
+func TestContract_OpenAPISpec(t *testing.T) {
+	env := newContractEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/openapi.json", "", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+
+	body := decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "3.0.3", body["openapi"])
+
+	doc := openapi.MustLoad()
+	for _, route := range env.e.Routes() {
+		// Group middleware registers catch-all routes at group roots ("/api/admin", "/api/*").
+		if !strings.HasPrefix(route.Path, "/api/") || strings.Contains(route.Path, "*") || strings.Count(route.Path, "/") < 3 {
+			continue
+		}
+		assert.NotNil(t, doc.Operation(route.Method, openAPIPath(route.Path)),
+			"route %s %s is not described in the OpenAPI document", route.Method, route.Path)
+	}
+}
+
+func TestContract_RequestValidation(t *testing.T) {
+	env := newContractEnv(t)
+	alice, _ := env.register(t, "alice")
+
+	rec := env.do(http.MethodPost, "/api/user/register", echo.MIMETextPlain,
+		`{"login":"bob","password":"secret"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMEApplicationJSON, `"12345678903"`, alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678903", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624"}`, alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624","sum":-5}`, alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	huge := `{"login":"bob","password":"` + strings.Repeat("x", maxRequestBodySize) + `"}`
+	rec = env.do(http.MethodPost, "/api/user/register", echo.MIMEApplicationJSON, huge, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestContract_CancelWithdrawal(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	bob, _ := env.register(t, "bob")
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 1000, 0))
+
+	rec := env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624","sum":300}`, alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/withdrawals/2377225624/cancel", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/withdrawals/2377225624/cancel", "", "", bob)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/withdrawals/2377225624/cancel", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "REVERSED", body["status"])
+	assert.Equal(t, "cancelled by user", body["reversal_reason"])
+	assert.NotEmpty(t, body["reversed_at"])
+
+	user, err := env.users.FindByID(context.Background(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1000), user.CurrentBalance)
+	assert.Equal(t, float64(0), user.Withdrawn)
+
+	rec = env.do(http.MethodPost, "/api/user/withdrawals/2377225624/cancel", "", "", alice)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/user/withdrawals", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	list := decodeList(t, rec.Body.Bytes())
+	require.Len(t, list, 1)
+	assert.Equal(t, "REVERSED", list[0]["status"])
+
+	require.NoError(t, env.orders.CreateWithdrawal(context.Background(), &entity.Withdrawal{
+		UserID:      aliceID,
+		OrderNumber: "12345678903",
+		Sum:         10,
+		Status:      entity.WithdrawalCompleted,
+		ProcessedAt: time.Now().Add(-2 * time.Hour),
+	}))
+	rec = env.do(http.MethodPost, "/api/user/withdrawals/12345678903/cancel", "", "", alice)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestContract_AdminReverseWithdrawal(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 1000, 0))
+
+	rec := env.do(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+		`{"order":"2377225624","sum":300}`, alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	path := "/api/admin/withdrawals/2377225624/reverse"
+	rec = env.do(http.MethodPost, path, echo.MIMEApplicationJSON, `{"reason":"order refunded"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	admin := map[string]string{headerAdminToken: testAdminToken}
+	rec = env.doWithHeaders(http.MethodPost, path, echo.MIMEApplicationJSON, `{}`, nil, admin)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.doWithHeaders(http.MethodPost, path, echo.MIMEApplicationJSON, `{"reason":"order refunded"}`, nil, admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "REVERSED", body["status"])
+	assert.Equal(t, "order refunded", body["reversal_reason"])
+
+	user, err := env.users.FindByID(context.Background(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1000), user.CurrentBalance)
+
+	rec = env.doWithHeaders(http.MethodPost, path, echo.MIMEApplicationJSON, `{"reason":"again"}`, nil, admin)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = env.doWithHeaders(http.MethodPost, "/api/admin/withdrawals/12345678903/reverse",
+		echo.MIMEApplicationJSON, `{"reason":"x"}`, nil, admin)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestContract_AdminParkedOrders(t *testing.T) {
+	env := newContractEnv(t)
+	alice, _ := env.register(t, "alice")
+
+	rec := env.do(http.MethodPost, "/api/user/orders", echo.MIMETextPlain, "12345678903", alice)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.NoError(t, env.orders.Park(context.Background(), "12345678903", time.Time{}, 10, "order not registered in accrual system"))
+
+	rec = env.do(http.MethodGet, "/api/admin/orders/parked", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	admin := map[string]string{headerAdminToken: testAdminToken}
+	rec = env.doWithHeaders(http.MethodGet, "/api/admin/orders/parked", "", "", nil, admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	list := decodeList(t, rec.Body.Bytes())
+	require.Len(t, list, 1)
+	assert.Equal(t, "12345678903", list[0]["number"])
+	assert.Equal(t, float64(10), list[0]["attempt_count"])
+	assert.Equal(t, "order not registered in accrual system", list[0]["last_error"])
+	assert.Contains(t, list[0], "parked_at")
+
+	rec = env.doWithHeaders(http.MethodPost, "/api/admin/orders/12345678903/requeue", "", "", nil, admin)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	order, err := env.orders.FindByNumber(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Nil(t, order.ParkedAt)
+	assert.Zero(t, order.AttemptCount)
+
+	rec = env.doWithHeaders(http.MethodPost, "/api/admin/orders/12345678903/requeue", "", "", nil, admin)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = env.doWithHeaders(http.MethodGet, "/api/admin/orders/parked", "", "", nil, admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+}
+
+func TestContract_AdminAccrualStats(t *testing.T) {
+	env := newContractEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/admin/accrual/stats", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	admin := map[string]string{headerAdminToken: testAdminToken}
+	rec = env.doWithHeaders(http.MethodGet, "/api/admin/accrual/stats", "", "", nil, admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"rate_limit": {"rate_per_second": 0, "rate_limited": 0},
+		"breaker": {"status": "closed", "failures": 0},
+		"cache": {"hits": 0, "misses": 0, "shared": 0, "entries": 0}
+	}`, rec.Body.String())
+}
+
+func TestContract_AdminLogLevel(t *testing.T) {
+	env := newContractEnv(t)
+	previous := logger.Level()
+	defer logger.SetLevel(previous)
+	logger.SetLevel(zerolog.InfoLevel)
+
+	rec := env.do(http.MethodGet, "/api/admin/log-level", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	admin := map[string]string{headerAdminToken: testAdminToken}
+	rec = env.doWithHeaders(http.MethodGet, "/api/admin/log-level", "", "", nil, admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"info"}`, rec.Body.String())
+
+	rec = env.doWithHeaders(http.MethodPut, "/api/admin/log-level", echo.MIMEApplicationJSON, `{"level":"verbose"}`, nil, admin)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.doWithHeaders(http.MethodPut, "/api/admin/log-level", echo.MIMEApplicationJSON, `{"level":"debug"}`, nil, admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"debug"}`, rec.Body.String())
+	assert.Equal(t, zerolog.DebugLevel, logger.Level())
+}
+
+func TestContract_HealthAndReadiness(t *testing.T) {
+	env := newContractEnv(t)
+
+	rec := env.do(http.MethodGet, "/healthz", "", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+
+	rec = env.do(http.MethodGet, "/readyz", "", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "ok", body["status"])
+	database := body["components"].(map[string]interface{})["database"].(map[string]interface{})
+	assert.Equal(t, "up", database["status"])
+	assert.Contains(t, database, "latency_ms")
+
+	env.databaseErr = errors.New("connection refused")
+	rec = env.do(http.MethodGet, "/readyz", "", "", nil)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	body = decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "unavailable", body["status"])
+	database = body["components"].(map[string]interface{})["database"].(map[string]interface{})
+	assert.Equal(t, "down", database["status"])
+	assert.NotContains(t, database, "error", "failure details must not leak from a public endpoint")
+
+	env.databaseErr = nil
+	env.accrualErr = errors.New("rate limited")
+	rec = env.do(http.MethodGet, "/readyz", "", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, "an optional component does not make the replica unready")
+	body = decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "degraded", body["status"])
+	accrual := body["components"].(map[string]interface{})["accrual"].(map[string]interface{})
+	assert.Equal(t, "down", accrual["status"])
+	assert.NotContains(t, accrual, "error")
+
+	env.accrualErr = nil
+	env.health.SetShuttingDown()
+	rec = env.do(http.MethodGet, "/readyz", "", "", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "shutting_down", decodeKeys(t, rec.Body.Bytes())["status"])
+
+	rec = env.do(http.MethodGet, "/healthz", "", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code, "liveness does not depend on shutdown")
+}
+
+func TestContract_Webhooks(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	bob, _ := env.register(t, "bob")
+
+	rec := env.do(http.MethodPost, "/api/user/webhooks", echo.MIMEApplicationJSON,
+		`{"url":"https://merchant.example/hooks"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/webhooks", echo.MIMEApplicationJSON, `{}`, alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/webhooks", echo.MIMEApplicationJSON, `{"url":"ftp://merchant.example"}`, alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/webhooks", echo.MIMEApplicationJSON,
+		`{"url":"https://merchant.example/hooks","secret":"short"}`, alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "secret shorter than minLength")
+
+	rec = env.do(http.MethodPost, "/api/user/webhooks", echo.MIMEApplicationJSON,
+		`{"url":"https://merchant.example/hooks","secret":"`+strings.Repeat("s", 256)+`"}`, alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "secret longer than maxLength")
+
+	rec = env.do(http.MethodPost, "/api/user/webhooks", echo.MIMEApplicationJSON,
+		`{"url":"https://merchant.example/hooks"}`, alice)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	created := decodeKeys(t, rec.Body.Bytes())
+	assert.Equal(t, "https://merchant.example/hooks", created["url"])
+	assert.Len(t, created["secret"], 64, "a generated secret is returned once")
+	id := fmt.Sprintf("%v", created["id"])
+
+	rec = env.do(http.MethodGet, "/api/user/webhooks", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	list := decodeList(t, rec.Body.Bytes())
+	require.Len(t, list, 1)
+	assert.NotContains(t, list[0], "secret")
+
+	env.webhooks.deliveries = append(env.webhooks.deliveries, entity.WebhookDelivery{
+		ID:             1,
+		WebhookID:      1,
+		UserID:         aliceID,
+		EventType:      entity.EventOrderStatusChanged,
+		Status:         entity.DeliveryPending,
+		Attempts:       1,
+		LastStatusCode: http.StatusServiceUnavailable,
+		LastError:      "webhook responded with status 503",
+		NextAttemptAt:  time.Now().Add(time.Minute),
+	})
+
+	rec = env.do(http.MethodGet, "/api/user/webhooks/"+id+"/deliveries", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	deliveries := decodeList(t, rec.Body.Bytes())
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "OrderStatusChanged", deliveries[0]["event"])
+	assert.Equal(t, "PENDING", deliveries[0]["status"])
+	assert.Equal(t, float64(503), deliveries[0]["last_status_code"])
+	assert.Contains(t, deliveries[0], "next_attempt_at")
+
+	rec = env.do(http.MethodGet, "/api/user/webhooks/"+id+"/deliveries", "", "", bob)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "deliveries of another user's webhook")
+
+	rec = env.do(http.MethodDelete, "/api/user/webhooks/"+id, "", "", bob)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = env.do(http.MethodDelete, "/api/user/webhooks/"+id, "", "", alice)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/user/webhooks", "", "", alice)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+}
+
+// readSSEFrame reads one event from an SSE stream, skipping comment lines.
+func readSSEFrame(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	frame := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(frame) > 0 {
+				return frame
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		frame[field] = value
+	}
+}
+
+func TestContract_OrderStream(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	_, bobID := env.register(t, "bob")
+
+	rec := env.do(http.MethodGet, "/api/user/orders/stream", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.doWithHeaders(http.MethodGet, "/api/user/orders/stream", "", "", alice,
+		map[string]string{"Last-Event-ID": "abc"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	seen := env.events.add(aliceID, entity.UserEventOrder, `{"number":"12345678903","status":"PROCESSING","uploaded_at":"2020-12-10T15:15:45+03:00"}`)
+	env.events.add(bobID, entity.UserEventBalance, `{"current":1,"withdrawn":0}`)
+	missed := env.events.add(aliceID, entity.UserEventOrder, `{"number":"12345678903","status":"PROCESSED","accrual":500,"uploaded_at":"2020-12-10T15:15:45+03:00"}`)
+
+	server := httptest.NewServer(env.e)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/user/orders/stream", nil)
+	require.NoError(t, err)
+	req.AddCookie(alice)
+	req.Header.Set("Last-Event-ID", fmt.Sprintf("%d", seen.ID))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+
+	body := bufio.NewReader(resp.Body)
+	frame := readSSEFrame(t, body)
+	assert.Equal(t, fmt.Sprintf("%d", missed.ID), frame["id"])
+	assert.Equal(t, entity.UserEventOrder, frame["event"])
+	assert.Equal(t, "PROCESSED", decodeKeys(t, []byte(frame["data"]))["status"])
+
+	env.stream.Notify(ctx, bobID, env.events.add(bobID, entity.UserEventBalance, `{"current":2,"withdrawn":0}`).ID)
+	live := env.events.add(aliceID, entity.UserEventBalance, `{"current":500,"withdrawn":0}`)
+	env.stream.Notify(ctx, aliceID, live.ID)
+
+	frame = readSSEFrame(t, body)
+	assert.Equal(t, fmt.Sprintf("%d", live.ID), frame["id"])
+	assert.Equal(t, entity.UserEventBalance, frame["event"])
+	assert.JSONEq(t, `{"current":500,"withdrawn":0}`, frame["data"])
+}
+
+func openStream(t *testing.T, env *contractEnv, cookie *http.Cookie, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	server := httptest.NewServer(env.e)
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/user/orders/stream", nil)
+	require.NoError(t, err)
+	req.AddCookie(cookie)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return bufio.NewReader(resp.Body)
+}
+
+func TestContract_OrderStreamDeliversOutOfOrderCommits(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+
+	seen := env.events.add(aliceID, entity.UserEventBalance, `{"current":1,"withdrawn":0}`)
+	// slow got the lower ID but commits after fast.
+	slow := env.events.add(aliceID, entity.UserEventBalance, `{"current":2,"withdrawn":0}`)
+	fast := env.events.add(aliceID, entity.UserEventBalance, `{"current":3,"withdrawn":0}`)
+	env.events.setCommitted(slow.ID, false)
+
+	body := openStream(t, env, alice, fmt.Sprintf("%d", seen.ID))
+	assert.Equal(t, fmt.Sprintf("%d", fast.ID), readSSEFrame(t, body)["id"])
+
+	ctx := context.Background()
+	env.stream.Notify(ctx, aliceID, fast.ID)
+	env.events.setCommitted(slow.ID, true)
+	env.stream.Notify(ctx, aliceID, slow.ID)
+	assert.Equal(t, fmt.Sprintf("%d", slow.ID), readSSEFrame(t, body)["id"],
+		"the replayed event must not be sent twice and the late commit must not be dropped")
+}
+
+func TestContract_OrderStreamResetsWhenTooFarBehind(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+
+	var latest entity.UserEvent
+	for i := 0; i < 501; i++ {
+		latest = env.events.add(aliceID, entity.UserEventBalance, `{"current":1,"withdrawn":0}`)
+	}
+
+	body := openStream(t, env, alice, "")
+	frame := readSSEFrame(t, body)
+	assert.Equal(t, "reset", frame["event"])
+	assert.Equal(t, fmt.Sprintf("%d", latest.ID), frame["id"])
+
+	live := env.events.add(aliceID, entity.UserEventBalance, `{"current":2,"withdrawn":0}`)
+	env.stream.Notify(context.Background(), aliceID, live.ID)
+	assert.Equal(t, fmt.Sprintf("%d", live.ID), readSSEFrame(t, body)["id"])
+}
+
+func TestContract_UploadOrderWithGoods(t *testing.T) {
+	env := newContractEnv(t)
+	alice, _ := env.register(t, "alice")
+
+	rec := env.do(http.MethodPost, "/api/user/orders", echo.MIMEApplicationJSON,
+		`{"order":"12345678903","goods":[{"description":"Чайник Bork","price":7000}]}`, alice)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	order, err := env.orders.FindByNumber(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, []entity.Good{{Description: "Чайник Bork", Price: 7000}}, order.Goods)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMEApplicationJSON, `{"order":"12345678903"}`, alice)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMEApplicationJSON, `{"order":"12345678902"}`, alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMEApplicationJSON,
+		`{"order":"79927398713","goods":[{"description":"Spoon","price":-1}]}`, alice)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/user/orders", echo.MIMEApplicationJSON, `{"goods":[]}`, alice)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -1,13 +1,20 @@
 package dto
 
 type WithdrawRequest struct {
-	Order string
-	Sum   float64
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
 }
 type WithdrawResponce struct {
-	Order       string
-	Sum         float64
-	ProcessedAt string
+	Order          string  `json:"order"`
+	Sum            float64 `json:"sum"`
+	ProcessedAt    string  `json:"processed_at"`
+	Status         string  `json:"status"`
+	ReversalReason string  `json:"reversal_reason,omitempty"`
+	ReversedAt     string  `json:"reversed_at,omitempty"`
+}
+
+type ReverseWithdrawalRequest struct {
+	Reason string `json:"reason"`
 }
 
 type BalanceResponse struct {
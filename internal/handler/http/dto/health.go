@@ -0,0 +1,13 @@
+package dto
+
+// HealthResponce is the body of GET /healthz and GET /readyz. Components is
+// only filled in by /readyz.
+type HealthResponce struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+type ComponentHealth struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+}
@@ -1,12 +1,66 @@
 package dto
 
+// UploadOrderRequest is the JSON form of POST /api/user/orders. Goods are
+// forwarded to the accrual system when orders are registered there.
 type UploadOrderRequest struct {
-	Number string
+	Number string `json:"order"`
+	Goods  []Good `json:"goods"`
 }
 
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// OrderResponce describes an order in GET /api/user/orders.
+// Accrual is omitted unless the order is PROCESSED.
 type OrderResponce struct {
-	Number     string
-	Status     string
-	Accrual    float64
-	UploadedAt string
+	Number     string   `json:"number"`
+	Status     string   `json:"status"`
+	Accrual    *float64 `json:"accrual,omitempty"`
+	UploadedAt string   `json:"uploaded_at"`
+}
+
+// ParkedOrderResponce describes an order in GET /api/admin/orders/parked.
+type ParkedOrderResponce struct {
+	Number       string `json:"number"`
+	UserID       string `json:"user_id"`
+	Status       string `json:"status"`
+	AttemptCount int    `json:"attempt_count"`
+	LastError    string `json:"last_error,omitempty"`
+	UploadedAt   string `json:"uploaded_at"`
+	ParkedAt     string `json:"parked_at"`
+}
+
+// AccrualStatsResponce is the body of GET /api/admin/accrual/stats.
+type AccrualStatsResponce struct {
+	RateLimit AccrualRateLimitStats `json:"rate_limit"`
+	Breaker   AccrualBreakerStats   `json:"breaker"`
+	Cache     AccrualCacheStats     `json:"cache"`
+}
+
+type AccrualRateLimitStats struct {
+	// PausedUntil is omitted unless requests are paused after a 429.
+	PausedUntil   string  `json:"paused_until,omitempty"`
+	RatePerSecond float64 `json:"rate_per_second"`
+	RateLimited   int64   `json:"rate_limited"`
+}
+
+type AccrualBreakerStats struct {
+	Status string `json:"status"`
+	// OpenUntil is omitted unless the breaker is open.
+	OpenUntil string `json:"open_until,omitempty"`
+	Failures  int    `json:"failures"`
+}
+
+type AccrualCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Shared  int64 `json:"shared"`
+	Entries int   `json:"entries"`
+}
+
+// LogLevel is the body of GET and PUT /api/admin/log-level.
+type LogLevel struct {
+	Level string `json:"level"`
 }
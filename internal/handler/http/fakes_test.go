@@ -0,0 +1,577 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/repository/postgresql"
+	"sort"
+	"sync"
+	"time"
+)
+
+type fakeUserRepository struct {
+	mu    sync.Mutex
+	users map[string]*entity.User
+}
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{users: make(map[string]*entity.User)}
+}
+
+func (r *fakeUserRepository) Create(_ context.Context, user *entity.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Login == user.Login {
+			return postgresql.ErrDuplicateKey
+		}
+	}
+	stored := *user
+	r.users[fmt.Sprintf("%d", user.ID)] = &stored
+	return nil
+}
+
+func (r *fakeUserRepository) FindByLogin(_ context.Context, login string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Login == login {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrRocordNotFound
+}
+
+func (r *fakeUserRepository) FindByID(_ context.Context, id string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, postgresql.ErrNotFound
+	}
+	found := *u
+	return &found, nil
+}
+
+func (r *fakeUserRepository) UpdateBalance(_ context.Context, userID string, newBalance, newWithdrawn float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[userID]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	u.CurrentBalance = newBalance
+	u.Withdrawn = newWithdrawn
+	return nil
+}
+
+func (r *fakeUserRepository) AddBalance(_ context.Context, userID string, amount float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[userID]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	u.CurrentBalance += amount
+	return nil
+}
+
+func (r *fakeUserRepository) CreateWithdrawal(context.Context, *entity.Withdrawal) error {
+	return nil
+}
+
+type fakeOrderRepository struct {
+	mu          sync.Mutex
+	orders      map[string]*entity.Order
+	withdrawals []entity.Withdrawal
+}
+
+func newFakeOrderRepository() *fakeOrderRepository {
+	return &fakeOrderRepository{orders: make(map[string]*entity.Order)}
+}
+
+func (r *fakeOrderRepository) Create(_ context.Context, order *entity.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.orders[order.Number]; ok {
+		return postgresql.ErrDuplicateKey
+	}
+	stored := *order
+	r.orders[order.Number] = &stored
+	return nil
+}
+
+func (r *fakeOrderRepository) FindByNumber(_ context.Context, number string) (*entity.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[number]
+	if !ok {
+		return nil, postgresql.ErrNotFound
+	}
+	found := *o
+	return &found, nil
+}
+
+func (r *fakeOrderRepository) FindByUserID(_ context.Context, userID string) ([]entity.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []entity.Order
+	for _, o := range r.orders {
+		if o.UserID == userID {
+			orders = append(orders, *o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].UploadedAt.Before(orders[j].UploadedAt)
+	})
+	return orders, nil
+}
+
+func (r *fakeOrderRepository) Update(_ context.Context, order *entity.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *order
+	r.orders[order.Number] = &stored
+	return nil
+}
+
+func (r *fakeOrderRepository) UpdateStatus(_ context.Context, orderNumber string, status entity.OrderStatus, accrual float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[orderNumber]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	o.Status = status
+	o.Accrual = accrual
+	return nil
+}
+
+func (r *fakeOrderRepository) FindUnprocessed(ctx context.Context) ([]entity.Order, error) {
+	return r.FindPending(ctx)
+}
+
+func (r *fakeOrderRepository) FindPending(context.Context) ([]entity.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []entity.Order
+	for _, o := range r.orders {
+		if o.Status == entity.OrderNew || o.Status == entity.OrderProcessing {
+			orders = append(orders, *o)
+		}
+	}
+	return orders, nil
+}
+
+func (r *fakeOrderRepository) ClaimPending(ctx context.Context, limit int, _ time.Duration) ([]entity.Order, error) {
+	orders, err := r.FindPending(ctx)
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, err
+}
+
+func (r *fakeOrderRepository) ReleaseClaim(context.Context, string, time.Time) error {
+	return nil
+}
+
+func (r *fakeOrderRepository) MarkRegistered(context.Context, string) error {
+	return nil
+}
+
+func (r *fakeOrderRepository) ScheduleRetry(
+	_ context.Context,
+	number string,
+	_ time.Time,
+	attempts int,
+	next time.Time,
+	lastError string,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[number]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	o.AttemptCount = attempts
+	o.NextAttemptAt = &next
+	o.LastError = lastError
+	return nil
+}
+
+func (r *fakeOrderRepository) Park(_ context.Context, number string, _ time.Time, attempts int, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[number]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	now := time.Now()
+	o.AttemptCount = attempts
+	o.LastError = lastError
+	o.ParkedAt = &now
+	return nil
+}
+
+func (r *fakeOrderRepository) FindParked(context.Context) ([]entity.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []entity.Order
+	for _, o := range r.orders {
+		if o.ParkedAt != nil {
+			orders = append(orders, *o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ParkedAt.Before(*orders[j].ParkedAt)
+	})
+	return orders, nil
+}
+
+func (r *fakeOrderRepository) CountPending(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, o := range r.orders {
+		if o.ParkedAt == nil && (o.Status == entity.OrderNew || o.Status == entity.OrderProcessing) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeOrderRepository) NextAttemptAt(context.Context) (*time.Time, error) {
+	return nil, nil
+}
+
+func (r *fakeOrderRepository) Requeue(_ context.Context, number string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[number]
+	if !ok || o.ParkedAt == nil {
+		return postgresql.ErrNotFound
+	}
+	o.AttemptCount = 0
+	o.LastError = ""
+	o.ParkedAt = nil
+	o.NextAttemptAt = nil
+	return nil
+}
+
+func (r *fakeOrderRepository) CreateWithdrawal(_ context.Context, withdrawal *entity.Withdrawal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.withdrawals = append(r.withdrawals, *withdrawal)
+	return nil
+}
+
+func (r *fakeOrderRepository) GetWithdrawalsByUser(_ context.Context, userID string) ([]entity.Withdrawal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var withdrawals []entity.Withdrawal
+	for _, w := range r.withdrawals {
+		if w.UserID == userID {
+			withdrawals = append(withdrawals, w)
+		}
+	}
+	return withdrawals, nil
+}
+
+type fakeIdempotencyRepository struct {
+	mu      sync.Mutex
+	nextID  uint
+	records map[uint]*entity.IdempotencyRecord
+}
+
+func newFakeIdempotencyRepository() *fakeIdempotencyRepository {
+	return &fakeIdempotencyRepository{records: make(map[uint]*entity.IdempotencyRecord)}
+}
+
+func (r *fakeIdempotencyRepository) Create(_ context.Context, record *entity.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.records {
+		if existing.UserID == record.UserID && existing.Key == record.Key {
+			return postgresql.ErrDuplicateKey
+		}
+	}
+	r.nextID++
+	record.ID = r.nextID
+	record.CreatedAt = time.Now().UTC()
+	record.UpdatedAt = record.CreatedAt
+	stored := *record
+	r.records[record.ID] = &stored
+	return nil
+}
+
+func (r *fakeIdempotencyRepository) Find(_ context.Context, userID, key string) (*entity.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.records {
+		if existing.UserID == userID && existing.Key == key {
+			found := *existing
+			return &found, nil
+		}
+	}
+	return nil, postgresql.ErrNotFound
+}
+
+func (r *fakeIdempotencyRepository) Complete(_ context.Context, id uint, statusCode int, contentType string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[id]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	return nil
+}
+
+func (r *fakeIdempotencyRepository) Touch(_ context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[id]
+	if !ok || record.Completed {
+		return postgresql.ErrNotFound
+	}
+	record.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (r *fakeIdempotencyRepository) Delete(_ context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, id)
+	return nil
+}
+
+func (r *fakeIdempotencyRepository) DeleteExpiredBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, record := range r.records {
+		if record.ExpiresAt.Before(before) {
+			delete(r.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type fakeWithdrawalRepository struct {
+	users  *fakeUserRepository
+	orders *fakeOrderRepository
+}
+
+func (r *fakeWithdrawalRepository) Withdraw(_ context.Context, withdrawal *entity.Withdrawal) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	r.orders.mu.Lock()
+	defer r.orders.mu.Unlock()
+
+	u, ok := r.users.users[withdrawal.UserID]
+	if !ok {
+		return postgresql.ErrNotFound
+	}
+	for _, w := range r.orders.withdrawals {
+		if w.OrderNumber == withdrawal.OrderNumber {
+			return postgresql.ErrDuplicateWithdrawal
+		}
+	}
+	if u.CurrentBalance < withdrawal.Sum {
+		return postgresql.ErrInsufficientBalance
+	}
+	u.CurrentBalance -= withdrawal.Sum
+	u.Withdrawn += withdrawal.Sum
+	r.orders.withdrawals = append(r.orders.withdrawals, *withdrawal)
+	return nil
+}
+
+func (r *fakeWithdrawalRepository) FindByUserID(ctx context.Context, userID string) ([]entity.Withdrawal, error) {
+	return r.orders.GetWithdrawalsByUser(ctx, userID)
+}
+
+func (r *fakeWithdrawalRepository) Reverse(
+	_ context.Context,
+	userID, orderNumber, reason string,
+	processedAfter time.Time,
+) (*entity.Withdrawal, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	r.orders.mu.Lock()
+	defer r.orders.mu.Unlock()
+
+	for i := range r.orders.withdrawals {
+		w := &r.orders.withdrawals[i]
+		if w.OrderNumber != orderNumber || (userID != "" && w.UserID != userID) {
+			continue
+		}
+		if w.Status == entity.WithdrawalReversed {
+			return nil, postgresql.ErrWithdrawalReversed
+		}
+		if !processedAfter.IsZero() && w.ProcessedAt.Before(processedAfter) {
+			return nil, postgresql.ErrReversalWindowClosed
+		}
+		now := time.Now().UTC()
+		w.Status = entity.WithdrawalReversed
+		w.ReversalReason = reason
+		w.ReversedAt = &now
+		if u, ok := r.users.users[w.UserID]; ok {
+			u.CurrentBalance += w.Sum
+			u.Withdrawn -= w.Sum
+		}
+		reversed := *w
+		return &reversed, nil
+	}
+	return nil, postgresql.ErrNotFound
+}
+
+type fakeWebhookRepository struct {
+	mu         sync.Mutex
+	nextID     uint
+	webhooks   map[uint]*entity.Webhook
+	deliveries []entity.WebhookDelivery
+}
+
+func newFakeWebhookRepository() *fakeWebhookRepository {
+	return &fakeWebhookRepository{webhooks: make(map[uint]*entity.Webhook)}
+}
+
+func (r *fakeWebhookRepository) Create(_ context.Context, webhook *entity.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	webhook.ID = r.nextID
+	webhook.CreatedAt = time.Now()
+	stored := *webhook
+	r.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (r *fakeWebhookRepository) FindByUserID(_ context.Context, userID string) ([]entity.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var webhooks []entity.Webhook
+	for _, w := range r.webhooks {
+		if w.UserID == userID {
+			webhooks = append(webhooks, *w)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (r *fakeWebhookRepository) Delete(_ context.Context, userID string, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.webhooks[id]
+	if !ok || w.UserID != userID {
+		return postgresql.ErrNotFound
+	}
+	delete(r.webhooks, id)
+	return nil
+}
+
+func (r *fakeWebhookRepository) FindDeliveries(_ context.Context, userID string, webhookID uint, limit int) ([]entity.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deliveries []entity.WebhookDelivery
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := r.deliveries[i]
+		if d.UserID == userID && d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *fakeWebhookRepository) ClaimDeliveries(context.Context, int, time.Duration) ([]entity.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) MarkDelivered(context.Context, uint, int, int) error {
+	return nil
+}
+
+func (r *fakeWebhookRepository) RecordFailure(context.Context, uint, int, int, string, *time.Time) error {
+	return nil
+}
+
+func (r *fakeWebhookRepository) DeleteFinishedBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+type fakeUserEventRepository struct {
+	mu     sync.Mutex
+	events []entity.UserEvent
+	// uncommitted events are skipped by FindAfter, as if their transaction
+	// were still running.
+	uncommitted map[uint]bool
+}
+
+func (r *fakeUserEventRepository) setCommitted(id uint, committed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.uncommitted == nil {
+		r.uncommitted = make(map[uint]bool)
+	}
+	r.uncommitted[id] = !committed
+}
+
+func (r *fakeUserEventRepository) add(userID, eventType, payload string) entity.UserEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event := entity.UserEvent{
+		ID:        uint(len(r.events) + 1),
+		UserID:    userID,
+		Type:      eventType,
+		Payload:   []byte(payload),
+		CreatedAt: time.Now(),
+	}
+	r.events = append(r.events, event)
+	return event
+}
+
+func (r *fakeUserEventRepository) FindByID(_ context.Context, id uint) (*entity.UserEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == 0 || int(id) > len(r.events) {
+		return nil, postgresql.ErrNotFound
+	}
+	event := r.events[id-1]
+	return &event, nil
+}
+
+func (r *fakeUserEventRepository) FindAfter(_ context.Context, userID string, afterID uint, limit int) ([]entity.UserEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []entity.UserEvent
+	for _, e := range r.events {
+		if e.UserID == userID && e.ID > afterID && !r.uncommitted[e.ID] && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *fakeUserEventRepository) LatestID(_ context.Context, userID string) (uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest uint
+	for _, e := range r.events {
+		if e.UserID == userID && e.ID > latest {
+			latest = e.ID
+		}
+	}
+	return latest, nil
+}
+
+func (r *fakeUserEventRepository) DeleteBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
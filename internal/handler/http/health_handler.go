@@ -0,0 +1,73 @@
+package http
+
+import (
+	"github.com/labstack/echo"
+	"gophemart/internal/app/service"
+	"gophemart/internal/handler/http/dto"
+	"gophemart/pkg/logger"
+	"net/http"
+)
+
+const (
+	healthStatusOK           = "ok"
+	healthStatusDegraded     = "degraded"
+	healthStatusUnavailable  = "unavailable"
+	healthStatusShuttingDown = "shutting_down"
+	componentStatusUp        = "up"
+	componentStatusDown      = "down"
+)
+
+type HealthHandler struct {
+	healthService *service.HealthService
+}
+
+func NewHealthHandler(healthService *service.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Live answers as long as the process serves HTTP requests.
+func (h *HealthHandler) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, dto.HealthResponce{Status: healthStatusOK})
+}
+
+// Ready answers 503 with the failing components while the replica cannot
+// serve traffic. Failing optional components are reported as degraded with
+// 200, so that the replica stays in rotation. The endpoint is public, so the
+// reason a component is down only goes to the log.
+func (h *HealthHandler) Ready(c echo.Context) error {
+	ctx := c.Request().Context()
+	readiness := h.healthService.Readiness(ctx)
+
+	response := dto.HealthResponce{
+		Status:     healthStatusOK,
+		Components: make(map[string]dto.ComponentHealth, len(readiness.Components)),
+	}
+	for _, component := range readiness.Components {
+		item := dto.ComponentHealth{
+			Status:    componentStatusUp,
+			LatencyMS: component.Duration.Milliseconds(),
+		}
+		if component.Err != nil {
+			item.Status = componentStatusDown
+			logger.FromContext(ctx).Warn().
+				Err(component.Err).
+				Str("handler", "Ready").
+				Str("component", component.Name).
+				Msg("Readiness check failed")
+		}
+		response.Components[component.Name] = item
+	}
+
+	switch {
+	case readiness.ShuttingDown:
+		response.Status = healthStatusShuttingDown
+	case !readiness.Ready:
+		response.Status = healthStatusUnavailable
+	case readiness.Degraded:
+		response.Status = healthStatusDegraded
+	}
+	if !readiness.Ready {
+		return c.JSON(http.StatusServiceUnavailable, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/service"
+	"gophemart/internal/repository/postgresql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotency_Withdraw(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 1000, 0))
+
+	withdraw := func(key, body string) *http.Response {
+		rec := env.doWithHeaders(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+			body, alice, map[string]string{headerIdempotencyKey: key})
+		return rec.Result()
+	}
+
+	first := withdraw("key-1", `{"order":"2377225624","sum":600}`)
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+	assert.Empty(t, first.Header.Get(headerIdempotentReplayed))
+
+	replay := withdraw("key-1", `{"order":"2377225624","sum":600}`)
+	assert.Equal(t, http.StatusOK, replay.StatusCode)
+	assert.Equal(t, "true", replay.Header.Get(headerIdempotentReplayed))
+
+	user, err := env.users.FindByID(context.Background(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(400), user.CurrentBalance)
+	assert.Equal(t, float64(600), user.Withdrawn)
+
+	mismatch := withdraw("key-1", `{"order":"2377225624","sum":1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.StatusCode)
+
+	failed := withdraw("key-2", `{"order":"12345678903","sum":600}`)
+	assert.Equal(t, http.StatusPaymentRequired, failed.StatusCode)
+
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 1000, 600))
+	failedReplay := withdraw("key-2", `{"order":"12345678903","sum":600}`)
+	assert.Equal(t, http.StatusPaymentRequired, failedReplay.StatusCode)
+	assert.Equal(t, "true", failedReplay.Header.Get(headerIdempotentReplayed))
+}
+
+func TestIdempotency_ConcurrentDuplicates(t *testing.T) {
+	env := newContractEnv(t)
+	alice, aliceID := env.register(t, "alice")
+	require.NoError(t, env.users.UpdateBalance(context.Background(), aliceID, 1000, 0))
+
+	const requests = 10
+	var wg sync.WaitGroup
+	codes := make([]int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := env.doWithHeaders(http.MethodPost, "/api/user/balance/withdraw", echo.MIMEApplicationJSON,
+				`{"order":"2377225624","sum":100}`, alice, map[string]string{headerIdempotencyKey: "same"})
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	user, err := env.users.FindByID(context.Background(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(900), user.CurrentBalance)
+
+	withdrawals, err := env.orders.GetWithdrawalsByUser(context.Background(), aliceID)
+	require.NoError(t, err)
+	assert.Len(t, withdrawals, 1)
+}
+
+// newIdempotentRoute serves handler at POST /op for user 1 behind
+// IdempotencyMiddleware.
+func newIdempotentRoute(lockTimeout time.Duration, handler echo.HandlerFunc) *echo.Echo {
+	idempotency := service.NewIdempotencyService(newFakeIdempotencyRepository(), time.Hour, lockTimeout)
+	authenticated := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(userIDKey, "1")
+			return next(c)
+		}
+	}
+	e := echo.New()
+	e.POST("/op", handler, authenticated, IdempotencyMiddleware(idempotency))
+	return e
+}
+
+func postWithKey(e *echo.Echo, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/op", nil)
+	req.Header.Set(headerIdempotencyKey, key)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotency_ServerErrorsAreNotStored(t *testing.T) {
+	var calls int64
+	e := newIdempotentRoute(time.Minute, func(c echo.Context) error {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "try again")
+		}
+		return c.String(http.StatusOK, "done")
+	})
+
+	assert.Equal(t, http.StatusServiceUnavailable, postWithKey(e, "key").Code)
+
+	retry := postWithKey(e, "key")
+	assert.Equal(t, http.StatusOK, retry.Code, "a server error must release the key")
+	assert.Empty(t, retry.Header().Get(headerIdempotentReplayed))
+
+	replay := postWithKey(e, "key")
+	assert.Equal(t, http.StatusOK, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get(headerIdempotentReplayed))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+}
+
+func TestIdempotency_SlowRequestKeepsLock(t *testing.T) {
+	var calls int64
+	started := make(chan struct{})
+	e := newIdempotentRoute(30*time.Millisecond, func(c echo.Context) error {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			close(started)
+		}
+		time.Sleep(200 * time.Millisecond)
+		return c.String(http.StatusOK, "done")
+	})
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- postWithKey(e, "key") }()
+	<-started
+
+	second := postWithKey(e, "key")
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, "true", second.Header().Get(headerIdempotentReplayed),
+		"a request outliving the lock timeout must not be taken over")
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+}
+
+func TestIdempotency_RejectsOversizedBody(t *testing.T) {
+	var calls int64
+	e := newIdempotentRoute(time.Minute, func(c echo.Context) error {
+		atomic.AddInt64(&calls, 1)
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/op", strings.NewReader(strings.Repeat("x", maxRequestBodySize+1)))
+	req.Header.Set(headerIdempotencyKey, "key")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Zero(t, atomic.LoadInt64(&calls))
+}
+
+func TestIdempotency_RunDeletesExpiredKeys(t *testing.T) {
+	repo := newFakeIdempotencyRepository()
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, &entity.IdempotencyRecord{UserID: "1", Key: "old", ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, repo.Create(ctx, &entity.IdempotencyRecord{UserID: "1", Key: "new", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	stopped, stop := context.WithCancel(ctx)
+	stop()
+	service.NewIdempotencyService(repo, time.Hour, time.Minute).Run(stopped)
+
+	_, err := repo.Find(ctx, "1", "old")
+	assert.ErrorIs(t, err, postgresql.ErrNotFound)
+	_, err = repo.Find(ctx, "1", "new")
+	assert.NoError(t, err)
+}
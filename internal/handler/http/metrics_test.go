@@ -0,0 +1,38 @@
+package http
+
+import (
+	"gophemart/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsMiddleware_RecordsErrorStatus(t *testing.T) {
+	var handled error
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			handled = next(c)
+			return handled
+		}
+	})
+	e.Use(MetricsMiddleware())
+	e.POST("/metrics-test/:order/cancel", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusConflict, "already reversed")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics-test/2377225624/cancel", nil))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	require.Error(t, handled, "the error must reach the outer middleware")
+
+	scrape := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scrape.Body.String(),
+		`gophermart_http_requests_total{method="POST",route="/metrics-test/:order/cancel",status="409"} 1`)
+}
@@ -1,12 +1,30 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gophemart/internal/app/service"
+	"gophemart/internal/handler/http/openapi"
+	"gophemart/internal/metrics"
+	"gophemart/internal/tracing"
 	"gophemart/pkg/jwt"
 	"gophemart/pkg/logger"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,7 +44,7 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 
 			cookie, err := c.Cookie(authCookieName)
 			if err != nil {
-				logger.Error().
+				logger.FromContext(c.Request().Context()).Error().
 					Err(err).
 					Str("path", path).
 					Str("method", method).
@@ -40,7 +58,7 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 
 			claims, err := jwtManager.ValidateToken(cookie.Value)
 			if err != nil {
-				logger.Error().
+				logger.FromContext(c.Request().Context()).Error().
 					Err(err).
 					Str("path", path).
 					Str("method", method).
@@ -54,7 +72,7 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 
 			claimValue, exists := claims["user_id"]
 			if !exists {
-				logger.Error().
+				logger.FromContext(c.Request().Context()).Error().
 					Str("path", path).
 					Str("method", method).
 					Str("ip", ip).
@@ -77,7 +95,7 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 			case int64:
 				userID = strconv.FormatInt(v, 10)
 			default:
-				logger.Error().
+				logger.FromContext(c.Request().Context()).Error().
 					Str("path", path).
 					Str("method", method).
 					Str("ip", ip).
@@ -91,7 +109,7 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 			}
 
 			if userID == "" {
-				logger.Error().
+				logger.FromContext(c.Request().Context()).Error().
 					Str("path", path).
 					Str("method", method).
 					Str("ip", ip).
@@ -103,8 +121,9 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 			}
 
 			c.Set(userIDKey, userID)
+			c.SetRequest(c.Request().WithContext(logger.WithStr(c.Request().Context(), "user_id", userID)))
 
-			logger.Info().
+			logger.FromContext(c.Request().Context()).Info().
 				Str("user_id", userID).
 				Str("path", path).
 				Str("method", method).
@@ -116,3 +135,399 @@ func AuthMiddleware(jwtManager *jwt.Manager) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// maxRequestBodySize bounds the request bodies the validation and idempotency
+// middlewares read into memory.
+const maxRequestBodySize = 1 << 20
+
+// readBody reads at most maxRequestBodySize bytes of the request body and puts
+// them back for the next handler.
+func readBody(c echo.Context) ([]byte, error) {
+	req := c.Request()
+	body, err := io.ReadAll(http.MaxBytesReader(c.Response(), req.Body, maxRequestBodySize))
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// bodyReadError answers 413 to bodies over maxRequestBodySize and 400 to
+// other read failures.
+func bodyReadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body is too large")
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+}
+
+func ValidationMiddleware(validator *openapi.Validator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			body, err := readBody(c)
+			if err != nil {
+				logger.FromContext(c.Request().Context()).Error().
+					Err(err).
+					Str("path", c.Path()).
+					Str("method", req.Method).
+					Msg("Failed to read request body for validation")
+				return bodyReadError(err)
+			}
+
+			err = validator.ValidateRequest(req.Method, openAPIPath(c.Path()), req.Header.Get(echo.HeaderContentType), body)
+			if err != nil {
+				var vErr *openapi.ValidationError
+				if errors.As(err, &vErr) {
+					logger.FromContext(c.Request().Context()).Warn().
+						Str("path", c.Path()).
+						Str("method", req.Method).
+						Int("status", vErr.Status).
+						Str("reason", vErr.Message).
+						Msg("Request rejected by schema validation")
+					return echo.NewHTTPError(vErr.Status, vErr.Message)
+				}
+
+				logger.FromContext(c.Request().Context()).Error().
+					Err(err).
+					Str("path", c.Path()).
+					Str("method", req.Method).
+					Msg("Schema validation failed")
+				return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// openAPIPath converts an echo route ("/orders/:number") into an OpenAPI
+// path template ("/orders/{number}").
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware makes a route safe to retry: the first response for an
+// Idempotency-Key is stored and replayed for later requests with the same key.
+// Requests without the header are passed through unchanged.
+func IdempotencyMiddleware(idempotencyService *service.IdempotencyService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(headerIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return echo.NewHTTPError(http.StatusBadRequest, "idempotency key is too long")
+			}
+
+			userID, ok := c.Get(userIDKey).(string)
+			if !ok || userID == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+			}
+
+			req := c.Request()
+			body, err := readBody(c)
+			if err != nil {
+				return bodyReadError(err)
+			}
+
+			ctx := req.Context()
+			fingerprint := service.Fingerprint([]byte(req.Method), []byte(c.Path()), body)
+
+			lock, stored, err := idempotencyService.Begin(ctx, userID, key, fingerprint)
+			if err != nil {
+				switch {
+				case errors.Is(err, service.ErrIdempotencyKeyReused):
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "idempotency key was used with a different request")
+				case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+					return echo.NewHTTPError(http.StatusConflict, "request with this idempotency key is in progress")
+				default:
+					logger.FromContext(ctx).Error().
+						Err(err).
+						Str("user_id", userID).
+						Str("idempotency_key", key).
+						Msg("Failed to process idempotency key")
+					return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+				}
+			}
+
+			if stored != nil {
+				c.Response().Header().Set(headerIdempotentReplayed, "true")
+				if len(stored.Body) == 0 {
+					return c.NoContent(stored.StatusCode)
+				}
+				return c.Blob(stored.StatusCode, stored.ContentType, stored.Body)
+			}
+
+			// The reservation is released if the handler panics or fails with a
+			// server error, so that the client can retry with the same key. Any
+			// other response is final and is stored.
+			executed := false
+			defer func() {
+				if !executed {
+					if err := idempotencyService.Release(context.WithoutCancel(ctx), lock); err != nil {
+						logger.FromContext(ctx).Error().
+							Err(err).
+							Str("user_id", userID).
+							Str("idempotency_key", key).
+							Msg("Failed to release idempotency key")
+					}
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			stopKeepAlive := idempotencyService.KeepAlive(context.WithoutCancel(ctx), lock)
+			defer stopKeepAlive()
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			if c.Response().Status >= http.StatusInternalServerError {
+				return nil
+			}
+			executed = true
+
+			err = idempotencyService.Complete(context.WithoutCancel(ctx), lock, service.IdempotentResponse{
+				StatusCode:  c.Response().Status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			})
+			if err != nil {
+				logger.FromContext(ctx).Error().
+					Err(err).
+					Str("user_id", userID).
+					Str("idempotency_key", key).
+					Msg("Failed to store idempotent response")
+			}
+			return nil
+		}
+	}
+}
+
+const headerAdminToken = "X-Admin-Token"
+
+// AdminMiddleware guards administrative routes with a static token. An empty
+// token disables the routes entirely.
+func AdminMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return echo.ErrNotFound
+			}
+
+			provided := c.Request().Header.Get(headerAdminToken)
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				logger.FromContext(c.Request().Context()).Warn().
+					Str("path", c.Path()).
+					Str("method", c.Request().Method).
+					Str("ip", c.RealIP()).
+					Msg("Admin request with invalid token")
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid admin token")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// MetricsMiddleware counts requests and their latency per route pattern and
+// response status.
+func MetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			metrics.ObserveHTTPRequest(c.Request().Method, route, status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// TracingMiddleware starts a server span for every request, continuing the
+// caller's trace when it sends a W3C traceparent header. Handlers reach the
+// span through c.Request().Context().
+func TracingMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			ctx, span := tracing.Tracer().Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+				),
+			)
+			defer span.End()
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = logger.WithStr(ctx, "trace_id", sc.TraceID().String())
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+
+			// The error is answered by echo's error handler after the
+			// middlewares return, so its status is not in the response yet.
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+				span.RecordError(err)
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
+
+// accessLogEntry has the fields of echo's default access log, except that the
+// route pattern replaces the request URI: URIs carry order numbers in path
+// parameters, which must not reach the logs.
+type accessLogEntry struct {
+	Time         string `json:"time"`
+	ID           string `json:"id"`
+	RemoteIP     string `json:"remote_ip"`
+	Host         string `json:"host"`
+	Method       string `json:"method"`
+	Route        string `json:"route"`
+	UserAgent    string `json:"user_agent"`
+	Status       int    `json:"status"`
+	Error        string `json:"error"`
+	Latency      int64  `json:"latency"`
+	LatencyHuman string `json:"latency_human"`
+	BytesIn      int64  `json:"bytes_in"`
+	BytesOut     int64  `json:"bytes_out"`
+}
+
+// AccessLogMiddleware writes one JSON line per request to out, such as
+// logger.Writer(), so that personal data in it is redacted like in events.
+func AccessLogMiddleware(out io.Writer, skipper middleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+			latency := time.Since(start)
+
+			req, res := c.Request(), c.Response()
+			entry := accessLogEntry{
+				Time:         start.Format(time.RFC3339Nano),
+				ID:           req.Header.Get(echo.HeaderXRequestID),
+				RemoteIP:     c.RealIP(),
+				Host:         req.Host,
+				Method:       req.Method,
+				Route:        c.Path(),
+				UserAgent:    req.UserAgent(),
+				Status:       res.Status,
+				Latency:      int64(latency),
+				LatencyHuman: latency.String(),
+				BytesIn:      req.ContentLength,
+				BytesOut:     res.Size,
+			}
+			if entry.BytesIn < 0 {
+				entry.BytesIn = 0
+			}
+			if err != nil {
+				entry.Status = errorStatus(err)
+				entry.Error = err.Error()
+			}
+
+			line, _ := json.Marshal(entry)
+			out.Write(append(line, '\n'))
+			return err
+		}
+	}
+}
+
+// errorStatus is the status echo's error handler answers err with.
+func errorStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// maxRequestIDLength bounds X-Request-ID values accepted from callers.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware tags every request with an ID, taken from the caller's
+// X-Request-ID header when it is sane and generated otherwise. The ID is
+// echoed in the response and added to the request's logger (see
+// logger.FromContext).
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if !isValidRequestID(requestID) {
+				requestID = uuid.NewString()
+				// The access log reads the ID from the request header.
+				req.Header.Set(echo.HeaderXRequestID, requestID)
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+			c.SetRequest(req.WithContext(logger.WithStr(req.Context(), "request_id", requestID)))
+			return next(c)
+		}
+	}
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
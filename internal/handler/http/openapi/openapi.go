@@ -0,0 +1,92 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed openapi.json
+var rawSpec []byte
+
+// Document is the subset of an OpenAPI 3 document needed to validate requests.
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref              string             `json:"$ref"`
+	Type             string             `json:"type"`
+	Format           string             `json:"format"`
+	Pattern          string             `json:"pattern"`
+	Enum             []string           `json:"enum"`
+	MinLength        *int               `json:"minLength"`
+	MaxLength        *int               `json:"maxLength"`
+	Minimum          *float64           `json:"minimum"`
+	ExclusiveMinimum bool               `json:"exclusiveMinimum"`
+	MultipleOf       *float64           `json:"multipleOf"`
+	Required         []string           `json:"required"`
+	Properties       map[string]*Schema `json:"properties"`
+	Items            *Schema            `json:"items"`
+}
+
+// Spec returns the raw OpenAPI document served at /api/openapi.json.
+func Spec() []byte {
+	return rawSpec
+}
+
+func Load() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(rawSpec, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi spec: %w", err)
+	}
+	return &doc, nil
+}
+
+func MustLoad() *Document {
+	doc, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// Operation returns the operation registered for method and path, where path
+// uses OpenAPI templates ("/api/user/withdrawals/{order}").
+func (d *Document) Operation(method, path string) *Operation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+	return item[strings.ToLower(method)]
+}
+
+func (d *Document) resolve(s *Schema) (*Schema, error) {
+	for s != nil && s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema reference %q", s.Ref)
+		}
+		s = resolved
+	}
+	return s, nil
+}
@@ -0,0 +1,215 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FormatChecker reports whether value satisfies a custom string format.
+type FormatChecker func(value string) bool
+
+// ValidationError describes a request that does not match the document.
+// Status is the HTTP status the API responds with for this kind of violation.
+type ValidationError struct {
+	Status  int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+type Validator struct {
+	doc     *Document
+	formats map[string]FormatChecker
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+func NewValidator(doc *Document, formats map[string]FormatChecker) *Validator {
+	return &Validator{
+		doc:      doc,
+		formats:  formats,
+		patterns: make(map[string]*regexp.Regexp),
+	}
+}
+
+// ValidateRequest checks the content type and body of a request to the
+// operation registered for method and path. Unknown operations pass through.
+func (v *Validator) ValidateRequest(method, path, contentType string, body []byte) error {
+	op := v.doc.Operation(method, path)
+	if op == nil || op.RequestBody == nil {
+		return nil
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return badRequest("request body is required")
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return badRequest(fmt.Sprintf("unsupported content type %q", contentType))
+	}
+	media, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		return badRequest(fmt.Sprintf("unsupported content type %q", mediaType))
+	}
+	if media.Schema == nil {
+		return nil
+	}
+
+	var value interface{}
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return badRequest("invalid JSON body")
+		}
+		if dec.More() {
+			return badRequest("invalid JSON body")
+		}
+	default:
+		value = strings.TrimSpace(string(body))
+	}
+
+	return v.validate(media.Schema, value, "body")
+}
+
+func (v *Validator) validate(s *Schema, value interface{}, path string) error {
+	s, err := v.doc.resolve(s)
+	if err != nil {
+		return err
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return badRequest(path + " must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return badRequest(fmt.Sprintf("%s.%s is required", path, name))
+			}
+		}
+		for name, prop := range s.Properties {
+			field, ok := obj[name]
+			if !ok {
+				continue
+			}
+			if err := v.validate(prop, field, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return badRequest(path + " must be an array")
+		}
+		for i, item := range arr {
+			if err := v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "number", "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			return badRequest(path + " must be a number")
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return badRequest(path + " must be an integer")
+			}
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return badRequest(path + " must be a number")
+		}
+		if s.Minimum != nil {
+			if f < *s.Minimum || (s.ExclusiveMinimum && f == *s.Minimum) {
+				return unprocessable(fmt.Sprintf("%s must be greater than %v", path, *s.Minimum))
+			}
+		}
+		if s.MultipleOf != nil && *s.MultipleOf > 0 {
+			q := f / *s.MultipleOf
+			if math.Abs(q-math.Round(q)) > 1e-6 {
+				return unprocessable(fmt.Sprintf("%s must be a multiple of %v", path, *s.MultipleOf))
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return badRequest(path + " must be a string")
+		}
+		return v.validateString(s, str, path)
+	}
+	return nil
+}
+
+func (v *Validator) validateString(s *Schema, str, path string) error {
+	if s.MinLength != nil && len(str) < *s.MinLength {
+		return badRequest(path + " is too short")
+	}
+	if s.MaxLength != nil && len(str) > *s.MaxLength {
+		return badRequest(path + " is too long")
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return badRequest(fmt.Sprintf("%s must be one of %v", path, s.Enum))
+		}
+	}
+	if s.Pattern != "" {
+		re, err := v.pattern(s.Pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(str) {
+			return unprocessable(path + " has invalid format")
+		}
+	}
+	if check, ok := v.formats[s.Format]; ok && !check(str) {
+		return unprocessable(fmt.Sprintf("%s is not a valid %s value", path, s.Format))
+	}
+	return nil
+}
+
+func (v *Validator) pattern(p string) (*regexp.Regexp, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if re, ok := v.patterns[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+	}
+	v.patterns[p] = re
+	return re, nil
+}
+
+func badRequest(msg string) *ValidationError {
+	return &ValidationError{Status: http.StatusBadRequest, Message: msg}
+}
+
+func unprocessable(msg string) *ValidationError {
+	return &ValidationError{Status: http.StatusUnprocessableEntity, Message: msg}
+}
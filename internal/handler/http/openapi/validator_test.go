@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func digitsOnly(value string) bool {
+	return value != "0"
+}
+
+func TestValidator_ValidateRequest(t *testing.T) {
+	v := NewValidator(MustLoad(), map[string]FormatChecker{"luhn": digitsOnly})
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{
+			name:        "valid credentials",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":"alice","password":"secret"}`,
+		},
+		{
+			name:        "json with charset",
+			method:      http.MethodPost,
+			path:        "/api/user/login",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"login":"alice","password":"secret"}`,
+		},
+		{
+			name:        "missing password",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":"alice"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "wrong field type",
+			method:      http.MethodPost,
+			path:        "/api/user/login",
+			contentType: "application/json",
+			body:        `{"login":1,"password":"secret"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "wrong content type",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "text/plain",
+			body:        `{"login":"alice","password":"secret"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "malformed json",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "empty body",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "valid order number",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			body:        "12345678903\n",
+		},
+		{
+			name:        "non-numeric order number",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			body:        "12ab",
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "order number failing format",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			body:        "0",
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "valid withdrawal",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			contentType: "application/json",
+			body:        `{"order":"2377225624","sum":751.5}`,
+		},
+		{
+			name:        "non-positive withdrawal",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			contentType: "application/json",
+			body:        `{"order":"2377225624","sum":0}`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "withdrawal with sub-cent precision",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			contentType: "application/json",
+			body:        `{"order":"2377225624","sum":1.005}`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "withdrawal sum as string",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			contentType: "application/json",
+			body:        `{"order":"2377225624","sum":"751"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:   "operation without body",
+			method: http.MethodGet,
+			path:   "/api/user/orders",
+		},
+		{
+			name:   "unknown operation",
+			method: http.MethodGet,
+			path:   "/unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.ValidateRequest(tt.method, tt.path, tt.contentType, []byte(tt.body))
+			if tt.status == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var vErr *ValidationError
+			require.True(t, errors.As(err, &vErr), "expected ValidationError, got %v", err)
+			assert.Equal(t, tt.status, vErr.Status)
+		})
+	}
+}
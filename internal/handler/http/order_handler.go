@@ -1,9 +1,11 @@
 package http
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/labstack/echo"
+	"gophemart/internal/app/entity"
 	"gophemart/internal/app/service"
 	"gophemart/internal/handler/http/dto"
 	"gophemart/pkg/logger"
@@ -26,40 +28,36 @@ func (h *OrderHandler) UploadOrder(c echo.Context) error {
 
 	userID, ok := c.Get(userIDKey).(string)
 	if !ok || userID == "" {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Str("handler", "OrderHandler.UploadOrder").
 			Msg("UserID not found in context or invalid type")
 		return fmt.Errorf("userID not found or invalid type")
 	}
-	body := c.Request().Body
-	defer body.Close()
-
-	dataFromBody, err := io.ReadAll(body)
+	orderNumber, goods, err := readUploadedOrder(c)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("handler", "UploadOrder").
 			Msg("Failed to read request body")
-		return c.JSON(http.StatusBadRequest, err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
 	}
 
-	orderNumber := strings.TrimSpace(string(dataFromBody))
 	if orderNumber == "" {
-		logger.Warn().
+		logger.FromContext(ctx).Warn().
 			Str("handler", "UploadOrder").
 			Msg("Empty order number provided")
 
-		return c.JSON(http.StatusBadRequest, err)
+		return echo.NewHTTPError(http.StatusBadRequest, "order number is required")
 	}
 	if !isValidLuhn(orderNumber) {
-		logger.Warn().Str("order_number", orderNumber).Msg("Invalid order number format")
+		logger.FromContext(ctx).Warn().Str("order_number", orderNumber).Msg("Invalid order number format")
 		return echo.NewHTTPError(http.StatusUnprocessableEntity, "invalid order number format")
 	}
-	err = h.orderService.UploadOrder(ctx, userID, orderNumber)
+	err = h.orderService.UploadOrder(ctx, userID, orderNumber, goods)
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrOrderAlreadyUploaded):
-			logger.Info().
+			logger.FromContext(ctx).Info().
 				Str("user_id", userID).
 				Str("order_number", orderNumber).
 				Msg("Order already uploaded by user")
@@ -67,7 +65,7 @@ func (h *OrderHandler) UploadOrder(c echo.Context) error {
 			return c.NoContent(http.StatusOK)
 
 		case errors.Is(err, service.ErrOrderBelongsToAnotherUser):
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("user_id", userID).
 				Str("order_number", orderNumber).
 				Msg("Order belongs to another user")
@@ -75,7 +73,7 @@ func (h *OrderHandler) UploadOrder(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusConflict, "order already exists for another user")
 
 		default:
-			logger.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Str("user_id", userID).
 				Str("order_number", orderNumber).
@@ -88,38 +86,73 @@ func (h *OrderHandler) UploadOrder(c echo.Context) error {
 	return c.NoContent(http.StatusAccepted)
 }
 
+// readUploadedOrder accepts the plain order number or, as JSON, the number
+// together with the goods of the order.
+func readUploadedOrder(c echo.Context) (string, []entity.Good, error) {
+	body := c.Request().Body
+	defer body.Close()
+
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", nil, err
+		}
+		return strings.TrimSpace(string(data)), nil, nil
+	}
+
+	var req dto.UploadOrderRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return "", nil, err
+	}
+	goods := make([]entity.Good, len(req.Goods))
+	for i, g := range req.Goods {
+		goods[i] = entity.Good{Description: g.Description, Price: g.Price}
+	}
+	return strings.TrimSpace(req.Number), goods, nil
+}
+
 func (h *OrderHandler) GetOrders(c echo.Context) error {
 	ctx := c.Request().Context()
 	userID, ok := c.Get(userIDKey).(string)
 	if !ok || userID == "" {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Str("handler", "OrderHandler.UploadOrder").
 			Msg("UserID not found in context or invalid type")
 		return fmt.Errorf("userID not found or invalid type")
 	}
 	orders, err := h.orderService.GetUserOrders(ctx, userID)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("user_id", userID).
 			Str("handler", "GetOrders").
 			Msg(err.Error())
 
-		return c.JSON(http.StatusBadRequest, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	if len(orders) == 0 {
+		logger.FromContext(ctx).Info().
+			Str("user_id", userID).
+			Msg("No orders found for user")
+		return c.NoContent(http.StatusNoContent)
 	}
 
 	responce := make([]dto.OrderResponce, 0, len(orders))
 	for _, order := range orders {
-
-		responce = append(responce, dto.OrderResponce{
+		item := dto.OrderResponce{
 			Number:     order.Number,
 			Status:     string(order.Status),
-			Accrual:    order.Accrual,
 			UploadedAt: order.UploadedAt.Format(time.RFC3339),
-		})
+		}
+		if order.Status == entity.OrderProcessed {
+			accrual := order.Accrual
+			item.Accrual = &accrual
+		}
+		responce = append(responce, item)
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("user_id", userID).
 		Int("order_count", len(orders)).
 		Msg("Orders retrieved successfully")
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"bytes"
+	"gophemart/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithRequestID(t *testing.T, requestID string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	var logged bytes.Buffer
+	e := echo.New()
+	e.Use(RequestIDMiddleware())
+	e.GET("/ping", func(c echo.Context) error {
+		l := logger.FromContext(c.Request().Context()).Output(&logged)
+		l.Info().Msg("ping")
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	if requestID != "" {
+		req.Header.Set(echo.HeaderXRequestID, requestID)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec, logged.String()
+}
+
+func TestRequestIDMiddleware_HonoursIncomingID(t *testing.T) {
+	rec, logged := serveWithRequestID(t, "req-42")
+
+	assert.Equal(t, "req-42", rec.Header().Get(echo.HeaderXRequestID))
+	assert.Contains(t, logged, `"request_id":"req-42"`)
+}
+
+func TestRequestIDMiddleware_GeneratesMissingID(t *testing.T) {
+	rec, logged := serveWithRequestID(t, "")
+
+	requestID := rec.Header().Get(echo.HeaderXRequestID)
+	assert.Len(t, requestID, 36)
+	assert.Contains(t, logged, `"request_id":"`+requestID+`"`)
+}
+
+func TestRequestIDMiddleware_ReplacesInvalidID(t *testing.T) {
+	for name, requestID := range map[string]string{
+		"too long":   strings.Repeat("a", maxRequestIDLength+1),
+		"whitespace": "two words",
+		"control":    "id\x07",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec, _ := serveWithRequestID(t, requestID)
+
+			got := rec.Header().Get(echo.HeaderXRequestID)
+			assert.NotEqual(t, requestID, got)
+			assert.Len(t, got, 36)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"github.com/labstack/echo"
+	"gophemart/internal/app/service"
+	"gophemart/internal/handler/http/openapi"
+	"gophemart/pkg/jwt"
+	"net/http"
+)
+
+type Handlers struct {
+	Auth    *AuthHandler
+	Order   *OrderHandler
+	Balance *BalanceHandler
+	Admin   *AdminHandler
+	Webhook *WebhookHandler
+	Stream  *StreamHandler
+	Health  *HealthHandler
+
+	Idempotency *service.IdempotencyService
+}
+
+func RegisterRoutes(e *echo.Echo, jwtManager *jwt.Manager, adminToken string, h Handlers) {
+	validator := openapi.NewValidator(openapi.MustLoad(), map[string]openapi.FormatChecker{
+		"luhn": isValidLuhn,
+	})
+	validate := ValidationMiddleware(validator)
+
+	e.GET("/healthz", h.Health.Live)
+	e.GET("/readyz", h.Health.Ready)
+
+	api := e.Group("/api")
+
+	api.GET("/openapi.json", OpenAPISpec)
+	api.POST("/user/register", h.Auth.Register, validate)
+	api.POST("/user/login", h.Auth.Login, validate)
+	authGroup := api.Group("")
+
+	authGroup.Use(AuthMiddleware(jwtManager), validate)
+
+	authGroup.POST("/user/orders", h.Order.UploadOrder)
+	authGroup.GET("/user/orders", h.Order.GetOrders)
+	authGroup.GET("/user/orders/stream", h.Stream.StreamOrders)
+	authGroup.GET("/user/balance", h.Balance.GetBalance)
+	authGroup.POST("/user/balance/withdraw", h.Balance.Withdraw, IdempotencyMiddleware(h.Idempotency))
+	authGroup.GET("/user/withdrawals", h.Balance.GetWithdrawals)
+	authGroup.POST("/user/withdrawals/:order/cancel", h.Balance.CancelWithdrawal)
+	authGroup.POST("/user/webhooks", h.Webhook.RegisterWebhook)
+	authGroup.GET("/user/webhooks", h.Webhook.GetWebhooks)
+	authGroup.DELETE("/user/webhooks/:id", h.Webhook.DeleteWebhook)
+	authGroup.GET("/user/webhooks/:id/deliveries", h.Webhook.GetDeliveries)
+
+	adminGroup := api.Group("/admin")
+	adminGroup.Use(AdminMiddleware(adminToken), validate)
+
+	adminGroup.POST("/withdrawals/:order/reverse", h.Admin.ReverseWithdrawal)
+	adminGroup.GET("/orders/parked", h.Admin.GetParkedOrders)
+	adminGroup.POST("/orders/:number/requeue", h.Admin.RequeueOrder)
+	adminGroup.GET("/accrual/stats", h.Admin.GetAccrualStats)
+	adminGroup.GET("/log-level", h.Admin.GetLogLevel)
+	adminGroup.PUT("/log-level", h.Admin.SetLogLevel)
+}
+
+func OpenAPISpec(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, openapi.Spec())
+}
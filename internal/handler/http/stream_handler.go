@@ -0,0 +1,169 @@
+package http
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/service"
+	"gophemart/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	headerLastEventID = "Last-Event-ID"
+	// streamEventReset tells the client that it missed too many events and
+	// must reload its orders and balance.
+	streamEventReset = "reset"
+	// streamDedupeWindow is how many recently sent event IDs a stream
+	// remembers; it must exceed the replay limit and the subscription buffer.
+	streamDedupeWindow = 1024
+	// defaultStreamHeartbeat is used when no positive heartbeat is configured.
+	defaultStreamHeartbeat = 15 * time.Second
+)
+
+type StreamHandler struct {
+	streamService *service.StreamService
+	heartbeat     time.Duration
+}
+
+func NewStreamHandler(streamService *service.StreamService, heartbeat time.Duration) *StreamHandler {
+	if heartbeat <= 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+	return &StreamHandler{streamService: streamService, heartbeat: heartbeat}
+}
+
+// StreamOrders sends the user's order and balance updates as Server-Sent
+// Events. A client that reconnects with Last-Event-ID first receives the
+// events it missed, as long as they are still retained.
+func (h *StreamHandler) StreamOrders(c echo.Context) error {
+	userID, ok := c.Get(userIDKey).(string)
+	if !ok || userID == "" {
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "StreamOrders").Msg("UserID not found in context")
+		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+
+	var lastID uint
+	if raw := c.Request().Header.Get(headerLastEventID); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid Last-Event-ID")
+		}
+		lastID = uint(id)
+	}
+
+	ctx := c.Request().Context()
+
+	// Subscribe before replaying so that nothing committed in between is lost;
+	// events both replayed and received live are sent once.
+	sub := h.streamService.Subscribe(userID)
+	defer h.streamService.Unsubscribe(sub)
+
+	missed, err := h.streamService.Replay(ctx, userID, lastID)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("handler", "StreamOrders").
+			Str("user_id", userID).
+			Msg("Failed to replay user events")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	sent := newSentEvents(streamDedupeWindow)
+	if missed.Truncated {
+		if err := writeReset(res, missed.LatestID); err != nil {
+			return nil
+		}
+	}
+	for _, event := range missed.Events {
+		sent.add(event.ID)
+		if err := writeEvent(res, event); err != nil {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind; the client resumes with Last-Event-ID.
+				return nil
+			}
+			// Events may commit out of ID order, so an ID lower than the last
+			// one sent can still be new.
+			if !sent.add(event.ID) {
+				continue
+			}
+			if err := writeEvent(res, event); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, event entity.UserEvent) error {
+	_, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+	if err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
+// writeReset carries the ID to resume from, so that a client reconnecting
+// after it does not get reset again.
+func writeReset(res *echo.Response, latestID uint) error {
+	_, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: {}\n\n", latestID, streamEventReset)
+	if err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
+// sentEvents remembers the IDs of the last events sent on a stream.
+type sentEvents struct {
+	ring []uint
+	next int
+	ids  map[uint]struct{}
+}
+
+func newSentEvents(size int) *sentEvents {
+	return &sentEvents{ring: make([]uint, 0, size), ids: make(map[uint]struct{}, size)}
+}
+
+// add records id and reports whether it was not sent before.
+func (s *sentEvents) add(id uint) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if len(s.ring) < cap(s.ring) {
+		s.ring = append(s.ring, id)
+	} else {
+		delete(s.ids, s.ring[s.next])
+		s.ring[s.next] = id
+		s.next = (s.next + 1) % len(s.ring)
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,15 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStreamHandler_DefaultsHeartbeat(t *testing.T) {
+	for _, heartbeat := range []time.Duration{0, -time.Second} {
+		assert.Equal(t, defaultStreamHeartbeat, NewStreamHandler(nil, heartbeat).heartbeat)
+	}
+	assert.Equal(t, time.Minute, NewStreamHandler(nil, time.Minute).heartbeat)
+}
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"errors"
+	"github.com/labstack/echo"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/service"
+	"gophemart/internal/handler/http/dto"
+	"gophemart/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+func (h *WebhookHandler) RegisterWebhook(c echo.Context) error {
+	userID, ok := c.Get(userIDKey).(string)
+	if !ok || userID == "" {
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "RegisterWebhook").Msg("UserID not found in context")
+		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+
+	var req dto.RegisterWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	webhook, err := h.webhookService.Register(c.Request().Context(), userID, req.URL, req.Secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidWebhookURL), errors.Is(err, service.ErrInvalidWebhookSecret):
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, service.ErrTooManyWebhooks):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		logger.FromContext(c.Request().Context()).Error().
+			Err(err).
+			Str("handler", "RegisterWebhook").
+			Str("user_id", userID).
+			Msg("Failed to register webhook")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	response := toWebhookResponce(*webhook)
+	response.Secret = webhook.Secret
+	return c.JSON(http.StatusCreated, response)
+}
+
+func (h *WebhookHandler) GetWebhooks(c echo.Context) error {
+	userID, ok := c.Get(userIDKey).(string)
+	if !ok || userID == "" {
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "GetWebhooks").Msg("UserID not found in context")
+		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+
+	webhooks, err := h.webhookService.List(c.Request().Context(), userID)
+	if err != nil {
+		logger.FromContext(c.Request().Context()).Error().
+			Err(err).
+			Str("handler", "GetWebhooks").
+			Str("user_id", userID).
+			Msg("Failed to get webhooks")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	response := make([]dto.WebhookResponce, 0, len(webhooks))
+	for _, w := range webhooks {
+		response = append(response, toWebhookResponce(w))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	userID, ok := c.Get(userIDKey).(string)
+	if !ok || userID == "" {
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "DeleteWebhook").Msg("UserID not found in context")
+		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "webhook not found")
+	}
+
+	err = h.webhookService.Delete(c.Request().Context(), userID, uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "webhook not found")
+		}
+		logger.FromContext(c.Request().Context()).Error().
+			Err(err).
+			Str("handler", "DeleteWebhook").
+			Str("user_id", userID).
+			Msg("Failed to delete webhook")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetDeliveries(c echo.Context) error {
+	userID, ok := c.Get(userIDKey).(string)
+	if !ok || userID == "" {
+		logger.FromContext(c.Request().Context()).Error().Str("handler", "GetDeliveries").Msg("UserID not found in context")
+		return echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "webhook not found")
+	}
+
+	deliveries, err := h.webhookService.RecentDeliveries(c.Request().Context(), userID, uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "webhook not found")
+		}
+		logger.FromContext(c.Request().Context()).Error().
+			Err(err).
+			Str("handler", "GetDeliveries").
+			Str("user_id", userID).
+			Msg("Failed to get webhook deliveries")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	response := make([]dto.WebhookDeliveryResponce, 0, len(deliveries))
+	for _, d := range deliveries {
+		response = append(response, toWebhookDeliveryResponce(d))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func toWebhookResponce(w entity.Webhook) dto.WebhookResponce {
+	return dto.WebhookResponce{
+		ID:        w.ID,
+		URL:       w.URL,
+		CreatedAt: w.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toWebhookDeliveryResponce(d entity.WebhookDelivery) dto.WebhookDeliveryResponce {
+	response := dto.WebhookDeliveryResponce{
+		ID:             d.ID,
+		Event:          d.EventType,
+		Status:         string(d.Status),
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt.Format(time.RFC3339),
+	}
+	if d.LastAttemptAt != nil {
+		response.LastAttemptAt = d.LastAttemptAt.Format(time.RFC3339)
+	}
+	if d.Status == entity.DeliveryPending {
+		response.NextAttemptAt = d.NextAttemptAt.Format(time.RFC3339)
+	}
+	if d.DeliveredAt != nil {
+		response.DeliveredAt = d.DeliveredAt.Format(time.RFC3339)
+	}
+	return response
+}
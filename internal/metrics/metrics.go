@@ -0,0 +1,168 @@
+// Package metrics holds the Prometheus collectors of gophermart and serves
+// them from a dedicated registry.
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gophemart/internal/app/entity"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "gophermart"
+
+var registry = newRegistry()
+
+func newRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return r
+}
+
+var (
+	httpRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route and response status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	accrualRequests = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "requests_total",
+		Help:      "Requests to the accrual service by outcome: the response status or \"error\".",
+	}, []string{"method", "outcome"})
+
+	accrualDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of single requests to the accrual service, retries not included.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+
+	workerCycleDuration = promauto.With(registry).NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "cycle_duration_seconds",
+		Help:      "Duration of order processing cycles.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	workerPendingOrders = promauto.With(registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "pending_orders",
+		Help:      "Orders waiting for a final accrual answer, parked ones excluded.",
+	})
+
+	pointsAccrued = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_accrued_total",
+		Help:      "Points credited to users for processed orders.",
+	})
+
+	pointsWithdrawn = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_withdrawn_total",
+		Help:      "Points withdrawn by users.",
+	})
+)
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// ObserveHTTPRequest records a served request. route is the route pattern,
+// not the raw path, to keep label cardinality bounded.
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveAccrualRequest matches accrual.RequestObserver.
+func ObserveAccrualRequest(method, outcome string, duration time.Duration) {
+	accrualRequests.WithLabelValues(method, outcome).Inc()
+	accrualDuration.WithLabelValues(method, outcome).Observe(duration.Seconds())
+}
+
+func ObserveWorkerCycle(duration time.Duration) {
+	workerCycleDuration.Observe(duration.Seconds())
+}
+
+func SetPendingOrders(count int64) {
+	workerPendingOrders.Set(float64(count))
+}
+
+func AddPointsAccrued(points float64) {
+	pointsAccrued.Add(points)
+}
+
+func AddPointsWithdrawn(points float64) {
+	pointsWithdrawn.Add(points)
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func RegisterDB(db *sql.DB) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// AccrualClient is the part of accrual.Client read at scrape time.
+type AccrualClient interface {
+	BreakerState() entity.AccrualBreakerState
+	CacheStats() entity.AccrualCacheStats
+}
+
+// RegisterAccrualClient exports the circuit breaker state and lookup cache
+// counters of client.
+func RegisterAccrualClient(client AccrualClient) {
+	factory := promauto.With(registry)
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "breaker_open",
+		Help:      "1 while the circuit breaker rejects requests to the accrual service.",
+	}, func() float64 {
+		if client.BreakerState().Open(time.Now()) {
+			return 1
+		}
+		return 0
+	})
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "cache_hits_total",
+		Help:      "Order lookups answered from the cache of final answers.",
+	}, func() float64 { return float64(client.CacheStats().Hits) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "cache_misses_total",
+		Help:      "Order lookups that went on to the accrual service.",
+	}, func() float64 { return float64(client.CacheStats().Misses) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "shared_lookups_total",
+		Help:      "Order lookups that joined a request already in flight.",
+	}, func() float64 { return float64(client.CacheStats().Shared) })
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestHandler_ExposesObservations(t *testing.T) {
+	ObserveHTTPRequest(http.MethodGet, "/api/user/orders", http.StatusOK, 20*time.Millisecond)
+	ObserveAccrualRequest(http.MethodGet, "429", time.Millisecond)
+	ObserveWorkerCycle(time.Second)
+	SetPendingOrders(7)
+	AddPointsAccrued(500)
+	AddPointsWithdrawn(120.5)
+
+	body := scrape(t)
+	assert.Contains(t, body, `gophermart_http_requests_total{method="GET",route="/api/user/orders",status="200"} 1`)
+	assert.Contains(t, body, `gophermart_http_request_duration_seconds_count{method="GET",route="/api/user/orders",status="200"} 1`)
+	assert.Contains(t, body, `gophermart_accrual_requests_total{method="GET",outcome="429"} 1`)
+	assert.Contains(t, body, `gophermart_worker_cycle_duration_seconds_count 1`)
+	assert.Contains(t, body, `gophermart_worker_pending_orders 7`)
+	assert.Contains(t, body, `gophermart_points_accrued_total 500`)
+	assert.Contains(t, body, `gophermart_points_withdrawn_total 120.5`)
+	assert.Contains(t, body, `go_goroutines`)
+}
@@ -0,0 +1,160 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/pkg/logger"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type IdempotencyRepository struct {
+	BaseRepository
+}
+
+func NewIdempotencyRepository(db *gorm.DB) repository.IdempotencyRepository {
+	return &IdempotencyRepository{BaseRepository{db: db}}
+}
+
+func (r *IdempotencyRepository) Create(ctx context.Context, record *entity.IdempotencyRecord) error {
+	logger.FromContext(ctx).Debug().
+		Str("method", "IdempotencyRepository.Create").
+		Str("user_id", record.UserID).
+		Str("idempotency_key", record.Key).
+		Msg("Reserving idempotency key")
+
+	err := r.db.WithContext(ctx).Create(record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "duplicate key") {
+			logger.FromContext(ctx).Debug().
+				Str("method", "IdempotencyRepository.Create").
+				Str("user_id", record.UserID).
+				Str("idempotency_key", record.Key).
+				Msg("Idempotency key already reserved")
+			return ErrDuplicateKey
+		}
+
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "IdempotencyRepository.Create").
+			Str("user_id", record.UserID).
+			Str("idempotency_key", record.Key).
+			Msg("Database error when reserving idempotency key")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Find(ctx context.Context, userID, key string) (*entity.IdempotencyRecord, error) {
+	var record entity.IdempotencyRecord
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND key = ?", userID, key).
+		First(&record).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "IdempotencyRepository.Find").
+			Str("user_id", userID).
+			Str("idempotency_key", key).
+			Msg("Database error when finding idempotency key")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &record, nil
+}
+
+func (r *IdempotencyRepository) Complete(
+	ctx context.Context,
+	id uint,
+	statusCode int,
+	contentType string,
+	body []byte,
+) error {
+	logger.FromContext(ctx).Debug().
+		Str("method", "IdempotencyRepository.Complete").
+		Uint("id", id).
+		Int("status_code", statusCode).
+		Msg("Storing idempotent response")
+
+	result := r.db.WithContext(ctx).
+		Model(&entity.IdempotencyRecord{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"completed":    true,
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"body":         body,
+		})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "IdempotencyRepository.Complete").
+			Uint("id", id).
+			Msg("Database error when storing idempotent response")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Touch(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).
+		Model(&entity.IdempotencyRecord{}).
+		Where("id = ? AND completed = ?", id, false).
+		Update("updated_at", time.Now().UTC())
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "IdempotencyRepository.Touch").
+			Uint("id", id).
+			Msg("Database error when extending idempotency key lock")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Delete(ctx context.Context, id uint) error {
+	err := r.db.WithContext(ctx).
+		Where("id = ?", id).
+		Delete(&entity.IdempotencyRecord{}).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "IdempotencyRepository.Delete").
+			Uint("id", id).
+			Msg("Database error when deleting idempotency key")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpiredBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at < ?", before).
+		Delete(&entity.IdempotencyRecord{})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "IdempotencyRepository.DeleteExpiredBefore").
+			Msg("Database error when deleting expired idempotency keys")
+		return 0, fmt.Errorf("database error: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyRepository_DeleteExpiredBefore(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	rec.rowsAffected = 2
+	before := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	deleted, err := NewIdempotencyRepository(db).DeleteExpiredBefore(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	stmt := rec.last(t)
+	assert.Equal(t, `DELETE FROM "idempotency_records" WHERE expires_at < $1`, stmt.query)
+	assert.Equal(t, []interface{}{before}, stmt.args)
+}
@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"gophemart/pkg/logger"
+	"time"
+)
+
+// listenChannel calls handle with the payload of every notification on
+// channel until ctx is cancelled, reconnecting with backoff when the
+// listening connection is lost.
+func listenChannel(ctx context.Context, dsn, channel string, handle func(payload string)) {
+	const (
+		minBackoff = time.Second
+		maxBackoff = 30 * time.Second
+	)
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := listenOnce(ctx, dsn, channel, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > maxBackoff {
+			backoff = minBackoff
+		}
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Str("channel", channel).
+			Dur("retry_in", backoff).
+			Msg("Notification listener disconnected")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func listenOnce(ctx context.Context, dsn, channel string, handle func(payload string)) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Info().
+		Str("channel", channel).
+		Msg("Listening for notifications")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
@@ -0,0 +1,39 @@
+package postgresql
+
+import (
+	"context"
+	"gophemart/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const orderUploadedChannel = "gophermart_order_uploaded"
+
+// OrderEvents tells every replica about newly uploaded orders through
+// Postgres LISTEN/NOTIFY.
+type OrderEvents struct {
+	BaseRepository
+	dsn string
+}
+
+func NewOrderEvents(db *gorm.DB, dsn string) *OrderEvents {
+	return &OrderEvents{BaseRepository: BaseRepository{db: db}, dsn: dsn}
+}
+
+// OrderUploaded publishes the order number. A lost notification only delays
+// the order until the next fallback sweep, so errors are logged, not returned.
+func (e *OrderEvents) OrderUploaded(ctx context.Context, number string) {
+	err := e.db.WithContext(ctx).
+		Exec("SELECT pg_notify(?, ?)", orderUploadedChannel, number).Error
+	if err != nil {
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Str("method", "OrderEvents.OrderUploaded").
+			Str("order_number", number).
+			Msg("Failed to notify replicas about uploaded order")
+	}
+}
+
+// Listen calls handle for every uploaded order until ctx is cancelled.
+func (e *OrderEvents) Listen(ctx context.Context, handle func(number string)) {
+	listenChannel(ctx, e.dsn, orderUploadedChannel, handle)
+}
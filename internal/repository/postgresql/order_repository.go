@@ -2,13 +2,16 @@ package postgresql
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"gophemart/internal/app/entity"
 	"gophemart/internal/app/repository"
 	"gophemart/pkg/logger"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"strings"
+	"time"
 )
 
 type OrderRepository struct {
@@ -28,7 +31,7 @@ func (r *OrderRepository) GetWithdrawalsByUser(
 	ctx context.Context,
 	userID string,
 ) ([]entity.Withdrawal, error) {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.GetWithdrawalsByUser").
 		Str("user_id", userID).
 		Msg("Fetching user withdrawals")
@@ -37,11 +40,11 @@ func (r *OrderRepository) GetWithdrawalsByUser(
 
 	result := r.db.WithContext(ctx).
 		Where("user_id = ?", userID).
-		Order("processed_at DESC").
+		Order("processed_at ASC").
 		Find(&withdrawals)
 
 	if result.Error != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "OrderRepository.GetWithdrawalsByUser").
 			Str("user_id", userID).
@@ -49,7 +52,7 @@ func (r *OrderRepository) GetWithdrawalsByUser(
 		return nil, fmt.Errorf("database error: %w", result.Error)
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.GetWithdrawalsByUser").
 		Str("user_id", userID).
 		Int("count", len(withdrawals)).
@@ -57,7 +60,7 @@ func (r *OrderRepository) GetWithdrawalsByUser(
 	return withdrawals, nil
 }
 func (r *OrderRepository) Create(ctx context.Context, order *entity.Order) error {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.Create").
 		Str("user_id", order.UserID).
 		Str("order_number", order.Number).
@@ -67,7 +70,7 @@ func (r *OrderRepository) Create(ctx context.Context, order *entity.Order) error
 	err := r.db.WithContext(ctx).Create(order).Error
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key") {
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("method", "OrderRepository.Create").
 				Str("user_id", order.UserID).
 				Str("order_number", order.Number).
@@ -75,7 +78,7 @@ func (r *OrderRepository) Create(ctx context.Context, order *entity.Order) error
 			return ErrDuplicateKey
 		}
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "OrderRepository.Create").
 			Str("user_id", order.UserID).
@@ -84,7 +87,7 @@ func (r *OrderRepository) Create(ctx context.Context, order *entity.Order) error
 		return fmt.Errorf("database error: %w", err)
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.Create").
 		Str("user_id", order.UserID).
 		Str("order_number", order.Number).
@@ -93,7 +96,7 @@ func (r *OrderRepository) Create(ctx context.Context, order *entity.Order) error
 	return nil
 }
 func (r *OrderRepository) FindByNumber(ctx context.Context, number string) (*entity.Order, error) {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindByNumber").
 		Str("order_number", number).
 		Msg("Finding order by number")
@@ -105,14 +108,14 @@ func (r *OrderRepository) FindByNumber(ctx context.Context, number string) (*ent
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Debug().
+			logger.FromContext(ctx).Debug().
 				Str("method", "OrderRepository.FindByNumber").
 				Str("order_number", number).
 				Msg("Order not found")
 			return nil, ErrNotFound
 		}
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "OrderRepository.FindByNumber").
 			Str("order_number", number).
@@ -120,7 +123,7 @@ func (r *OrderRepository) FindByNumber(ctx context.Context, number string) (*ent
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindByNumber").
 		Str("order_number", number).
 		Str("user_id", order.UserID).
@@ -130,15 +133,18 @@ func (r *OrderRepository) FindByNumber(ctx context.Context, number string) (*ent
 }
 
 func (r *OrderRepository) FindByUserID(ctx context.Context, userID string) ([]entity.Order, error) {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindByUserID").
 		Str("user_id", userID).
 		Msg("Finding orders by user ID")
 
 	var orders []entity.Order
-	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&orders)
+	result := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("uploaded_at ASC").
+		Find(&orders)
 	if result.Error != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "OrderRepository.FindByUserID").
 			Str("user_id", userID).
@@ -146,7 +152,7 @@ func (r *OrderRepository) FindByUserID(ctx context.Context, userID string) ([]en
 		return nil, result.Error
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindByUserID").
 		Str("user_id", userID).
 		Int("count", len(orders)).
@@ -155,7 +161,7 @@ func (r *OrderRepository) FindByUserID(ctx context.Context, userID string) ([]en
 }
 
 func (r *OrderRepository) Update(ctx context.Context, order *entity.Order) error {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.Update").
 		Str("order_number", order.Number).
 		Str("status", string(order.Status)).
@@ -164,7 +170,7 @@ func (r *OrderRepository) Update(ctx context.Context, order *entity.Order) error
 
 	result := r.db.WithContext(ctx).Save(order)
 	if result.Error != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "OrderRepository.Update").
 			Str("order_number", order.Number).
@@ -172,7 +178,7 @@ func (r *OrderRepository) Update(ctx context.Context, order *entity.Order) error
 		return result.Error
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.Update").
 		Str("order_number", order.Number).
 		Int64("rows_affected", result.RowsAffected).
@@ -181,7 +187,7 @@ func (r *OrderRepository) Update(ctx context.Context, order *entity.Order) error
 }
 
 func (r *OrderRepository) FindUnprocessed(ctx context.Context) ([]entity.Order, error) {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindUnprocessed").
 		Msg("Finding unprocessed orders")
 
@@ -191,14 +197,14 @@ func (r *OrderRepository) FindUnprocessed(ctx context.Context) ([]entity.Order,
 		Find(&orders).Error
 
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "OrderRepository.FindUnprocessed").
 			Msg("Database error when finding unprocessed orders")
 		return nil, err
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindUnprocessed").
 		Int("count", len(orders)).
 		Msg("Unprocessed orders retrieved successfully")
@@ -206,7 +212,7 @@ func (r *OrderRepository) FindUnprocessed(ctx context.Context) ([]entity.Order,
 }
 
 func (r *OrderRepository) FindPending(ctx context.Context) ([]entity.Order, error) {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindPending").
 		Msg("Finding pending orders")
 
@@ -216,43 +222,140 @@ func (r *OrderRepository) FindPending(ctx context.Context) ([]entity.Order, erro
 		Find(&orders).Error
 
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "OrderRepository.FindPending").
 			Msg("Database error when finding pending orders")
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.FindPending").
 		Int("count", len(orders)).
 		Msg("Pending orders retrieved successfully")
 	return orders, nil
 }
 
+func (r *OrderRepository) CountPending(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("status IN ?", []entity.OrderStatus{entity.OrderNew, entity.OrderProcessing}).
+		Where("parked_at IS NULL").
+		Count(&count).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OrderRepository.CountPending").
+			Msg("Database error when counting pending orders")
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return count, nil
+}
+
 func (r *OrderRepository) UpdateStatus(
 	ctx context.Context,
 	orderNumber string,
 	status entity.OrderStatus,
 	accrual float64,
 ) error {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.UpdateStatus").
 		Str("order_number", orderNumber).
 		Str("new_status", string(status)).
 		Float64("accrual", accrual).
 		Msg("Updating order status")
 
-	err := r.db.WithContext(ctx).
-		Model(&entity.Order{}).
-		Where("number = ?", orderNumber).
-		Updates(map[string]interface{}{
-			"status":  status,
-			"accrual": accrual,
-		}).Error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order entity.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("number = ?", orderNumber).
+			First(&order).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		// Checking under the row lock keeps a stale worker from moving an
+		// order backwards, e.g. PROCESSED -> PROCESSING.
+		if err := entity.ValidateTransition(order.Status, status); err != nil {
+			return err
+		}
+
+		err = tx.Model(&entity.Order{}).
+			Where("id = ?", order.ID).
+			Updates(map[string]interface{}{
+				"status":  status,
+				"accrual": accrual,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		update := entity.OrderUpdate{
+			Number:     order.Number,
+			Status:     status,
+			UploadedAt: order.UploadedAt.Format(time.RFC3339),
+		}
+		if status == entity.OrderProcessed {
+			update.Accrual = &accrual
+		}
+		if err := addUserEvent(tx, order.UserID, entity.UserEventOrder, update); err != nil {
+			return err
+		}
+
+		err = addWebhookDeliveries(tx, order.UserID, entity.EventOrderStatusChanged, entity.OrderStatusChangedEvent{
+			OrderNumber: order.Number,
+			UserID:      order.UserID,
+			Status:      status,
+			Accrual:     accrual,
+			ChangedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		if !status.IsFinal() {
+			return nil
+		}
+		err = addOutboxEvent(tx, entity.EventOrderProcessed, entity.OrderProcessedEvent{
+			OrderNumber: order.Number,
+			UserID:      order.UserID,
+			Status:      status,
+			Accrual:     accrual,
+		})
+		if err != nil {
+			return err
+		}
+
+		if status != entity.OrderProcessed || accrual <= 0 {
+			return nil
+		}
+		err = tx.Model(&entity.User{}).
+			Where("id = ?", order.UserID).
+			Update("current_balance", gorm.Expr("current_balance + ?", accrual)).Error
+		if err != nil {
+			return err
+		}
+		err = addOutboxEvent(tx, entity.EventPointsAccrued, entity.PointsAccruedEvent{
+			OrderNumber: order.Number,
+			UserID:      order.UserID,
+			Amount:      accrual,
+		})
+		if err != nil {
+			return err
+		}
+		return addBalanceEvent(tx, order.UserID)
+	})
 
 	if err != nil {
-		logger.Error().
+		if errors.Is(err, ErrNotFound) || errors.Is(err, entity.ErrIllegalTransition) {
+			return err
+		}
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "OrderRepository.UpdateStatus").
 			Str("order_number", orderNumber).
@@ -260,7 +363,7 @@ func (r *OrderRepository) UpdateStatus(
 		return fmt.Errorf("database error: %w", err)
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.UpdateStatus").
 		Str("order_number", orderNumber).
 		Str("new_status", string(status)).
@@ -272,7 +375,7 @@ func (r *OrderRepository) CreateWithdrawal(
 	ctx context.Context,
 	withdrawal *entity.Withdrawal,
 ) error {
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.CreateWithdrawal").
 		Str("user_id", withdrawal.UserID).
 		Str("order_number", withdrawal.OrderNumber).
@@ -282,7 +385,7 @@ func (r *OrderRepository) CreateWithdrawal(
 	result := r.db.WithContext(ctx).Create(withdrawal)
 	if result.Error != nil {
 		if strings.Contains(result.Error.Error(), "duplicate key") {
-			logger.Warn().
+			logger.FromContext(ctx).Warn().
 				Str("method", "OrderRepository.CreateWithdrawal").
 				Str("user_id", withdrawal.UserID).
 				Str("order_number", withdrawal.OrderNumber).
@@ -290,7 +393,7 @@ func (r *OrderRepository) CreateWithdrawal(
 			return ErrDuplicateWithdrawal
 		}
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "OrderRepository.CreateWithdrawal").
 			Str("user_id", withdrawal.UserID).
@@ -300,7 +403,7 @@ func (r *OrderRepository) CreateWithdrawal(
 		return fmt.Errorf("database error: %w", result.Error)
 	}
 
-	logger.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("method", "OrderRepository.CreateWithdrawal").
 		Str("user_id", withdrawal.UserID).
 		Str("order_number", withdrawal.OrderNumber).
@@ -308,3 +411,235 @@ func (r *OrderRepository) CreateWithdrawal(
 		Msg("Withdrawal record created successfully")
 	return nil
 }
+
+func (r *OrderRepository) ClaimPending(
+	ctx context.Context,
+	limit int,
+	leaseDuration time.Duration,
+) ([]entity.Order, error) {
+	logger.FromContext(ctx).Debug().
+		Str("method", "OrderRepository.ClaimPending").
+		Int("limit", limit).
+		Dur("lease_duration", leaseDuration).
+		Msg("Claiming pending orders")
+
+	var orders []entity.Order
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE orders
+		SET lease_expires_at = NOW() + make_interval(secs => ?)
+		WHERE id IN (
+			SELECT id FROM orders
+			WHERE status IN ?
+			  AND parked_at IS NULL
+			  AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+			  AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+			ORDER BY uploaded_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		leaseDuration.Seconds(),
+		[]entity.OrderStatus{entity.OrderNew, entity.OrderProcessing},
+		limit,
+	).Scan(&orders).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OrderRepository.ClaimPending").
+			Msg("Database error when claiming pending orders")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug().
+		Str("method", "OrderRepository.ClaimPending").
+		Int("count", len(orders)).
+		Msg("Pending orders claimed successfully")
+	return orders, nil
+}
+
+func (r *OrderRepository) ReleaseClaim(ctx context.Context, orderNumber string, leaseExpiresAt time.Time) error {
+	result := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("number = ? AND lease_expires_at = ?", orderNumber, leaseExpiresAt).
+		Update("lease_expires_at", nil)
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "OrderRepository.ReleaseClaim").
+			Str("order_number", orderNumber).
+			Msg("Database error when releasing order claim")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return repository.ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *OrderRepository) MarkRegistered(ctx context.Context, orderNumber string) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("number = ?", orderNumber).
+		Update("accrual_registered_at", time.Now()).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OrderRepository.MarkRegistered").
+			Str("order_number", orderNumber).
+			Msg("Database error when marking order registered")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+func (r *OrderRepository) ScheduleRetry(
+	ctx context.Context,
+	orderNumber string,
+	leaseExpiresAt time.Time,
+	attemptCount int,
+	nextAttemptAt time.Time,
+	lastError string,
+) error {
+	logger.FromContext(ctx).Debug().
+		Str("method", "OrderRepository.ScheduleRetry").
+		Str("order_number", orderNumber).
+		Int("attempt_count", attemptCount).
+		Time("next_attempt_at", nextAttemptAt).
+		Msg("Scheduling order retry")
+
+	result := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("number = ? AND lease_expires_at = ?", orderNumber, leaseExpiresAt).
+		Updates(map[string]interface{}{
+			"attempt_count":    attemptCount,
+			"next_attempt_at":  nextAttemptAt,
+			"last_error":       lastError,
+			"lease_expires_at": nil,
+		})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "OrderRepository.ScheduleRetry").
+			Str("order_number", orderNumber).
+			Msg("Database error when scheduling order retry")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return repository.ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *OrderRepository) Park(
+	ctx context.Context,
+	orderNumber string,
+	leaseExpiresAt time.Time,
+	attemptCount int,
+	lastError string,
+) error {
+	logger.FromContext(ctx).Warn().
+		Str("method", "OrderRepository.Park").
+		Str("order_number", orderNumber).
+		Int("attempt_count", attemptCount).
+		Str("last_error", lastError).
+		Msg("Parking order")
+
+	result := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("number = ? AND lease_expires_at = ?", orderNumber, leaseExpiresAt).
+		Updates(map[string]interface{}{
+			"attempt_count":    attemptCount,
+			"last_error":       lastError,
+			"parked_at":        time.Now().UTC(),
+			"next_attempt_at":  nil,
+			"lease_expires_at": nil,
+		})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "OrderRepository.Park").
+			Str("order_number", orderNumber).
+			Msg("Database error when parking order")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return repository.ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *OrderRepository) FindParked(ctx context.Context) ([]entity.Order, error) {
+	var orders []entity.Order
+	err := r.db.WithContext(ctx).
+		Where("parked_at IS NOT NULL").
+		Order("parked_at ASC").
+		Find(&orders).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OrderRepository.FindParked").
+			Msg("Database error when finding parked orders")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return orders, nil
+}
+
+func (r *OrderRepository) Requeue(ctx context.Context, orderNumber string) error {
+	logger.FromContext(ctx).Info().
+		Str("method", "OrderRepository.Requeue").
+		Str("order_number", orderNumber).
+		Msg("Requeueing parked order")
+
+	result := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Where("number = ? AND parked_at IS NOT NULL", orderNumber).
+		Updates(map[string]interface{}{
+			"attempt_count":   0,
+			"last_error":      "",
+			"parked_at":       nil,
+			"next_attempt_at": nil,
+		})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "OrderRepository.Requeue").
+			Str("order_number", orderNumber).
+			Msg("Database error when requeueing order")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *OrderRepository) NextAttemptAt(ctx context.Context) (*time.Time, error) {
+	var next sql.NullTime
+	err := r.db.WithContext(ctx).
+		Model(&entity.Order{}).
+		Select("MIN(next_attempt_at)").
+		Where("status IN ?", []entity.OrderStatus{entity.OrderNew, entity.OrderProcessing}).
+		Where("parked_at IS NULL AND next_attempt_at IS NOT NULL").
+		Where("lease_expires_at IS NULL OR lease_expires_at < NOW()").
+		Row().
+		Scan(&next)
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OrderRepository.NextAttemptAt").
+			Msg("Database error when finding next order attempt")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if !next.Valid {
+		return nil, nil
+	}
+	return &next.Time, nil
+}
@@ -0,0 +1,181 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// recorder is a database/sql connector that records the statements sent by
+// GORM and answers them with canned results, so that the SQL built by the
+// repository can be checked without a database.
+type recorder struct {
+	mu           sync.Mutex
+	statements   []statement
+	rowsAffected int64
+	columns      []string
+	rows         [][]driver.Value
+}
+
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+func newRecordingDB(t *testing.T) (*gorm.DB, *recorder) {
+	t.Helper()
+	rec := &recorder{rowsAffected: 1}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(rec)}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	require.NoError(t, err)
+	return db, rec
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return &recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                        { return recorderDriver{r} }
+
+// last returns the most recent statement.
+func (r *recorder) last(t *testing.T) statement {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	require.NotEmpty(t, r.statements)
+	return r.statements[len(r.statements)-1]
+}
+
+func (r *recorder) record(query string, args []driver.NamedValue) {
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, statement{query: query, args: values})
+}
+
+type recorderDriver struct{ r *recorder }
+
+func (d recorderDriver) Open(string) (driver.Conn, error) { return &recorderConn{d.r}, nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c *recorderConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *recorderConn) Close() error              { return nil }
+func (c *recorderConn) Begin() (driver.Tx, error) { return recorderTx{}, nil }
+
+func (c *recorderConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.r.record(query, args)
+	return driver.RowsAffected(c.r.rowsAffected), nil
+}
+
+func (c *recorderConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.r.record(query, args)
+	return &recorderRows{columns: c.r.columns, rows: c.r.rows}, nil
+}
+
+type recorderTx struct{}
+
+func (recorderTx) Commit() error   { return nil }
+func (recorderTx) Rollback() error { return nil }
+
+type recorderRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *recorderRows) Columns() []string { return r.columns }
+func (r *recorderRows) Close() error      { return nil }
+
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestOrderRepository_ClaimPendingLeasesDueOrders(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	lease := time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	rec.columns = []string{"number", "status", "lease_expires_at"}
+	rec.rows = [][]driver.Value{{"12345678903", string(entity.OrderNew), lease}}
+
+	orders, err := NewOrderRepository(db).ClaimPending(context.Background(), 10, 30*time.Second)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "12345678903", orders[0].Number)
+	require.NotNil(t, orders[0].LeaseExpiresAt)
+	assert.True(t, lease.Equal(*orders[0].LeaseExpiresAt), "the claimed lease must be returned to the caller")
+
+	stmt := rec.last(t)
+	assert.Contains(t, stmt.query, "SET lease_expires_at = NOW() + make_interval(secs => $1)")
+	assert.Contains(t, stmt.query, "AND parked_at IS NULL")
+	assert.Contains(t, stmt.query, "AND (lease_expires_at IS NULL OR lease_expires_at < NOW())")
+	assert.Contains(t, stmt.query, "AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())")
+	assert.Contains(t, stmt.query, "FOR UPDATE SKIP LOCKED")
+	assert.Contains(t, stmt.query, "RETURNING *")
+	assert.Equal(t, []interface{}{30.0, string(entity.OrderNew), string(entity.OrderProcessing), int64(10)}, stmt.args)
+}
+
+func TestOrderRepository_ReleaseIsGuardedByLease(t *testing.T) {
+	lease := time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	tests := []struct {
+		name    string
+		release func(r repository.OrderRepository) error
+	}{
+		{
+			name: "release claim",
+			release: func(r repository.OrderRepository) error {
+				return r.ReleaseClaim(context.Background(), "12345678903", lease)
+			},
+		},
+		{
+			name: "schedule retry",
+			release: func(r repository.OrderRepository) error {
+				return r.ScheduleRetry(context.Background(), "12345678903", lease, 2, time.Now(), "timeout")
+			},
+		},
+		{
+			name: "park",
+			release: func(r repository.OrderRepository) error {
+				return r.Park(context.Background(), "12345678903", lease, 10, "timeout")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newRecordingDB(t)
+			repo := NewOrderRepository(db)
+
+			require.NoError(t, tt.release(repo))
+			stmt := rec.last(t)
+			assert.Regexp(t, `^UPDATE "orders" SET .*"lease_expires_at"=\$\d+`, stmt.query)
+			assert.Regexp(t, `WHERE number = \$\d+ AND lease_expires_at = \$\d+`, stmt.query)
+			require.GreaterOrEqual(t, len(stmt.args), 2)
+			assert.Equal(t, "12345678903", stmt.args[len(stmt.args)-2])
+			assert.Equal(t, lease, stmt.args[len(stmt.args)-1])
+
+			rec.rowsAffected = 0
+			assert.ErrorIs(t, tt.release(repo), repository.ErrLeaseLost,
+				"an order re-claimed by another worker must not be touched")
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/pkg/logger"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+type OutboxRepository struct {
+	BaseRepository
+}
+
+func NewOutboxRepository(db *gorm.DB) repository.OutboxRepository {
+	return &OutboxRepository{BaseRepository{db: db}}
+}
+
+// addOutboxEvent writes an event inside the caller's transaction so that it is
+// published if and only if the change it describes commits.
+func addOutboxEvent(tx *gorm.DB, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", eventType, err)
+	}
+	return tx.Create(&entity.OutboxEvent{
+		Type:          eventType,
+		Payload:       data,
+		NextAttemptAt: time.Now().UTC(),
+	}).Error
+}
+
+func (r *OutboxRepository) ClaimBatch(
+	ctx context.Context,
+	limit int,
+	leaseDuration time.Duration,
+) ([]entity.OutboxEvent, error) {
+	var events []entity.OutboxEvent
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE outbox
+		SET next_attempt_at = NOW() + make_interval(secs => ?)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL
+			  AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		leaseDuration.Seconds(),
+		limit,
+	).Scan(&events).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OutboxRepository.ClaimBatch").
+			Msg("Database error when claiming outbox events")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	// RETURNING does not preserve the subquery order.
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, id uint) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"published_at": time.Now().UTC(),
+			"last_error":   "",
+		}).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OutboxRepository.MarkPublished").
+			Uint("event_id", id).
+			Msg("Database error when marking outbox event published")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+func (r *OutboxRepository) ScheduleRetry(
+	ctx context.Context,
+	id uint,
+	attempts int,
+	nextAttemptAt time.Time,
+	lastError string,
+) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        attempts,
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      lastError,
+		}).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "OutboxRepository.ScheduleRetry").
+			Uint("event_id", id).
+			Msg("Database error when scheduling outbox event retry")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+func (r *OutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("published_at IS NOT NULL AND published_at < ?", before).
+		Delete(&entity.OutboxEvent{})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "OutboxRepository.DeletePublishedBefore").
+			Msg("Database error when deleting published outbox events")
+		return 0, fmt.Errorf("database error: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -6,14 +6,23 @@ import (
 )
 
 type Repository struct {
-	User       repository.UserRepository
-	Order      repository.OrderRepository
-	Withdrawal repository.WithdrawalRepository
+	User        repository.UserRepository
+	Order       repository.OrderRepository
+	Withdrawal  repository.WithdrawalRepository
+	Idempotency repository.IdempotencyRepository
+	Outbox      repository.OutboxRepository
+	Webhook     repository.WebhookRepository
+	UserEvent   repository.UserEventRepository
 }
 
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{
-		User:  NewUserRepository(db),
-		Order: NewOrderRepository(db),
+		User:        NewUserRepository(db),
+		Order:       NewOrderRepository(db),
+		Withdrawal:  NewWithdrawalRepository(db),
+		Idempotency: NewIdempotencyRepository(db),
+		Outbox:      NewOutboxRepository(db),
+		Webhook:     NewWebhookRepository(db),
+		UserEvent:   NewUserEventRepository(db),
 	}
 }
@@ -0,0 +1,143 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/pkg/logger"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const userEventsChannel = "gophermart_user_events"
+
+type UserEventRepository struct {
+	BaseRepository
+}
+
+func NewUserEventRepository(db *gorm.DB) repository.UserEventRepository {
+	return &UserEventRepository{BaseRepository{db: db}}
+}
+
+// addUserEvent records a stream event inside the caller's transaction.
+// Postgres delivers the notification only if the transaction commits.
+func addUserEvent(tx *gorm.DB, userID, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", eventType, err)
+	}
+	event := &entity.UserEvent{UserID: userID, Type: eventType, Payload: data}
+	if err := tx.Create(event).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", userEventsChannel, userID+":"+strconv.FormatUint(uint64(event.ID), 10)).Error
+}
+
+// addBalanceEvent records the user's balance as of the caller's transaction.
+func addBalanceEvent(tx *gorm.DB, userID string) error {
+	var user entity.User
+	if err := tx.Select("current_balance", "withdrawn").Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	return addUserEvent(tx, userID, entity.UserEventBalance, entity.BalanceUpdate{
+		Current:   user.CurrentBalance,
+		Withdrawn: user.Withdrawn,
+	})
+}
+
+// ListenUserEvents calls handle for every committed user event on any
+// replica until ctx is cancelled.
+func ListenUserEvents(ctx context.Context, dsn string, handle func(userID string, eventID uint)) {
+	listenChannel(ctx, dsn, userEventsChannel, func(payload string) {
+		userID, rawID, ok := strings.Cut(payload, ":")
+		id, err := strconv.ParseUint(rawID, 10, 64)
+		if !ok || err != nil {
+			logger.FromContext(ctx).Warn().
+				Str("payload", payload).
+				Msg("Ignoring malformed user event notification")
+			return
+		}
+		handle(userID, uint(id))
+	})
+}
+
+func (r *UserEventRepository) FindByID(ctx context.Context, id uint) (*entity.UserEvent, error) {
+	var event entity.UserEvent
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&event).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "UserEventRepository.FindByID").
+			Uint("event_id", id).
+			Msg("Database error when finding user event")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &event, nil
+}
+
+func (r *UserEventRepository) FindAfter(
+	ctx context.Context,
+	userID string,
+	afterID uint,
+	limit int,
+) ([]entity.UserEvent, error) {
+	var events []entity.UserEvent
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND id > ?", userID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "UserEventRepository.FindAfter").
+			Str("user_id", userID).
+			Uint("after_id", afterID).
+			Msg("Database error when finding user events")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return events, nil
+}
+
+func (r *UserEventRepository) LatestID(ctx context.Context, userID string) (uint, error) {
+	var latest uint
+	err := r.db.WithContext(ctx).
+		Model(&entity.UserEvent{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&latest).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "UserEventRepository.LatestID").
+			Str("user_id", userID).
+			Msg("Database error when finding latest user event")
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return latest, nil
+}
+
+func (r *UserEventRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("created_at < ?", before).
+		Delete(&entity.UserEvent{})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "UserEventRepository.DeleteBefore").
+			Msg("Database error when deleting old user events")
+		return 0, fmt.Errorf("database error: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
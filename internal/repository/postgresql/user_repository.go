@@ -22,7 +22,7 @@ func (r *UserRepository) Create(ctx context.Context, user *entity.User) error {
 	result := r.db.WithContext(ctx).Create(user)
 	if result.Error != nil {
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "UserRepository.Create").
 			Str("login", user.Login).
@@ -30,7 +30,7 @@ func (r *UserRepository) Create(ctx context.Context, user *entity.User) error {
 			Msg("Failed to create user in database")
 		return fmt.Errorf("database error: %w", result.Error)
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.Create").
 		Str("login", user.Login).
 		Str("user_id", fmt.Sprintf("%d", user.ID)).
@@ -44,7 +44,7 @@ func (r *UserRepository) FindByLogin(ctx context.Context, login string) (*entity
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			logger.Error().
+			logger.FromContext(ctx).Error().
 				Err(repository.ErrRocordNotFound).
 				Str("method", "UserRepository.FindByLogin").
 				Str("login", login).
@@ -52,14 +52,14 @@ func (r *UserRepository) FindByLogin(ctx context.Context, login string) (*entity
 
 			return nil, repository.ErrRocordNotFound
 		}
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "UserRepository.FindByLogin").
 			Str("login", login).
 			Msg("Database error when finding user by login")
 		return nil, result.Error
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.FindByLogin").
 		Str("login", login).
 		Str("user_id", fmt.Sprintf("%d", user.ID)).
@@ -68,7 +68,7 @@ func (r *UserRepository) FindByLogin(ctx context.Context, login string) (*entity
 }
 
 func (r *UserRepository) FindByID(ctx context.Context, userID string) (*entity.User, error) {
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.FindByID").
 		Str("user_id", userID).
 		Msg("Updating user balance")
@@ -78,7 +78,7 @@ func (r *UserRepository) FindByID(ctx context.Context, userID string) (*entity.U
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			logger.Error().
+			logger.FromContext(ctx).Error().
 				Err(ErrNotFound).
 				Str("method", "UserRepository.FindByID").
 				Str("user_id", userID).
@@ -86,14 +86,14 @@ func (r *UserRepository) FindByID(ctx context.Context, userID string) (*entity.U
 
 			return nil, ErrNotFound
 		}
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "UserRepository.FindByID").
 			Str("user_id", userID).
 			Msg("Database error when finding user by ID")
 		return nil, fmt.Errorf("database error: %w", result.Error)
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.FindByID").
 		Str("user_id", userID).
 		Msg("User found by ID")
@@ -101,7 +101,7 @@ func (r *UserRepository) FindByID(ctx context.Context, userID string) (*entity.U
 }
 
 func (r *UserRepository) UpdateBalance(ctx context.Context, userID string, newBalance, newWithdrawn float64) error {
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.UpdateBalance").
 		Str("user_id", userID).
 		Float64("new_balance", newBalance).
@@ -117,7 +117,7 @@ func (r *UserRepository) UpdateBalance(ctx context.Context, userID string, newBa
 		})
 
 	if result.Error != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(result.Error).
 			Str("method", "UserRepository.UpdateBalance").
 			Str("user_id", userID).
@@ -125,13 +125,13 @@ func (r *UserRepository) UpdateBalance(ctx context.Context, userID string, newBa
 		return fmt.Errorf("database error: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Str("method", "UserRepository.UpdateBalance").
 			Str("user_id", userID).
 			Msg("No rows affected when updating balance - user not found")
 		return fmt.Errorf("database error: %w", result.Error)
 	}
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.UpdateBalance").
 		Str("user_id", userID).
 		Int64("rows_affected", result.RowsAffected).
@@ -140,7 +140,7 @@ func (r *UserRepository) UpdateBalance(ctx context.Context, userID string, newBa
 }
 
 func (r *UserRepository) AddBalance(ctx context.Context, userID string, amount float64) error {
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.AddToBalance").
 		Str("user_id", userID).
 		Float64("amount", amount).
@@ -152,7 +152,7 @@ func (r *UserRepository) AddBalance(ctx context.Context, userID string, amount f
 		Update("current_balance", gorm.Expr("current_balance + ?", amount)).Error
 
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "UserRepository.AddToBalance").
 			Str("user_id", userID).
@@ -161,7 +161,7 @@ func (r *UserRepository) AddBalance(ctx context.Context, userID string, amount f
 		return fmt.Errorf("database error: %w", err)
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.AddToBalance").
 		Str("user_id", userID).
 		Float64("amount", amount).
@@ -170,7 +170,7 @@ func (r *UserRepository) AddBalance(ctx context.Context, userID string, amount f
 }
 
 func (r *UserRepository) CreateWithdrawal(ctx context.Context, withdrawal *entity.Withdrawal) error {
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.CreateWithdrawal").
 		Str("user_id", withdrawal.UserID).
 		Str("order_number", withdrawal.OrderNumber).
@@ -179,7 +179,7 @@ func (r *UserRepository) CreateWithdrawal(ctx context.Context, withdrawal *entit
 
 	err := r.db.WithContext(ctx).Create(withdrawal).Error
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("method", "UserRepository.CreateWithdrawal").
 			Str("user_id", withdrawal.UserID).
@@ -189,7 +189,7 @@ func (r *UserRepository) CreateWithdrawal(ctx context.Context, withdrawal *entit
 		return fmt.Errorf("database error: %w", err)
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Str("method", "UserRepository.CreateWithdrawal").
 		Str("user_id", withdrawal.UserID).
 		Str("order_number", withdrawal.OrderNumber).
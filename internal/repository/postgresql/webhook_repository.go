@@ -0,0 +1,249 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/pkg/logger"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+type WebhookRepository struct {
+	BaseRepository
+}
+
+func NewWebhookRepository(db *gorm.DB) repository.WebhookRepository {
+	return &WebhookRepository{BaseRepository{db: db}}
+}
+
+// addWebhookDeliveries queues the event for every webhook of the user inside
+// the caller's transaction.
+func addWebhookDeliveries(tx *gorm.DB, userID, eventType string, payload interface{}) error {
+	var webhooks []entity.Webhook
+	if err := tx.Where("user_id = ?", userID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", eventType, err)
+	}
+	now := time.Now().UTC()
+	deliveries := make([]entity.WebhookDelivery, 0, len(webhooks))
+	for _, w := range webhooks {
+		deliveries = append(deliveries, entity.WebhookDelivery{
+			WebhookID:     w.ID,
+			UserID:        userID,
+			EventType:     eventType,
+			Payload:       data,
+			Status:        entity.DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return tx.Omit("Webhook").Create(&deliveries).Error
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *entity.Webhook) error {
+	if err := r.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WebhookRepository.Create").
+			Str("user_id", webhook.UserID).
+			Msg("Database error when creating webhook")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) FindByUserID(ctx context.Context, userID string) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&webhooks).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WebhookRepository.FindByUserID").
+			Str("user_id", userID).
+			Msg("Database error when finding webhooks")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, userID string, id uint) error {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		Delete(&entity.Webhook{})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "WebhookRepository.Delete").
+			Str("user_id", userID).
+			Uint("webhook_id", id).
+			Msg("Database error when deleting webhook")
+		return fmt.Errorf("database error: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) FindDeliveries(
+	ctx context.Context,
+	userID string,
+	webhookID uint,
+	limit int,
+) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("webhook_id = ? AND user_id = ?", webhookID, userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WebhookRepository.FindDeliveries").
+			Str("user_id", userID).
+			Uint("webhook_id", webhookID).
+			Msg("Database error when finding webhook deliveries")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) ClaimDeliveries(
+	ctx context.Context,
+	limit int,
+	leaseDuration time.Duration,
+) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`
+			UPDATE webhook_deliveries
+			SET next_attempt_at = NOW() + make_interval(secs => ?)
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = ?
+				  AND next_attempt_at <= NOW()
+				ORDER BY id
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *`,
+			leaseDuration.Seconds(),
+			entity.DeliveryPending,
+			limit,
+		).Scan(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		for _, d := range deliveries {
+			ids = append(ids, d.WebhookID)
+		}
+		var webhooks []entity.Webhook
+		if err := tx.Where("id IN ?", ids).Find(&webhooks).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]*entity.Webhook, len(webhooks))
+		for i := range webhooks {
+			byID[webhooks[i].ID] = &webhooks[i]
+		}
+		for i := range deliveries {
+			deliveries[i].Webhook = byID[deliveries[i].WebhookID]
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WebhookRepository.ClaimDeliveries").
+			Msg("Database error when claiming webhook deliveries")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id uint, attempts, statusCode int) error {
+	now := time.Now().UTC()
+	return r.updateDelivery(ctx, "WebhookRepository.MarkDelivered", id, map[string]interface{}{
+		"status":           entity.DeliveryDelivered,
+		"attempts":         attempts,
+		"last_status_code": statusCode,
+		"last_error":       "",
+		"last_attempt_at":  now,
+		"delivered_at":     now,
+	})
+}
+
+func (r *WebhookRepository) RecordFailure(
+	ctx context.Context,
+	id uint,
+	attempts, statusCode int,
+	lastError string,
+	nextAttemptAt *time.Time,
+) error {
+	updates := map[string]interface{}{
+		"attempts":         attempts,
+		"last_status_code": statusCode,
+		"last_error":       lastError,
+		"last_attempt_at":  time.Now().UTC(),
+	}
+	if nextAttemptAt != nil {
+		updates["next_attempt_at"] = *nextAttemptAt
+	} else {
+		updates["status"] = entity.DeliveryFailed
+	}
+	return r.updateDelivery(ctx, "WebhookRepository.RecordFailure", id, updates)
+}
+
+func (r *WebhookRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status <> ? AND created_at < ?", entity.DeliveryPending, before).
+		Delete(&entity.WebhookDelivery{})
+
+	if result.Error != nil {
+		logger.FromContext(ctx).Error().
+			Err(result.Error).
+			Str("method", "WebhookRepository.DeleteFinishedBefore").
+			Msg("Database error when deleting finished webhook deliveries")
+		return 0, fmt.Errorf("database error: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *WebhookRepository) updateDelivery(ctx context.Context, method string, id uint, updates map[string]interface{}) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", method).
+			Uint("delivery_id", id).
+			Msg("Database error when updating webhook delivery")
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package postgresql
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRepository_DeleteFinishedBeforeKeepsPending(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	rec.rowsAffected = 4
+	before := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	deleted, err := NewWebhookRepository(db).DeleteFinishedBefore(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+
+	stmt := rec.last(t)
+	assert.Equal(t, `DELETE FROM "webhook_deliveries" WHERE status <> $1 AND created_at < $2`, stmt.query)
+	assert.Equal(t, []interface{}{string(entity.DeliveryPending), before}, stmt.args)
+}
@@ -0,0 +1,229 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInsufficientBalance  = errors.New("insufficient balance")
+	ErrWithdrawalReversed   = errors.New("withdrawal already reversed")
+	ErrReversalWindowClosed = errors.New("reversal window closed")
+)
+
+type WithdrawalRepository struct {
+	BaseRepository
+}
+
+func NewWithdrawalRepository(db *gorm.DB) repository.WithdrawalRepository {
+	return &WithdrawalRepository{BaseRepository{db: db}}
+}
+
+func (r *WithdrawalRepository) Withdraw(ctx context.Context, withdrawal *entity.Withdrawal) error {
+	logger.FromContext(ctx).Debug().
+		Str("method", "WithdrawalRepository.Withdraw").
+		Str("user_id", withdrawal.UserID).
+		Str("order_number", withdrawal.OrderNumber).
+		Float64("sum", withdrawal.Sum).
+		Msg("Withdrawing from user balance")
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user entity.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", withdrawal.UserID).
+			First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := tx.Create(withdrawal).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "duplicate key") {
+				return ErrDuplicateWithdrawal
+			}
+			return err
+		}
+
+		if user.CurrentBalance < withdrawal.Sum {
+			return ErrInsufficientBalance
+		}
+
+		err = tx.Model(&entity.User{}).
+			Where("id = ?", withdrawal.UserID).
+			Updates(map[string]interface{}{
+				"current_balance": gorm.Expr("current_balance - ?", withdrawal.Sum),
+				"withdrawn":       gorm.Expr("withdrawn + ?", withdrawal.Sum),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		err = addOutboxEvent(tx, entity.EventPointsWithdrawn, entity.PointsWithdrawnEvent{
+			OrderNumber: withdrawal.OrderNumber,
+			UserID:      withdrawal.UserID,
+			Amount:      withdrawal.Sum,
+		})
+		if err != nil {
+			return err
+		}
+		return addBalanceEvent(tx, withdrawal.UserID)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDuplicateWithdrawal):
+			logger.FromContext(ctx).Warn().
+				Str("method", "WithdrawalRepository.Withdraw").
+				Str("user_id", withdrawal.UserID).
+				Str("order_number", withdrawal.OrderNumber).
+				Msg("Duplicate withdrawal detected")
+			return ErrDuplicateWithdrawal
+		case errors.Is(err, ErrInsufficientBalance), errors.Is(err, ErrNotFound):
+			return err
+		}
+
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WithdrawalRepository.Withdraw").
+			Str("user_id", withdrawal.UserID).
+			Str("order_number", withdrawal.OrderNumber).
+			Float64("sum", withdrawal.Sum).
+			Msg("Database error when withdrawing")
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug().
+		Str("method", "WithdrawalRepository.Withdraw").
+		Str("user_id", withdrawal.UserID).
+		Str("order_number", withdrawal.OrderNumber).
+		Float64("sum", withdrawal.Sum).
+		Msg("Withdrawal committed successfully")
+	return nil
+}
+
+func (r *WithdrawalRepository) FindByUserID(ctx context.Context, userID string) ([]entity.Withdrawal, error) {
+	var withdrawals []entity.Withdrawal
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("processed_at ASC").
+		Find(&withdrawals).Error
+
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WithdrawalRepository.FindByUserID").
+			Str("user_id", userID).
+			Msg("Database error when finding withdrawals")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return withdrawals, nil
+}
+
+func (r *WithdrawalRepository) Reverse(
+	ctx context.Context,
+	userID, orderNumber, reason string,
+	processedAfter time.Time,
+) (*entity.Withdrawal, error) {
+	logger.FromContext(ctx).Debug().
+		Str("method", "WithdrawalRepository.Reverse").
+		Str("user_id", userID).
+		Str("order_number", orderNumber).
+		Str("reason", reason).
+		Msg("Reversing withdrawal")
+
+	var withdrawal entity.Withdrawal
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_number = ?", orderNumber)
+		if userID != "" {
+			query = query.Where("user_id = ?", userID)
+		}
+		if err := query.First(&withdrawal).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if withdrawal.Status == entity.WithdrawalReversed {
+			return ErrWithdrawalReversed
+		}
+		if !processedAfter.IsZero() && withdrawal.ProcessedAt.Before(processedAfter) {
+			return ErrReversalWindowClosed
+		}
+
+		now := time.Now().UTC()
+		err := tx.Model(&entity.Withdrawal{}).
+			Where("id = ?", withdrawal.ID).
+			Updates(map[string]interface{}{
+				"status":          entity.WithdrawalReversed,
+				"reversal_reason": reason,
+				"reversed_at":     now,
+			}).Error
+		if err != nil {
+			return err
+		}
+		withdrawal.Status = entity.WithdrawalReversed
+		withdrawal.ReversalReason = reason
+		withdrawal.ReversedAt = &now
+
+		err = tx.Model(&entity.User{}).
+			Where("id = ?", withdrawal.UserID).
+			Updates(map[string]interface{}{
+				"current_balance": gorm.Expr("current_balance + ?", withdrawal.Sum),
+				"withdrawn":       gorm.Expr("withdrawn - ?", withdrawal.Sum),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		err = addOutboxEvent(tx, entity.EventWithdrawalReversed, entity.WithdrawalReversedEvent{
+			OrderNumber: withdrawal.OrderNumber,
+			UserID:      withdrawal.UserID,
+			Amount:      withdrawal.Sum,
+			Reason:      reason,
+		})
+		if err != nil {
+			return err
+		}
+		return addBalanceEvent(tx, withdrawal.UserID)
+	})
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrWithdrawalReversed) || errors.Is(err, ErrReversalWindowClosed) {
+			logger.FromContext(ctx).Warn().
+				Err(err).
+				Str("method", "WithdrawalRepository.Reverse").
+				Str("user_id", userID).
+				Str("order_number", orderNumber).
+				Msg("Withdrawal cannot be reversed")
+			return nil, err
+		}
+
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("method", "WithdrawalRepository.Reverse").
+			Str("user_id", userID).
+			Str("order_number", orderNumber).
+			Msg("Database error when reversing withdrawal")
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug().
+		Str("method", "WithdrawalRepository.Reverse").
+		Str("user_id", withdrawal.UserID).
+		Str("order_number", orderNumber).
+		Float64("sum", withdrawal.Sum).
+		Msg("Withdrawal reversed successfully")
+	return &withdrawal, nil
+}
@@ -0,0 +1,46 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"gophemart/internal/app/entity"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithdrawalRepository_ReverseWritesOutboxEvent(t *testing.T) {
+	db, rec := newRecordingDB(t)
+	rec.columns = []string{"id", "user_id", "order_number", "sum", "status", "processed_at"}
+	rec.rows = [][]driver.Value{{int64(7), "42", "2377225624", 100.0, string(entity.WithdrawalCompleted), time.Now()}}
+
+	withdrawal, err := NewWithdrawalRepository(db).Reverse(context.Background(), "42", "2377225624", "refund", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, entity.WithdrawalReversed, withdrawal.Status)
+
+	var payload []byte
+	for _, stmt := range rec.statements {
+		if !strings.HasPrefix(stmt.query, `INSERT INTO "outbox"`) {
+			continue
+		}
+		require.Contains(t, stmt.args, entity.EventWithdrawalReversed)
+		for _, arg := range stmt.args {
+			if b, ok := arg.([]byte); ok {
+				payload = b
+			}
+		}
+	}
+	require.NotNil(t, payload, "the reversal must be written to the outbox in the same transaction")
+	var event entity.WithdrawalReversedEvent
+	require.NoError(t, json.Unmarshal(payload, &event))
+	assert.Equal(t, entity.WithdrawalReversedEvent{
+		OrderNumber: "2377225624",
+		UserID:      "42",
+		Amount:      100,
+		Reason:      "refund",
+	}, event)
+}
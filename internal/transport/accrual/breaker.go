@@ -0,0 +1,108 @@
+package accrual
+
+import (
+	"gophemart/internal/app/entity"
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops calls to the accrual service after threshold
+// consecutive failures and probes it again once openTimeout has passed.
+type CircuitBreaker struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	threshold   int
+	openTimeout time.Duration
+
+	status    entity.AccrualBreakerStatus
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewCircuitBreaker creates a breaker. A threshold below one disables it.
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	if openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	return &CircuitBreaker{
+		now:         time.Now,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+	}
+}
+
+// Allow reports whether a request may be sent. In the half-open state only
+// one request at a time is allowed.
+func (b *CircuitBreaker) Allow() error {
+	if b.threshold < 1 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.status {
+	case entity.AccrualBreakerOpen:
+		if b.now().Before(b.openUntil) {
+			return entity.ErrAccrualCircuitOpen
+		}
+		b.status = entity.AccrualBreakerHalfOpen
+		b.probing = true
+		return nil
+	case entity.AccrualBreakerHalfOpen:
+		if b.probing {
+			return entity.ErrAccrualCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// OnSuccess records a request that reached a healthy accrual service.
+func (b *CircuitBreaker) OnSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status = entity.AccrualBreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// OnFailure records a network error or 5xx response.
+func (b *CircuitBreaker) OnFailure() {
+	if b.threshold < 1 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if b.status == entity.AccrualBreakerClosed {
+		b.failures++
+		if b.failures < b.threshold {
+			return
+		}
+	}
+	b.status = entity.AccrualBreakerOpen
+	b.openUntil = b.now().Add(b.openTimeout)
+}
+
+// OnAbort releases a half-open probe that ended without an answer, for
+// example because the caller's context was cancelled.
+func (b *CircuitBreaker) OnAbort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) State() entity.AccrualBreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return entity.AccrualBreakerState{
+		Status:    b.status,
+		OpenUntil: b.openUntil,
+		Failures:  b.failures,
+	}
+}
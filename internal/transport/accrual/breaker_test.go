@@ -0,0 +1,71 @@
+package accrual
+
+import (
+	"gophemart/internal/app/entity"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBreaker(threshold int, openTimeout time.Duration) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := NewCircuitBreaker(threshold, openTimeout)
+	b.now = clock.now
+	return b, clock
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Allow())
+		b.OnFailure()
+	}
+	require.NoError(t, b.Allow())
+	b.OnSuccess()
+	assert.Zero(t, b.State().Failures, "a success resets the failure count")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Allow())
+		b.OnFailure()
+	}
+	assert.Equal(t, entity.AccrualBreakerOpen, b.State().Status)
+	assert.ErrorIs(t, b.Allow(), entity.ErrAccrualCircuitOpen)
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	require.NoError(t, b.Allow())
+	b.OnFailure()
+
+	clock.advance(59 * time.Second)
+	assert.ErrorIs(t, b.Allow(), entity.ErrAccrualCircuitOpen)
+
+	clock.advance(time.Second)
+	require.NoError(t, b.Allow(), "the open timeout lets one probe through")
+	assert.Equal(t, entity.AccrualBreakerHalfOpen, b.State().Status)
+	assert.ErrorIs(t, b.Allow(), entity.ErrAccrualCircuitOpen, "only one probe at a time")
+
+	b.OnFailure()
+	assert.Equal(t, entity.AccrualBreakerOpen, b.State().Status, "a failed probe reopens the breaker")
+	assert.Equal(t, clock.now().Add(time.Minute), b.State().OpenUntil)
+
+	clock.advance(time.Minute)
+	require.NoError(t, b.Allow())
+	b.OnAbort()
+	require.NoError(t, b.Allow(), "an aborted probe frees the slot")
+	b.OnSuccess()
+	assert.Equal(t, entity.AccrualBreakerClosed, b.State().Status)
+	assert.NoError(t, b.Allow())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b, _ := newTestBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.OnFailure()
+	}
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, entity.AccrualBreakerClosed, b.State().Status)
+}
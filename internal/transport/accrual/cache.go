@@ -0,0 +1,111 @@
+package accrual
+
+import (
+	"gophemart/internal/app/entity"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	info      entity.AccrualOrderInfo
+	expiresAt time.Time
+}
+
+// resultCache keeps final answers (PROCESSED, INVALID) for a short time.
+// Statuses that can still change are never cached. A zero ttl disables
+// caching but keeps the counters.
+type resultCache struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cacheEntry
+
+	hits   int64
+	misses int64
+	shared int64
+}
+
+func newResultCache(ttl time.Duration, maxEntries int) *resultCache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &resultCache{
+		now:        time.Now,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cacheEntry),
+	}
+}
+
+// get returns a copy of the cached answer and counts the lookup.
+func (c *resultCache) get(number string) (*entity.AccrualOrderInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[number]
+	if ok && c.now().Before(entry.expiresAt) {
+		c.hits++
+		info := entry.info
+		return &info, true
+	}
+	if ok {
+		delete(c.entries, number)
+	}
+	c.misses++
+	return nil, false
+}
+
+// put caches info if its status is final.
+func (c *resultCache) put(info *entity.AccrualOrderInfo) {
+	if c.ttl <= 0 || info == nil || !isFinalStatus(info.Status) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if _, ok := c.entries[info.Order]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[info.Order] = cacheEntry{info: *info, expiresAt: now.Add(c.ttl)}
+}
+
+// evict drops expired entries and, if the cache is still full, the entry
+// closest to expiry. It must be called with c.mu held.
+func (c *resultCache) evict(now time.Time) {
+	var oldest string
+	var oldestAt time.Time
+	for number, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, number)
+			continue
+		}
+		if oldest == "" || entry.expiresAt.Before(oldestAt) {
+			oldest, oldestAt = number, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+func (c *resultCache) addShared() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shared++
+}
+
+func (c *resultCache) stats() entity.AccrualCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return entity.AccrualCacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Shared:  c.shared,
+		Entries: len(c.entries),
+	}
+}
+
+func isFinalStatus(status entity.AccrualStatus) bool {
+	return status == entity.AccrualProcessed || status == entity.AccrualInvalid
+}
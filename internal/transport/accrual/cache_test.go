@@ -0,0 +1,104 @@
+package accrual
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_SharesConcurrentLookups(t *testing.T) {
+	var calls int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		w.Write([]byte(`{"order":"123","status":"PROCESSING"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make([]*entity.AccrualOrderInfo, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			info, err := client.GetOrderInfo(context.Background(), "123")
+			assert.NoError(t, err)
+			results[i] = info
+		}(i)
+	}
+	require.Eventually(t, func() bool {
+		return client.CacheStats().Misses == callers
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+	for _, info := range results {
+		assert.Equal(t, &entity.AccrualOrderInfo{Order: "123", Status: entity.AccrualProcessing}, info)
+	}
+	assert.NotSame(t, results[0], results[1], "callers must not share the answer")
+	assert.Equal(t, entity.AccrualCacheStats{Misses: callers, Shared: callers - 1}, client.CacheStats())
+
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls), "PROCESSING is not cached")
+}
+
+func TestClient_CachesFinalAnswers(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.Write([]byte(`{"order":"123","status":"PROCESSED","accrual":500}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, WithCache(time.Minute, 10))
+	now := time.Now()
+	client.cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		info, err := client.GetOrderInfo(context.Background(), "123")
+		require.NoError(t, err)
+		assert.Equal(t, &entity.AccrualOrderInfo{Order: "123", Status: entity.AccrualProcessed, Accrual: 500}, info)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+	assert.Equal(t, entity.AccrualCacheStats{Hits: 2, Misses: 1, Entries: 1}, client.CacheStats())
+
+	now = now.Add(time.Minute)
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls), "expired entry is fetched again")
+}
+
+func TestResultCache_EvictsWhenFull(t *testing.T) {
+	cache := newResultCache(time.Minute, 2)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.put(&entity.AccrualOrderInfo{Order: "1", Status: entity.AccrualProcessed})
+	now = now.Add(time.Second)
+	cache.put(&entity.AccrualOrderInfo{Order: "2", Status: entity.AccrualInvalid})
+	cache.put(&entity.AccrualOrderInfo{Order: "3", Status: entity.AccrualRegistered})
+	now = now.Add(time.Second)
+	cache.put(&entity.AccrualOrderInfo{Order: "4", Status: entity.AccrualProcessed})
+
+	_, ok := cache.get("1")
+	assert.False(t, ok, "the entry closest to expiry is evicted")
+	_, ok = cache.get("2")
+	assert.True(t, ok)
+	_, ok = cache.get("4")
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.stats().Entries)
+}
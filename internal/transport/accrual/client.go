@@ -1,9 +1,20 @@
 package accrual
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/provider"
+	"gophemart/internal/backoff"
 	"gophemart/pkg/logger"
 	"io"
 	"net/http"
@@ -11,138 +22,456 @@ import (
 	"time"
 )
 
+var (
+	_ provider.AccrualProvider  = (*Client)(nil)
+	_ provider.AccrualRegistrar = (*Client)(nil)
+)
+
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	limiter    *RateLimiter
+	breaker    *CircuitBreaker
+	retry      RetryPolicy
+	jitter     func() float64
+	cache      *resultCache
+	lookups    singleflight.Group
+	observe    RequestObserver
+}
+
+type Option func(*Client)
+
+// RequestObserver is told about every request sent to the accrual service.
+// outcome is the response status code, or "error" if no response arrived.
+type RequestObserver func(method, outcome string, duration time.Duration)
+
+// WithRequestObserver reports every request, retries included, to observe.
+func WithRequestObserver(observe RequestObserver) Option {
+	return func(c *Client) {
+		c.observe = observe
+	}
+}
+
+// WithRateLimiter replaces the default limiter, which is unlimited until the
+// first 429.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
 }
 
-func NewClient(baseURL string) *Client {
-	return &Client{
+// WithCircuitBreaker replaces the default breaker, which opens for 30s after
+// 5 consecutive failures.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(c *Client) {
+		c.breaker = breaker
+	}
+}
+
+// WithRetry replaces DefaultRetryPolicy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithHTTPClient replaces the default client: a 10s timeout per attempt over
+// a transport built from DefaultTransportConfig.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCache keeps final answers (PROCESSED, INVALID) for ttl, up to
+// maxEntries orders. Caching is off by default; concurrent lookups of the
+// same order share one request either way.
+func WithCache(ttl time.Duration, maxEntries int) Option {
+	return func(c *Client) {
+		c.cache = newResultCache(ttl, maxEntries)
+	}
+}
+
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: NewTransport(DefaultTransportConfig()),
 		},
+		limiter: NewRateLimiter(0, 0),
+		breaker: NewCircuitBreaker(5, 30*time.Second),
+		retry:   DefaultRetryPolicy(),
+		jitter:  backoff.Jitter,
+		cache:   newResultCache(0, 0),
+		observe: func(string, string, time.Duration) {},
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
-type OrderInfo struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
+// RateLimitState reports whether requests are paused and the current request budget.
+func (c *Client) RateLimitState() entity.AccrualRateLimiterState {
+	return c.limiter.State()
 }
 
-func (c *Client) GetOrderInfo(ctx context.Context, orderNumber string) (*OrderInfo, error) {
-	url := fmt.Sprintf("%s/api/orders/%s", c.baseURL, orderNumber)
+// BreakerState reports whether the circuit breaker currently rejects requests.
+func (c *Client) BreakerState() entity.AccrualBreakerState {
+	return c.breaker.State()
+}
 
-	logger.Debug().
-		Str("method", "Client.GetOrderInfo").
-		Str("url", url).
-		Str("order_number", orderNumber).
-		Msg("Sending request to accrual service")
+// CacheStats reports how order lookups were answered.
+func (c *Client) CacheStats() entity.AccrualCacheStats {
+	return c.cache.stats()
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// PausedUntil reports whether requests would be rejected at now, because of
+// a rate-limit pause or an open circuit breaker, and until when.
+func (c *Client) PausedUntil(now time.Time) (time.Time, bool) {
+	var until time.Time
+	if state := c.RateLimitState(); state.Paused(now) {
+		until = state.PausedUntil
+	}
+	if state := c.BreakerState(); state.Open(now) && state.OpenUntil.After(until) {
+		until = state.OpenUntil
+	}
+	return until, !until.IsZero()
+}
+
+// Ping checks that the accrual service answers HTTP requests. It bypasses the
+// rate limiter and the circuit breaker, and any response counts as success.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL, nil)
 	if err != nil {
-		logger.Error().
-			Err(err).
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	drainBody(resp)
+	return nil
+}
+
+type registerOrderRequest struct {
+	Order string        `json:"order"`
+	Goods []entity.Good `json:"goods"`
+}
+
+// GetOrderInfo polls the accrual service, retrying network errors and 5xx
+// responses according to the client's RetryPolicy. Final answers may come
+// from the cache (see WithCache), and callers asking for the same order at
+// the same time share a single request made with the first caller's context;
+// the others wait for it even if their own context ends first.
+func (c *Client) GetOrderInfo(ctx context.Context, orderNumber string) (*entity.AccrualOrderInfo, error) {
+	if info, ok := c.cache.get(orderNumber); ok {
+		logger.FromContext(ctx).Debug().
 			Str("order_number", orderNumber).
-			Msg("Failed to create request to accrual service")
-		return nil, fmt.Errorf("failed to create request: %w", err)
+			Str("status", string(info.Status)).
+			Msg("Order info served from cache")
+		return info, nil
 	}
 
-	start := time.Now()
-	resp, err := c.httpClient.Do(req)
-	duration := time.Since(start)
+	leader := false
+	val, err, _ := c.lookups.Do(orderNumber, func() (interface{}, error) {
+		leader = true
+		url := fmt.Sprintf("%s/api/orders/%s", c.baseURL, orderNumber)
+		info, err := withRetry(ctx, c, orderNumber, func() (*entity.AccrualOrderInfo, error) {
+			return c.getOrderInfo(ctx, url, orderNumber)
+		})
+		if err == nil {
+			c.cache.put(info)
+		}
+		return info, err
+	})
+	if !leader {
+		c.cache.addShared()
+	}
 
+	info, _ := val.(*entity.AccrualOrderInfo)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	// Every caller gets its own copy of a shared answer.
+	result := *info
+	return &result, nil
+}
+
+// RegisterOrder hands a new order to the accrual service for processing.
+// Retrying is safe: a repeated registration answers 409, which is reported
+// as entity.ErrAccrualAlreadyRegistered.
+func (c *Client) RegisterOrder(ctx context.Context, orderNumber string, goods []entity.Good) error {
+	if goods == nil {
+		goods = []entity.Good{}
+	}
+	body, err := json.Marshal(registerOrderRequest{Order: orderNumber, Goods: goods})
 	if err != nil {
-		logger.Error().
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	url := c.baseURL + "/api/orders"
+	_, err = withRetry(ctx, c, orderNumber, func() (struct{}, error) {
+		return struct{}{}, c.registerOrder(ctx, url, orderNumber, body)
+	})
+	return err
+}
+
+// withRetry repeats call while it fails with a transient error.
+func withRetry[T any](ctx context.Context, c *Client, orderNumber string, call func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := call()
+		if err == nil || !isTransient(err) || attempt >= c.retry.MaxAttempts || ctx.Err() != nil {
+			return result, err
+		}
+
+		delay := backoff.Delay(attempt, c.retry.BaseDelay, c.retry.MaxDelay, c.jitter)
+		logger.FromContext(ctx).Warn().
 			Err(err).
 			Str("order_number", orderNumber).
-			Dur("duration_ms", duration).
-			Msg("Request to accrual service failed")
-		return nil, fmt.Errorf("request failed: %w", err)
+			Int("attempt", attempt).
+			Dur("retry_in", delay).
+			Msg("Transient accrual service error, retrying")
+		if sleepCtx(ctx, delay) != nil {
+			return result, err
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	logger.Debug().
-		Str("method", "Client.GetOrderInfo").
-		Str("order_number", orderNumber).
-		Int("status_code", resp.StatusCode).
-		Dur("duration_ms", duration).
-		Msg("Received response from accrual service")
+func (c *Client) getOrderInfo(ctx context.Context, url, orderNumber string) (*entity.AccrualOrderInfo, error) {
+	resp, err := c.send(ctx, http.MethodGet, orderInfoRoute, url, nil, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(resp)
 
 	switch resp.StatusCode {
 	case http.StatusOK:
-		var info OrderInfo
+		c.breaker.OnSuccess()
+		c.limiter.OnSuccess()
+		var info entity.AccrualOrderInfo
 		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-			logger.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Str("order_number", orderNumber).
 				Msg("Failed to decode response from accrual service")
 			return nil, fmt.Errorf("failed to decode response: %w", err)
 		}
 
-		logger.Debug().
+		logger.FromContext(ctx).Debug().
 			Str("order_number", orderNumber).
-			Str("status", info.Status).
+			Str("status", string(info.Status)).
 			Float64("accrual", info.Accrual).
 			Msg("Successfully retrieved order info")
 		return &info, nil
 
 	case http.StatusNoContent:
-		logger.Debug().
+		c.breaker.OnSuccess()
+		c.limiter.OnSuccess()
+		logger.FromContext(ctx).Debug().
 			Str("order_number", orderNumber).
 			Msg("Order not found in accrual system (204 No Content)")
 		return nil, nil
 
 	case http.StatusTooManyRequests:
-		retryAfterStr := resp.Header.Get("Retry-After")
-		retryAfter, err := strconv.Atoi(retryAfterStr)
-		if err != nil || retryAfter <= 0 {
-			retryAfter = 60
-			logger.Warn().
-				Str("retry_after_header", retryAfterStr).
-				Str("order_number", orderNumber).
-				Msg("Invalid Retry-After header, using default 60 seconds")
-		} else {
-			logger.Debug().
-				Str("order_number", orderNumber).
-				Int("retry_after", retryAfter).
-				Msg("Parsed Retry-After header")
-		}
+		return nil, c.rateLimited(ctx, resp, orderNumber)
+
+	default:
+		return nil, c.unexpectedStatus(ctx, resp, orderNumber)
+	}
+}
+
+func (c *Client) registerOrder(ctx context.Context, url, orderNumber string, body []byte) error {
+	resp, err := c.send(ctx, http.MethodPost, registerOrderRoute, url, body, orderNumber)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		c.breaker.OnSuccess()
+		c.limiter.OnSuccess()
+		logger.FromContext(ctx).Info().
+			Str("order_number", orderNumber).
+			Msg("Order registered in accrual system")
+		return nil
 
-		retryDuration := time.Duration(retryAfter) * time.Second
-		logger.Warn().
+	case http.StatusConflict:
+		c.breaker.OnSuccess()
+		c.limiter.OnSuccess()
+		logger.FromContext(ctx).Debug().
 			Str("order_number", orderNumber).
-			Dur("retry_after", retryDuration).
-			Msg("Rate limit exceeded in accrual service")
+			Msg("Order already registered in accrual system")
+		return entity.ErrAccrualAlreadyRegistered
 
-		return nil, &RateLimitError{
-			RetryAfter: retryDuration,
-			Message:    "too many requests to accrual service",
-		}
+	case http.StatusTooManyRequests:
+		return c.rateLimited(ctx, resp, orderNumber)
 
 	default:
-		body, _ := io.ReadAll(resp.Body)
-		bodyStr := string(body)
-		if len(bodyStr) > 1024 {
-			bodyStr = bodyStr[:1024] + "..."
-		}
+		return c.unexpectedStatus(ctx, resp, orderNumber)
+	}
+}
+
+// send performs one request, guarded by the circuit breaker and the rate
+// limiter. The caller must record the outcome of a returned response with
+// the breaker and pass it to drainBody.
+// Routes of the accrual API, logged instead of URLs that carry order numbers.
+const (
+	orderInfoRoute     = "/api/orders/{number}"
+	registerOrderRoute = "/api/orders"
+)
 
-		logger.Error().
+func (c *Client) send(
+	ctx context.Context,
+	method, route, url string,
+	body []byte,
+	orderNumber string,
+) (*http.Response, error) {
+	logger.FromContext(ctx).Debug().
+		Str("http_method", method).
+		Str("route", route).
+		Str("order_number", orderNumber).
+		Msg("Sending request to accrual service")
+
+	if err := c.breaker.Allow(); err != nil {
+		logger.FromContext(ctx).Debug().
 			Str("order_number", orderNumber).
-			Int("status_code", resp.StatusCode).
-			Str("response_body", bodyStr).
-			Msg("Unexpected status code from accrual service")
+			Msg("Accrual request rejected by open circuit breaker")
+		return nil, err
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		c.breaker.OnAbort()
+		logger.FromContext(ctx).Debug().
+			Err(err).
+			Str("order_number", orderNumber).
+			Msg("Accrual request held back by rate limiter")
+		return nil, err
+	}
+
+	ctx, span := otel.Tracer("gophemart/accrual").Start(ctx, "accrual "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(url),
+			attribute.String("order_number", orderNumber),
+		),
+	)
+	defer span.End()
 
-		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bodyStr)
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
 	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		c.breaker.OnAbort()
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("order_number", orderNumber).
+			Msg("Failed to create request to accrual service")
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	duration := time.Since(start)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.observe(method, "error", duration)
+		if ctx.Err() != nil {
+			c.breaker.OnAbort()
+		} else {
+			c.breaker.OnFailure()
+		}
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("order_number", orderNumber).
+			Dur("duration_ms", duration).
+			Msg("Request to accrual service failed")
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	c.observe(method, strconv.Itoa(resp.StatusCode), duration)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+
+	logger.FromContext(ctx).Debug().
+		Str("http_method", method).
+		Str("order_number", orderNumber).
+		Int("status_code", resp.StatusCode).
+		Dur("duration_ms", duration).
+		Msg("Received response from accrual service")
+	return resp, nil
 }
 
-type RateLimitError struct {
-	RetryAfter time.Duration
-	Message    string
+// drainBody reads what is left so that the connection goes back to the pool.
+func drainBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
 }
 
-func (e *RateLimitError) Error() string {
-	return fmt.Sprintf("%s (retry after %v)", e.Message, e.RetryAfter)
+// rateLimited pauses every request of the client after a 429.
+func (c *Client) rateLimited(ctx context.Context, resp *http.Response, orderNumber string) error {
+	c.breaker.OnSuccess()
+	retryAfterStr := resp.Header.Get("Retry-After")
+	retryAfter, err := strconv.Atoi(retryAfterStr)
+	if err != nil || retryAfter <= 0 {
+		retryAfter = 60
+		logger.FromContext(ctx).Warn().
+			Str("retry_after_header", retryAfterStr).
+			Str("order_number", orderNumber).
+			Msg("Invalid Retry-After header, using default 60 seconds")
+	} else {
+		logger.FromContext(ctx).Debug().
+			Str("order_number", orderNumber).
+			Int("retry_after", retryAfter).
+			Msg("Parsed Retry-After header")
+	}
+
+	retryDuration := time.Duration(retryAfter) * time.Second
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	c.limiter.OnRateLimited(retryDuration, string(body))
+	logger.FromContext(ctx).Warn().
+		Str("order_number", orderNumber).
+		Dur("retry_after", retryDuration).
+		Float64("rate_per_second", c.limiter.State().Rate).
+		Msg("Rate limit exceeded in accrual service, pausing all requests")
+
+	return &entity.AccrualRateLimitError{
+		RetryAfter: retryDuration,
+		Message:    "too many requests to accrual service",
+	}
+}
+
+// unexpectedStatus turns any other response into a *StatusError; 5xx
+// responses count against the circuit breaker.
+func (c *Client) unexpectedStatus(ctx context.Context, resp *http.Response, orderNumber string) error {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.breaker.OnFailure()
+	} else {
+		c.breaker.OnSuccess()
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	bodyStr := string(body)
+	if len(bodyStr) > 1024 {
+		bodyStr = bodyStr[:1024] + "..."
+	}
+
+	logger.FromContext(ctx).Error().
+		Str("order_number", orderNumber).
+		Int("status_code", resp.StatusCode).
+		Str("response_body", bodyStr).
+		Msg("Unexpected status code from accrual service")
+
+	return &StatusError{StatusCode: resp.StatusCode, Body: bodyStr}
 }
@@ -15,22 +15,22 @@ func TestClient_GetOrderInfo(t *testing.T) {
 	tests := []struct {
 		name           string
 		handler        http.HandlerFunc
-		expectedResult *OrderInfo
+		expectedResult *entity.AccrualOrderInfo
 		expectedError  error
 	}{
 		{
 			name: "successful responce",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
-				json.NewEncoder(w).Encode(OrderInfo{
+				json.NewEncoder(w).Encode(entity.AccrualOrderInfo{
 					Order:   "123",
-					Status:  string(entity.OrderProcessed),
+					Status:  entity.AccrualProcessed,
 					Accrual: 0,
 				})
 			},
-			expectedResult: &OrderInfo{
+			expectedResult: &entity.AccrualOrderInfo{
 				Order:   "123",
-				Status:  string(entity.OrderProcessed),
+				Status:  entity.AccrualProcessed,
 				Accrual: 0,
 			},
 			expectedError: nil,
@@ -51,10 +51,10 @@ func TestClient_GetOrderInfo(t *testing.T) {
 				}
 
 				switch expectedErr := tt.expectedError.(type) {
-				case *RateLimitError:
-					actualErr, ok := err.(*RateLimitError)
+				case *entity.AccrualRateLimitError:
+					actualErr, ok := err.(*entity.AccrualRateLimitError)
 					if !ok {
-						t.Fatalf("expected RateLimitError, got %T", err)
+						t.Fatalf("expected entity.AccrualRateLimitError, got %T", err)
 					}
 					if actualErr.RetryAfter != expectedErr.RetryAfter {
 						t.Errorf("expected retry after %v, got %v", expectedErr.RetryAfter, actualErr.RetryAfter)
@@ -99,3 +99,51 @@ func TestClient_Timeout(t *testing.T) {
 		t.Errorf("expected deadline exceeded error, got: %v", err)
 	}
 }
+
+func TestClient_RateLimitPausesAllRequests(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("No more than 10 requests per minute allowed"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	for _, number := range []string{"1", "2", "3"} {
+		_, err := client.GetOrderInfo(context.Background(), number)
+		var rlErr *entity.AccrualRateLimitError
+		if !errors.As(err, &rlErr) {
+			t.Fatalf("expected entity.AccrualRateLimitError for order %s, got %v", number, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected a single request to reach the server, got %d", calls)
+	}
+	state := client.RateLimitState()
+	if !state.Paused(time.Now()) {
+		t.Error("expected client to be paused")
+	}
+	if state.Rate <= 0 || state.Rate > 10.0/60+1e-9 {
+		t.Errorf("expected rate to follow the advertised limit, got %v", state.Rate)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	client := NewClient(server.URL)
+
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("any response means the service is reachable, got %v", err)
+	}
+
+	server.Close()
+	if err := client.Ping(context.Background()); err == nil {
+		t.Fatal("expected an error once the service is gone")
+	}
+}
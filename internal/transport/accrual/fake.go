@@ -0,0 +1,187 @@
+package accrual
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/provider"
+	"sync"
+	"time"
+)
+
+var (
+	_ provider.AccrualProvider  = (*Fake)(nil)
+	_ provider.AccrualRegistrar = (*Fake)(nil)
+)
+
+// Fake is an in-process accrual provider for tests. Apart from rate-limit
+// pauses, which expire with the clock, its answers depend only on how it was
+// configured and on the order of calls.
+type Fake struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	orders     map[string]*fakeOrder
+	registered map[string][]entity.Good
+	latency    time.Duration
+
+	rateLimitEvery int
+	retryAfter     time.Duration
+	pausedUntil    time.Time
+	failures       map[string][]error
+
+	calls int
+}
+
+type fakeOrder struct {
+	statuses []entity.AccrualStatus
+	accrual  float64
+	polls    int
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		now:        time.Now,
+		orders:     make(map[string]*fakeOrder),
+		registered: make(map[string][]entity.Good),
+		failures:   make(map[string][]error),
+	}
+}
+
+// SetOrder registers an order. Each poll reports the next status in
+// statuses and the last one is repeated; accrual is reported with
+// PROCESSED. Orders without statuses are unknown to the fake (204).
+func (f *Fake) SetOrder(number string, accrual float64, statuses ...entity.AccrualStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(statuses) == 0 {
+		delete(f.orders, number)
+		return
+	}
+	f.orders[number] = &fakeOrder{statuses: statuses, accrual: accrual}
+}
+
+// SetLatency delays every answer by d, or until the caller's context ends.
+func (f *Fake) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// RateLimitEvery makes every n-th call fail with a
+// *entity.AccrualRateLimitError that pauses the fake for retryAfter. Zero
+// turns rate limiting off.
+func (f *Fake) RateLimitEvery(n int, retryAfter time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateLimitEvery = n
+	f.retryAfter = retryAfter
+}
+
+// FailNext makes the next calls for number return errs, one per call.
+func (f *Fake) FailNext(number string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[number] = append(f.failures[number], errs...)
+}
+
+// Calls returns the number of calls answered so far.
+func (f *Fake) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *Fake) GetOrderInfo(ctx context.Context, number string) (*entity.AccrualOrderInfo, error) {
+	if err := f.sleep(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.admit(number); err != nil {
+		return nil, err
+	}
+
+	order, ok := f.orders[number]
+	if !ok {
+		return nil, nil
+	}
+	status := order.statuses[min(order.polls, len(order.statuses)-1)]
+	order.polls++
+
+	info := &entity.AccrualOrderInfo{Order: number, Status: status}
+	if status == entity.AccrualProcessed {
+		info.Accrual = order.accrual
+	}
+	return info, nil
+}
+
+// RegisterOrder records the goods of the order; see Registered. Registering
+// an order twice returns entity.ErrAccrualAlreadyRegistered.
+func (f *Fake) RegisterOrder(ctx context.Context, number string, goods []entity.Good) error {
+	if err := f.sleep(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.admit(number); err != nil {
+		return err
+	}
+	if _, ok := f.registered[number]; ok {
+		return entity.ErrAccrualAlreadyRegistered
+	}
+	f.registered[number] = goods
+	return nil
+}
+
+// Registered returns the goods the order was registered with.
+func (f *Fake) Registered(number string) ([]entity.Good, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	goods, ok := f.registered[number]
+	return goods, ok
+}
+
+func (f *Fake) sleep(ctx context.Context) error {
+	f.mu.Lock()
+	latency := f.latency
+	f.mu.Unlock()
+	return sleepCtx(ctx, latency)
+}
+
+// admit counts a call and applies rate limiting and scripted failures. It
+// must be called with f.mu held.
+func (f *Fake) admit(number string) error {
+	now := f.now()
+	if now.Before(f.pausedUntil) {
+		return &entity.AccrualRateLimitError{
+			RetryAfter: f.pausedUntil.Sub(now),
+			Message:    "accrual requests paused after rate limit",
+		}
+	}
+
+	f.calls++
+	if f.rateLimitEvery > 0 && f.calls%f.rateLimitEvery == 0 {
+		f.pausedUntil = now.Add(f.retryAfter)
+		return &entity.AccrualRateLimitError{
+			RetryAfter: f.retryAfter,
+			Message:    "too many requests to accrual service",
+		}
+	}
+
+	if errs := f.failures[number]; len(errs) > 0 {
+		f.failures[number] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (f *Fake) PausedUntil(now time.Time) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Before(f.pausedUntil) {
+		return f.pausedUntil, true
+	}
+	return time.Time{}, false
+}
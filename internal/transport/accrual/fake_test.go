@@ -0,0 +1,74 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"gophemart/internal/app/entity"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake_StatusProgression(t *testing.T) {
+	f := NewFake()
+	f.SetOrder("1", 42, entity.AccrualRegistered, entity.AccrualProcessing, entity.AccrualProcessed)
+	ctx := context.Background()
+
+	var statuses []entity.AccrualStatus
+	for i := 0; i < 4; i++ {
+		info, err := f.GetOrderInfo(ctx, "1")
+		require.NoError(t, err)
+		statuses = append(statuses, info.Status)
+		if info.Status == entity.AccrualProcessed {
+			assert.Equal(t, 42.0, info.Accrual)
+		} else {
+			assert.Zero(t, info.Accrual)
+		}
+	}
+	assert.Equal(t, []entity.AccrualStatus{entity.AccrualRegistered, entity.AccrualProcessing, entity.AccrualProcessed, entity.AccrualProcessed}, statuses)
+
+	info, err := f.GetOrderInfo(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+	assert.Equal(t, 5, f.Calls())
+}
+
+func TestFake_RateLimitAndFailures(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f := NewFake()
+	f.now = clock.now
+	f.SetOrder("1", 0, entity.AccrualInvalid)
+	f.RateLimitEvery(2, time.Minute)
+	boom := errors.New("boom")
+	f.FailNext("1", boom)
+	ctx := context.Background()
+
+	_, err := f.GetOrderInfo(ctx, "1")
+	assert.ErrorIs(t, err, boom)
+
+	_, err = f.GetOrderInfo(ctx, "1")
+	var rlErr *entity.AccrualRateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, time.Minute, rlErr.RetryAfter)
+	until, paused := f.PausedUntil(clock.now())
+	assert.True(t, paused)
+	assert.Equal(t, clock.now().Add(time.Minute), until)
+
+	clock.advance(time.Minute)
+	info, err := f.GetOrderInfo(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.AccrualInvalid, info.Status)
+}
+
+func TestFake_LatencyHonoursContext(t *testing.T) {
+	f := NewFake()
+	f.SetLatency(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := f.GetOrderInfo(ctx, "1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, f.Calls())
+}
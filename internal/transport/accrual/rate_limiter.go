@@ -0,0 +1,171 @@
+package accrual
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var rateLimitHint = regexp.MustCompile(`(?i)no more than (\d+) requests per minute`)
+
+// RateLimiter is shared by every caller of a Client. A 429 pauses all requests
+// until Retry-After elapses and lowers the request rate; successful responses
+// raise it again (additive increase, multiplicative decrease).
+type RateLimiter struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	pausedUntil time.Time
+	rate        float64
+	ceiling     float64
+	minRate     float64
+	maxRate     float64
+	nextSlot    time.Time
+	rateLimited int64
+
+	windowStart time.Time
+	windowCount int
+	lastRate    float64
+}
+
+// NewRateLimiter creates a limiter. maxRate caps requests per second (zero for
+// no cap until the first 429); minRate is the floor the rate can drop to.
+func NewRateLimiter(minRate, maxRate float64) *RateLimiter {
+	if minRate <= 0 {
+		minRate = 0.1
+	}
+	return &RateLimiter{
+		now:     time.Now,
+		rate:    maxRate,
+		minRate: minRate,
+		maxRate: maxRate,
+	}
+}
+
+// Wait reserves a slot for one request. It returns a
+// *entity.AccrualRateLimitError without waiting while the limiter is paused.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	if now.Before(l.pausedUntil) {
+		remaining := l.pausedUntil.Sub(now)
+		l.mu.Unlock()
+		return &entity.AccrualRateLimitError{
+			RetryAfter: remaining,
+			Message:    "accrual requests paused after rate limit",
+		}
+	}
+
+	l.observe(now)
+
+	var delay time.Duration
+	if l.rate > 0 {
+		if l.nextSlot.Before(now) {
+			l.nextSlot = now
+		}
+		delay = l.nextSlot.Sub(now)
+		l.nextSlot = l.nextSlot.Add(time.Duration(float64(time.Second) / l.rate))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// OnRateLimited records a 429. body is used to pick up the server's advertised
+// per-minute limit when present.
+func (l *RateLimiter) OnRateLimited(retryAfter time.Duration, body string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.rateLimited++
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.nextSlot = l.pausedUntil
+
+	if m := rateLimitHint.FindStringSubmatch(body); m != nil {
+		if perMinute, err := strconv.Atoi(m[1]); err == nil && perMinute > 0 {
+			l.ceiling = float64(perMinute) / 60
+			l.rate = l.ceiling
+			return
+		}
+	}
+
+	current := l.rate
+	if current == 0 {
+		current = l.observedRate(now)
+	}
+	l.rate = current / 2
+	if l.rate < l.minRate {
+		l.rate = l.minRate
+	}
+}
+
+// OnSuccess grows the rate by roughly one request per second, every second.
+func (l *RateLimiter) OnSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == 0 {
+		return
+	}
+	l.rate += 1 / l.rate
+	if l.maxRate > 0 && l.rate > l.maxRate {
+		l.rate = l.maxRate
+	}
+	if l.ceiling > 0 && l.rate > l.ceiling {
+		l.rate = l.ceiling
+	}
+}
+
+func (l *RateLimiter) State() entity.AccrualRateLimiterState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := entity.AccrualRateLimiterState{
+		Rate:        l.rate,
+		RateLimited: l.rateLimited,
+	}
+	if l.now().Before(l.pausedUntil) {
+		state.PausedUntil = l.pausedUntil
+	}
+	return state
+}
+
+// observe counts requests in one-second windows to estimate the request rate
+// that triggered the first 429.
+func (l *RateLimiter) observe(now time.Time) {
+	if l.windowStart.IsZero() || now.Sub(l.windowStart) >= time.Second {
+		if !l.windowStart.IsZero() {
+			l.lastRate = float64(l.windowCount) / now.Sub(l.windowStart).Seconds()
+		}
+		l.windowStart = now
+		l.windowCount = 0
+	}
+	l.windowCount++
+}
+
+func (l *RateLimiter) observedRate(now time.Time) float64 {
+	elapsed := now.Sub(l.windowStart).Seconds()
+	if elapsed < 1 {
+		elapsed = 1
+	}
+	if current := float64(l.windowCount) / elapsed; current > l.lastRate {
+		return current
+	}
+	return l.lastRate
+}
@@ -0,0 +1,110 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"gophemart/internal/app/entity"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestLimiter(minRate, maxRate float64) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewRateLimiter(minRate, maxRate)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestRateLimiter_PausesAfterRateLimit(t *testing.T) {
+	l, clock := newTestLimiter(0.5, 0)
+
+	require.NoError(t, l.Wait(context.Background()))
+	l.OnRateLimited(30*time.Second, "")
+
+	err := l.Wait(context.Background())
+	var rlErr *entity.AccrualRateLimitError
+	require.True(t, errors.As(err, &rlErr))
+	assert.Equal(t, 30*time.Second, rlErr.RetryAfter)
+	assert.True(t, l.State().Paused(clock.t))
+	assert.Equal(t, int64(1), l.State().RateLimited)
+
+	clock.advance(10 * time.Second)
+	err = l.Wait(context.Background())
+	require.True(t, errors.As(err, &rlErr))
+	assert.Equal(t, 20*time.Second, rlErr.RetryAfter)
+
+	clock.advance(20 * time.Second)
+	assert.False(t, l.State().Paused(clock.t))
+}
+
+func TestRateLimiter_LongerPauseWins(t *testing.T) {
+	l, clock := newTestLimiter(0.5, 0)
+
+	l.OnRateLimited(60*time.Second, "")
+	l.OnRateLimited(5*time.Second, "")
+
+	assert.Equal(t, clock.t.Add(60*time.Second), l.State().PausedUntil)
+}
+
+func TestRateLimiter_UsesAdvertisedLimit(t *testing.T) {
+	l, _ := newTestLimiter(0.5, 0)
+
+	l.OnRateLimited(time.Second, "No more than 120 requests per minute allowed")
+	assert.InDelta(t, 2.0, l.State().Rate, 1e-9)
+
+	for i := 0; i < 100; i++ {
+		l.OnSuccess()
+	}
+	assert.InDelta(t, 2.0, l.State().Rate, 1e-9, "rate must not exceed the advertised limit")
+}
+
+func TestRateLimiter_AdaptsRate(t *testing.T) {
+	l, clock := newTestLimiter(0.5, 0)
+	assert.Zero(t, l.State().Rate, "unlimited before the first 429")
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+	l.OnRateLimited(time.Second, "")
+	assert.InDelta(t, 10.0, l.State().Rate, 1e-9, "halves the observed rate")
+
+	l.OnRateLimited(time.Second, "")
+	assert.InDelta(t, 5.0, l.State().Rate, 1e-9)
+
+	clock.advance(2 * time.Second)
+	before := l.State().Rate
+	for i := 0; i < 5; i++ {
+		l.OnSuccess()
+	}
+	assert.InDelta(t, before+1, l.State().Rate, 0.1, "grows by about one request per second per second")
+
+	for i := 0; i < 10; i++ {
+		l.OnRateLimited(time.Second, "")
+	}
+	assert.Equal(t, 0.5, l.State().Rate, "never drops below the floor")
+}
+
+func TestRateLimiter_RespectsMaxRate(t *testing.T) {
+	l, _ := newTestLimiter(0.5, 4)
+	assert.Equal(t, 4.0, l.State().Rate)
+
+	for i := 0; i < 100; i++ {
+		l.OnSuccess()
+	}
+	assert.Equal(t, 4.0, l.State().Rate)
+}
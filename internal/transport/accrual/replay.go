@@ -0,0 +1,175 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/provider"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotRecorded is returned by Replay for orders missing from the recording.
+var ErrNotRecorded = errors.New("order not in accrual recording")
+
+var (
+	_ provider.AccrualProvider = (*Recorder)(nil)
+	_ provider.AccrualProvider = (*Replay)(nil)
+)
+
+// Interaction outcomes.
+const (
+	OutcomeOK          = "ok"
+	OutcomeRateLimited = "rate_limited"
+	OutcomeUnavailable = "unavailable"
+	OutcomeError       = "error"
+)
+
+// Interaction is one recorded answer of an accrual provider. A nil Info with
+// OutcomeOK means the order was unknown.
+type Interaction struct {
+	Order      string                   `json:"order"`
+	Outcome    string                   `json:"outcome"`
+	Info       *entity.AccrualOrderInfo `json:"info,omitempty"`
+	RetryAfter time.Duration            `json:"retry_after,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+// Recorder wraps a provider and records every answer it gives, so that a run
+// against the real accrual service can be replayed later with Replay.
+type Recorder struct {
+	provider provider.AccrualProvider
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+func NewRecorder(p provider.AccrualProvider) *Recorder {
+	return &Recorder{provider: p}
+}
+
+func (r *Recorder) GetOrderInfo(ctx context.Context, number string) (*entity.AccrualOrderInfo, error) {
+	info, err := r.provider.GetOrderInfo(ctx, number)
+	if ctx.Err() != nil {
+		// The caller gave up; there is no answer worth replaying.
+		return info, err
+	}
+
+	interaction := Interaction{Order: number, Outcome: OutcomeOK}
+	var rateLimitErr *entity.AccrualRateLimitError
+	switch {
+	case err == nil:
+		if info != nil {
+			recorded := *info
+			interaction.Info = &recorded
+		}
+	case errors.As(err, &rateLimitErr):
+		interaction.Outcome = OutcomeRateLimited
+		interaction.RetryAfter = rateLimitErr.RetryAfter
+	case errors.Is(err, entity.ErrAccrualCircuitOpen):
+		interaction.Outcome = OutcomeUnavailable
+	default:
+		interaction.Outcome = OutcomeError
+		interaction.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+	return info, err
+}
+
+func (r *Recorder) PausedUntil(now time.Time) (time.Time, bool) {
+	return r.provider.PausedUntil(now)
+}
+
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Save writes the recording as JSON for LoadReplay.
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Interactions(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal accrual recording: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write accrual recording: %w", err)
+	}
+	return nil
+}
+
+// Replay answers from a recording. The answers for each order are given in
+// the recorded order and the last one is repeated once they run out.
+type Replay struct {
+	mu      sync.Mutex
+	byOrder map[string][]Interaction
+	served  map[string]int
+}
+
+func NewReplay(interactions []Interaction) *Replay {
+	r := &Replay{
+		byOrder: make(map[string][]Interaction),
+		served:  make(map[string]int),
+	}
+	for _, interaction := range interactions {
+		r.byOrder[interaction.Order] = append(r.byOrder[interaction.Order], interaction)
+	}
+	return r
+}
+
+// LoadReplay reads a recording written by Recorder.Save.
+func LoadReplay(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read accrual recording: %w", err)
+	}
+	var interactions []Interaction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("parse accrual recording: %w", err)
+	}
+	return NewReplay(interactions), nil
+}
+
+func (r *Replay) GetOrderInfo(ctx context.Context, number string) (*entity.AccrualOrderInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	recorded := r.byOrder[number]
+	if len(recorded) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, number)
+	}
+	interaction := recorded[min(r.served[number], len(recorded)-1)]
+	r.served[number]++
+	r.mu.Unlock()
+
+	switch interaction.Outcome {
+	case OutcomeRateLimited:
+		return nil, &entity.AccrualRateLimitError{
+			RetryAfter: interaction.RetryAfter,
+			Message:    "too many requests to accrual service",
+		}
+	case OutcomeUnavailable:
+		return nil, entity.ErrAccrualCircuitOpen
+	case OutcomeError:
+		return nil, errors.New(interaction.Error)
+	}
+	if interaction.Info == nil {
+		return nil, nil
+	}
+	info := *interaction.Info
+	return &info, nil
+}
+
+// PausedUntil never pauses: a replay does not model time.
+func (r *Replay) PausedUntil(time.Time) (time.Time, bool) {
+	return time.Time{}, false
+}
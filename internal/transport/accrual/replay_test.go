@@ -0,0 +1,62 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"gophemart/internal/app/entity"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_ReplaysRecordedAnswers(t *testing.T) {
+	f := NewFake()
+	f.SetOrder("1", 10, entity.AccrualProcessing, entity.AccrualProcessed)
+	f.FailNext("2", errors.New("unexpected status 500: oops"), entity.ErrAccrualCircuitOpen)
+	f.RateLimitEvery(5, 30*time.Second)
+
+	recorder := NewRecorder(f)
+	ctx := context.Background()
+	for _, number := range []string{"1", "2", "2", "1", "3"} {
+		recorder.GetOrderInfo(ctx, number)
+	}
+
+	path := filepath.Join(t.TempDir(), "accrual.json")
+	require.NoError(t, recorder.Save(path))
+	replay, err := LoadReplay(path)
+	require.NoError(t, err)
+
+	info, err := replay.GetOrderInfo(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.AccrualOrderInfo{Order: "1", Status: entity.AccrualProcessing}, info)
+	info, err = replay.GetOrderInfo(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.AccrualOrderInfo{Order: "1", Status: entity.AccrualProcessed, Accrual: 10}, info)
+	info, err = replay.GetOrderInfo(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, entity.AccrualProcessed, info.Status, "the last answer repeats")
+
+	_, err = replay.GetOrderInfo(ctx, "2")
+	assert.EqualError(t, err, "unexpected status 500: oops")
+	_, err = replay.GetOrderInfo(ctx, "2")
+	assert.ErrorIs(t, err, entity.ErrAccrualCircuitOpen)
+
+	_, err = replay.GetOrderInfo(ctx, "3")
+	var rlErr *entity.AccrualRateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, 30*time.Second, rlErr.RetryAfter)
+
+	_, err = replay.GetOrderInfo(ctx, "4")
+	assert.ErrorIs(t, err, ErrNotRecorded)
+}
+
+func TestReplay_UnknownOrder(t *testing.T) {
+	replay := NewReplay([]Interaction{{Order: "1", Outcome: OutcomeOK}})
+
+	info, err := replay.GetOrderInfo(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Nil(t, info, "a recorded 204 replays as an unknown order")
+}
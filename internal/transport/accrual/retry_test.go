@@ -0,0 +1,214 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gophemart/internal/app/entity"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(url string, policy RetryPolicy, breaker *CircuitBreaker) *Client {
+	c := NewClient(url, WithRetry(policy), WithCircuitBreaker(breaker))
+	c.jitter = func() float64 { return 0 }
+	return c
+}
+
+func TestClient_RetriesTransientErrors(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"order":"123","status":"PROCESSED","accrual":10}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, NewCircuitBreaker(5, time.Minute))
+
+	info, err := client.GetOrderInfo(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.AccrualOrderInfo{Order: "123", Status: entity.AccrualProcessed, Accrual: 10}, info)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+	assert.Equal(t, entity.AccrualBreakerClosed, client.BreakerState().Status)
+}
+
+func TestClient_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("boom"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, NewCircuitBreaker(0, 0))
+
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	assert.Equal(t, "unexpected status 500: boom", err.Error())
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+}
+
+func TestClient_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, NewCircuitBreaker(1, time.Minute))
+
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	require.Error(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+	assert.Equal(t, entity.AccrualBreakerClosed, client.BreakerState().Status, "4xx means the service is up")
+}
+
+func TestClient_RetriesNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := newTestClient(url, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, NewCircuitBreaker(2, time.Minute))
+
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	require.Error(t, err)
+	assert.Equal(t, entity.AccrualBreakerOpen, client.BreakerState().Status, "both attempts count as failures")
+
+	_, err = client.GetOrderInfo(context.Background(), "123")
+	assert.ErrorIs(t, err, entity.ErrAccrualCircuitOpen)
+}
+
+func TestClient_BreakerRecoversThroughProbe(t *testing.T) {
+	var healthy atomic.Bool
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	breaker, clock := newTestBreaker(2, 30*time.Second)
+	client := newTestClient(server.URL, RetryPolicy{MaxAttempts: 1}, breaker)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetOrderInfo(context.Background(), "123")
+		require.Error(t, err)
+	}
+	state := client.BreakerState()
+	assert.True(t, state.Open(clock.now()))
+
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	assert.True(t, errors.Is(err, entity.ErrAccrualCircuitOpen))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls), "an open breaker does not reach the server")
+
+	healthy.Store(true)
+	clock.advance(30 * time.Second)
+	info, err := client.GetOrderInfo(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+	assert.Equal(t, entity.AccrualBreakerClosed, client.BreakerState().Status)
+}
+
+func TestClient_CancelledRetryKeepsLastError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}, NewCircuitBreaker(0, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetOrderInfo(ctx, "123")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Less(t, time.Since(start), time.Second, "the backoff sleep honours the context")
+}
+
+func TestClient_RegisterOrder(t *testing.T) {
+	var calls int64
+	var got registerOrderRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/orders", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+		switch atomic.AddInt64(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusAccepted)
+		case 3:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, NewCircuitBreaker(0, 0))
+	ctx := context.Background()
+	goods := []entity.Good{{Description: "Чайник Bork", Price: 7000}}
+
+	require.NoError(t, client.RegisterOrder(ctx, "12345678903", goods), "a 503 is retried")
+	assert.Equal(t, registerOrderRequest{Order: "12345678903", Goods: goods}, got)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+
+	assert.ErrorIs(t, client.RegisterOrder(ctx, "12345678903", nil), entity.ErrAccrualAlreadyRegistered)
+	assert.Equal(t, []entity.Good{}, got.Goods, "goods are always sent as a list")
+
+	var rlErr *entity.AccrualRateLimitError
+	require.ErrorAs(t, client.RegisterOrder(ctx, "12345678903", goods), &rlErr)
+	assert.Equal(t, 5*time.Second, rlErr.RetryAfter)
+	assert.True(t, client.RateLimitState().Paused(time.Now()), "a 429 on registration pauses polling too")
+}
+
+func TestClient_ObservesEveryRequest(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var outcomes []string
+	client := NewClient(server.URL,
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		WithRequestObserver(func(method, outcome string, _ time.Duration) {
+			outcomes = append(outcomes, method+" "+outcome)
+		}),
+	)
+	client.jitter = func() float64 { return 0 }
+
+	_, err := client.GetOrderInfo(context.Background(), "123")
+	require.NoError(t, err)
+
+	server.Close()
+	_, err = client.GetOrderInfo(context.Background(), "456")
+	require.Error(t, err)
+
+	assert.Equal(t, []string{"GET 502", "GET 204", "GET error", "GET error", "GET error"}, outcomes)
+}
@@ -0,0 +1,22 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event is the envelope delivered to publishers. ID is stable across
+// redeliveries so that consumers can drop duplicates.
+type Event struct {
+	ID         uint            `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// Publisher delivers an event to an external system. Delivery is
+// at-least-once: a nil error means the event will not be sent again.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
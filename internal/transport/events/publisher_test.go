@@ -0,0 +1,70 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent() Event {
+	return Event{
+		ID:         42,
+		Type:       "PointsAccrued",
+		OccurredAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Payload:    json.RawMessage(`{"order_number":"12345678903","user_id":"1","amount":500}`),
+	}
+}
+
+func TestWebhookPublisher_Publish(t *testing.T) {
+	var got Event
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	err := NewWebhookPublisher(server.URL, time.Second).Publish(context.Background(), testEvent())
+	require.NoError(t, err)
+
+	assert.Equal(t, "42", headers.Get(HeaderEventID))
+	assert.Equal(t, "PointsAccrued", headers.Get(HeaderEventType))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, testEvent().ID, got.ID)
+	assert.JSONEq(t, string(testEvent().Payload), string(got.Payload))
+}
+
+func TestWebhookPublisher_NonSuccessStatusFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := NewWebhookPublisher(server.URL, time.Second).Publish(context.Background(), testEvent())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
+
+func TestWriterPublisher_WritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWriterPublisher(&buf)
+
+	require.NoError(t, p.Publish(context.Background(), testEvent()))
+	require.NoError(t, p.Publish(context.Background(), testEvent()))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var got Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	assert.Equal(t, "PointsAccrued", got.Type)
+	assert.True(t, testEvent().OccurredAt.Equal(got.OccurredAt))
+}
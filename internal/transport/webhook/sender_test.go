@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"order_number":"12345678903","status":"PROCESSED"}`)
+
+	sig := Sign("secret", 1700000000, body)
+	assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, sig)
+	assert.True(t, Verify("secret", 1700000000, body, sig))
+	assert.False(t, Verify("other", 1700000000, body, sig))
+	assert.False(t, Verify("secret", 1700000001, body, sig))
+	assert.False(t, Verify("secret", 1700000000, append(body, ' '), sig))
+}
+
+func TestSender_SendsSignedPayload(t *testing.T) {
+	payload := []byte(`{"order_number":"12345678903","status":"PROCESSED","accrual":500}`)
+	var verified bool
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers = r.Header.Clone()
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		verified = Verify("s3cret", ts, body, r.Header.Get(HeaderSignature))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	status, err := NewSender(time.Second, WithPrivateNetworks()).Send(context.Background(), Delivery{
+		ID:        7,
+		URL:       server.URL,
+		Secret:    "s3cret",
+		EventType: "OrderStatusChanged",
+		Payload:   payload,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.True(t, verified, "receiver must be able to verify the signature")
+	assert.Equal(t, "7", headers.Get(HeaderDelivery))
+	assert.Equal(t, "OrderStatusChanged", headers.Get(HeaderEvent))
+}
+
+func TestSender_ReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	url := server.URL
+
+	status, err := NewSender(time.Second, WithPrivateNetworks()).Send(context.Background(), Delivery{URL: url, Payload: []byte(`{}`)})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	server.Close()
+	status, err = NewSender(time.Second, WithPrivateNetworks()).Send(context.Background(), Delivery{URL: url, Payload: []byte(`{}`)})
+	require.Error(t, err)
+	assert.Zero(t, status)
+}
+
+func TestSender_RefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	status, err := NewSender(time.Second).Send(context.Background(), Delivery{URL: server.URL, Payload: []byte(`{}`)})
+	require.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.Zero(t, status)
+	assert.False(t, called, "loopback must not be reached")
+}
+
+func TestSender_DoesNotFollowRedirects(t *testing.T) {
+	var followed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	sender := NewSender(time.Second, WithPrivateNetworks())
+	status, err := sender.Send(context.Background(), Delivery{URL: server.URL, Payload: []byte(`{}`)})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusTemporaryRedirect, status)
+	assert.False(t, followed)
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::1":   true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"100.64.0.1":           false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:93.184.216.34": true,
+	}
+	for addr, public := range tests {
+		assert.Equal(t, public, isPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
@@ -2,123 +2,464 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"gophemart/internal/app/entity"
+	"gophemart/internal/app/provider"
 	"gophemart/internal/app/repository"
-	"gophemart/internal/transport/accrual"
+	"gophemart/internal/backoff"
+	"gophemart/internal/config"
+	"gophemart/internal/metrics"
+	"gophemart/internal/tracing"
 	"gophemart/pkg/logger"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type OrderProcessor struct {
-	orderRepo  repository.OrderRepository
-	userRepo   repository.UserRepository
-	accrualCli *accrual.Client
+	orderRepo     repository.OrderRepository
+	accrual       provider.AccrualProvider
+	registrar     provider.AccrualRegistrar
+	workers       int
+	orderTimeout  time.Duration
+	batchSize     int
+	leaseDuration time.Duration
+	retryBase     time.Duration
+	retryMax      time.Duration
+	maxAttempts   int
+	jitter        func() float64
+	wake          chan struct{}
+	// lastCycle holds the UnixNano time the last cycle completed at.
+	lastCycle atomic.Int64
+}
+
+// attemptOutcome tells processWithDeadline what to do with the order's claim
+// once the accrual service has been polled.
+type attemptOutcome int
+
+const (
+	// attemptFinished: the order reached a final status.
+	attemptFinished attemptOutcome = iota
+	// attemptPending: accrual is still working on the order, poll again later.
+	attemptPending
+	// attemptFailed: no usable answer; counts towards MaxAttempts.
+	attemptFailed
+	// attemptPostponed: the accrual service is rate limited or its circuit
+	// breaker is open; not the order's fault.
+	attemptPostponed
+)
+
+// minCycleInterval keeps Run from spinning when a due retry is still leased
+// by another replica.
+const minCycleInterval = 100 * time.Millisecond
+
+type orderJob struct {
+	order entity.Order
+	done  *sync.WaitGroup
+}
+
+type ProcessorOption func(*OrderProcessor)
+
+// WithRegistrar enables push mode: orders are registered with the accrual
+// system, goods included, before they are first polled.
+func WithRegistrar(registrar provider.AccrualRegistrar) ProcessorOption {
+	return func(p *OrderProcessor) {
+		p.registrar = registrar
+	}
 }
 
 func NewOrderProcessor(
 	orderRepo repository.OrderRepository,
-	userRepo repository.UserRepository,
-	accrualCli *accrual.Client,
+	accrualProvider provider.AccrualProvider,
+	cfg config.WorkerConfig,
+	opts ...ProcessorOption,
 ) *OrderProcessor {
-	return &OrderProcessor{
-		orderRepo:  orderRepo,
-		userRepo:   userRepo,
-		accrualCli: accrualCli,
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	// The whole batch is leased at once but drained by the workers in
+	// ceil(batchSize/workers) rounds, each bounded by the per-order deadline.
+	// A shorter lease would let another replica claim the tail of the batch
+	// while it is still queued.
+	rounds := (batchSize + workers - 1) / workers
+	leaseDuration := cfg.LeaseDuration
+	if minLease := time.Duration(rounds+1) * cfg.OrderTimeout; leaseDuration < minLease {
+		leaseDuration = minLease
+	}
+	if leaseDuration <= 0 {
+		leaseDuration = time.Minute
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 10
 	}
+	p := &OrderProcessor{
+		orderRepo:     orderRepo,
+		accrual:       accrualProvider,
+		workers:       workers,
+		orderTimeout:  cfg.OrderTimeout,
+		batchSize:     batchSize,
+		leaseDuration: leaseDuration,
+		retryBase:     cfg.RetryBaseDelay,
+		retryMax:      cfg.RetryMaxDelay,
+		maxAttempts:   maxAttempts,
+		jitter:        backoff.Jitter,
+		wake:          make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Wake asks Run to start a processing cycle now instead of at the next sweep.
+// Wakeups that arrive while one is already pending are coalesced.
+func (p *OrderProcessor) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// OrderUploaded implements service.OrderNotifier for the local replica.
+func (p *OrderProcessor) OrderUploaded(context.Context, string) {
+	p.Wake()
 }
 
-func (p *OrderProcessor) Run(ctx context.Context, interval time.Duration) {
-	logger.Info().
-		Dur("interval_seconds", interval).
+// Run processes pending orders on a pool of workers whenever it is woken (see
+// Wake), when a scheduled retry falls due, and at least every sweepInterval as
+// a fallback for missed notifications. When ctx is cancelled no new orders are
+// dispatched and Run returns once the orders already handed to workers are
+// finished.
+func (p *OrderProcessor) Run(ctx context.Context, sweepInterval time.Duration) {
+	logger.FromContext(ctx).Info().
+		Dur("sweep_interval", sweepInterval).
+		Int("workers", p.workers).
 		Msg("Starting order processor worker")
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	jobs, stop := p.startWorkers(ctx)
+	defer stop()
+
+	// Sweep once on start to pick up orders left over from a previous run.
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info().Msg("Order processor stopped by context")
+			logger.FromContext(ctx).Info().Msg("Order processor stopped by context, draining workers")
 			return
-		case <-ticker.C:
-			start := time.Now()
-			logger.Debug().Msg("Starting order processing cycle")
-			p.processOrders(ctx)
-			logger.Debug().
-				Dur("duration_ms", time.Since(start)).
-				Msg("Order processing cycle completed")
+		case <-p.wake:
+		case <-timer.C:
 		}
+
+		start := time.Now()
+		logger.FromContext(ctx).Debug().Msg("Starting order processing cycle")
+		claimed := p.processOrders(ctx, jobs)
+		duration := time.Since(start)
+		logger.FromContext(ctx).Debug().
+			Dur("duration_ms", duration).
+			Msg("Order processing cycle completed")
+		metrics.ObserveWorkerCycle(duration)
+		p.reportPending(ctx)
+		p.lastCycle.Store(time.Now().UnixNano())
+
+		timer.Reset(p.nextCycleIn(ctx, claimed, sweepInterval))
 	}
 }
 
-func (p *OrderProcessor) processOrders(ctx context.Context) {
-	logger.Debug().Msg("Fetching pending orders")
+// LastCycleAt returns when Run last completed a processing cycle, or the
+// zero time if it has not completed one yet.
+func (p *OrderProcessor) LastCycleAt() time.Time {
+	if nanos := p.lastCycle.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
 
-	orders, err := p.orderRepo.FindPending(ctx)
+// MaxCycleDuration is the longest a healthy cycle may take: a batch is
+// claimed for leaseDuration, which covers processing all of it.
+func (p *OrderProcessor) MaxCycleDuration() time.Duration {
+	return p.leaseDuration
+}
+
+// reportPending refreshes the pending orders gauge after a cycle.
+func (p *OrderProcessor) reportPending(ctx context.Context) {
+	count, err := p.orderRepo.CountPending(ctx)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Warn().
 			Err(err).
-			Msg("Failed to get pending orders from repository")
+			Msg("Failed to count pending orders")
 		return
 	}
+	metrics.SetPendingOrders(count)
+}
+
+// nextCycleIn decides how long Run may sleep: immediately if the last batch was
+// full, until the rate-limit pause or the earliest scheduled retry ends, and
+// never longer than sweepInterval.
+func (p *OrderProcessor) nextCycleIn(ctx context.Context, claimed int, sweepInterval time.Duration) time.Duration {
+	if claimed >= p.batchSize {
+		return 0
+	}
+
+	now := time.Now()
+	if until, paused := p.accrual.PausedUntil(now); paused {
+		return until.Sub(now)
+	}
+
+	wait := sweepInterval
+	next, err := p.orderRepo.NextAttemptAt(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Msg("Failed to find next scheduled order attempt, waiting for the sweep")
+		return wait
+	}
+	if next != nil && next.Sub(now) < wait {
+		wait = next.Sub(now)
+	}
+	return max(wait, minCycleInterval)
+}
+
+// startWorkers launches the worker pool. The returned function closes the job
+// queue and blocks until every worker has exited.
+func (p *OrderProcessor) startWorkers(ctx context.Context) (chan<- orderJob, func()) {
+	jobs := make(chan orderJob)
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for job := range jobs {
+				p.processWithDeadline(ctx, job.order)
+				job.done.Done()
+			}
+			logger.FromContext(ctx).Debug().
+				Int("worker_id", id).
+				Msg("Order worker stopped")
+		}(i)
+	}
+
+	return jobs, func() {
+		close(jobs)
+		wg.Wait()
+		logger.FromContext(ctx).Info().Msg("Order processor workers drained")
+	}
+}
+
+// processWithDeadline detaches the order from ctx cancellation so that an
+// in-flight order is finished during shutdown, bounded by orderTimeout.
+func (p *OrderProcessor) processWithDeadline(ctx context.Context, order entity.Order) {
+	orderCtx := logger.WithStr(context.WithoutCancel(ctx), "order_number", order.Number)
+	if p.orderTimeout > 0 {
+		var cancel context.CancelFunc
+		orderCtx, cancel = context.WithTimeout(orderCtx, p.orderTimeout)
+		defer cancel()
+	}
+	orderCtx, span := tracing.Start(orderCtx, "OrderProcessor.processOrder",
+		attribute.String("order_number", order.Number),
+		attribute.Int("attempt_count", order.AttemptCount),
+	)
+	defer span.End()
+
+	outcome, reason := p.processOrder(orderCtx, order)
+	p.finishAttempt(orderCtx, order, outcome, reason)
+	if outcome == attemptFailed {
+		span.SetStatus(codes.Error, reason)
+	}
+}
+
+// finishAttempt releases the order's claim and schedules its next poll.
+// Consecutive failures back off exponentially and park the order after
+// maxAttempts so that a poison order stops being polled.
+func (p *OrderProcessor) finishAttempt(ctx context.Context, order entity.Order, outcome attemptOutcome, reason string) {
+	lease := leaseOf(order)
+	var err error
+	switch outcome {
+	case attemptPending:
+		next := time.Now().Add(backoff.Delay(1, p.retryBase, p.retryMax, p.jitter))
+		err = p.orderRepo.ScheduleRetry(ctx, order.Number, lease, 0, next, "")
+	case attemptFailed:
+		attempts := order.AttemptCount + 1
+		if attempts >= p.maxAttempts {
+			logger.FromContext(ctx).Warn().
+				Int("attempt_count", attempts).
+				Str("last_error", reason).
+				Msg("Order exceeded max attempts, parking it")
+			err = p.orderRepo.Park(ctx, order.Number, lease, attempts, reason)
+			break
+		}
+		next := time.Now().Add(backoff.Delay(attempts, p.retryBase, p.retryMax, p.jitter))
+		logger.FromContext(ctx).Debug().
+			Int("attempt_count", attempts).
+			Time("next_attempt_at", next).
+			Msg("Order attempt failed, backing off")
+		err = p.orderRepo.ScheduleRetry(ctx, order.Number, lease, attempts, next, reason)
+	default:
+		err = p.orderRepo.ReleaseClaim(ctx, order.Number, lease)
+	}
+	logReleaseError(ctx, err)
+}
+
+// leaseOf returns the lease ClaimPending stamped on order.
+func leaseOf(order entity.Order) time.Time {
+	if order.LeaseExpiresAt == nil {
+		return time.Time{}
+	}
+	return *order.LeaseExpiresAt
+}
+
+// logReleaseError expects the order number in ctx's logger.
+func logReleaseError(ctx context.Context, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrLeaseLost):
+		logger.FromContext(ctx).Warn().
+			Msg("Order lease expired before the attempt was recorded, another worker owns the order now")
+	default:
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Msg("Failed to release order claim, it will expire on its own")
+	}
+}
+
+// processOrders claims a batch of pending orders, hands it to the workers and
+// returns the number of orders claimed.
+func (p *OrderProcessor) processOrders(ctx context.Context, jobs chan<- orderJob) int {
+	if until, paused := p.accrual.PausedUntil(time.Now()); paused {
+		logger.FromContext(ctx).Info().
+			Time("paused_until", until).
+			Msg("Accrual service unavailable, skipping processing cycle")
+		return 0
+	}
+
+	logger.FromContext(ctx).Debug().Msg("Claiming pending orders")
+
+	orders, err := p.orderRepo.ClaimPending(ctx, p.batchSize, p.leaseDuration)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Failed to claim pending orders from repository")
+		return 0
+	}
 
 	if len(orders) == 0 {
-		logger.Debug().Msg("No pending orders found")
-		return
+		logger.FromContext(ctx).Debug().Msg("No pending orders found")
+		return 0
 	}
 
-	logger.Info().
+	logger.FromContext(ctx).Info().
 		Int("order_count", len(orders)).
 		Msg("Processing pending orders")
 
+	var batch sync.WaitGroup
+	dispatched := 0
+dispatch:
 	for _, order := range orders {
-		p.processOrder(ctx, order)
+		if until, paused := p.accrual.PausedUntil(time.Now()); paused {
+			logger.FromContext(ctx).Info().
+				Time("paused_until", until).
+				Msg("Accrual service unavailable, postponing remaining orders")
+			break
+		}
+
+		batch.Add(1)
+		select {
+		case jobs <- orderJob{order: order, done: &batch}:
+			dispatched++
+		case <-ctx.Done():
+			batch.Done()
+			logger.FromContext(ctx).Info().Msg("Shutdown requested, stopping order dispatch")
+			break dispatch
+		}
+	}
+	batch.Wait()
+
+	p.releaseClaims(context.WithoutCancel(ctx), orders[dispatched:])
+	return len(orders)
+}
+
+// releaseClaims hands undispatched orders back so that other replicas do not
+// have to wait for their leases to expire.
+func (p *OrderProcessor) releaseClaims(ctx context.Context, orders []entity.Order) {
+	for _, order := range orders {
+		orderCtx := logger.WithStr(ctx, "order_number", order.Number)
+		logReleaseError(orderCtx, p.orderRepo.ReleaseClaim(orderCtx, order.Number, leaseOf(order)))
 	}
 }
 
-func (p *OrderProcessor) processOrder(ctx context.Context, order entity.Order) {
-	logger.Debug().
-		Str("order_number", order.Number).
+func (p *OrderProcessor) processOrder(ctx context.Context, order entity.Order) (attemptOutcome, string) {
+	logger.FromContext(ctx).Debug().
 		Str("current_status", string(order.Status)).
 		Str("user_id", order.UserID).
 		Msg("Processing order")
 
-	info, err := p.accrualCli.GetOrderInfo(ctx, order.Number)
+	if p.registrar != nil && order.AccrualRegisteredAt == nil {
+		if outcome, lastError, ok := p.registerOrder(ctx, order); !ok {
+			return outcome, lastError
+		}
+	}
+
+	info, err := p.accrual.GetOrderInfo(ctx, order.Number)
 	if err != nil {
-		if rateLimitErr, ok := err.(*accrual.RateLimitError); ok {
-			logger.Warn().
+		var rateLimitErr *entity.AccrualRateLimitError
+		if errors.As(err, &rateLimitErr) {
+			logger.FromContext(ctx).Warn().
 				Err(rateLimitErr).
-				Str("order_number", order.Number).
 				Dur("retry_after", rateLimitErr.RetryAfter).
-				Msg("Accrual service rate limit exceeded, skipping order for now")
-			return
+				Msg("Accrual service rate limited, order will be retried after the pause")
+			return attemptPostponed, ""
+		}
+		if errors.Is(err, entity.ErrAccrualCircuitOpen) {
+			logger.FromContext(ctx).Warn().
+				Msg("Accrual service circuit breaker is open, order will be retried later")
+			return attemptPostponed, ""
 		}
 
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
-			Str("order_number", order.Number).
 			Msg("Failed to get order info from accrual service")
-		return
+		return attemptFailed, err.Error()
 	}
 
 	if info == nil {
-		logger.Debug().
-			Str("order_number", order.Number).
+		logger.FromContext(ctx).Debug().
 			Msg("Order not found in accrual system")
-		return
+		return attemptFailed, "order not registered in accrual system"
 	}
 
-	newStatus := entity.OrderStatus(info.Status)
+	newStatus, err := toOrderStatus(info.Status)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Accrual service returned an unknown order status")
+		return attemptFailed, err.Error()
+	}
 	if newStatus == order.Status {
-		logger.Debug().
-			Str("order_number", order.Number).
+		logger.FromContext(ctx).Debug().
 			Str("status", string(newStatus)).
 			Msg("Order status unchanged, skipping update")
-		return
+		return pendingOrFinished(newStatus), ""
+	}
+
+	if err := entity.ValidateTransition(order.Status, newStatus); err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Str("accrual_status", string(info.Status)).
+			Msg("Accrual service reported an illegal status transition")
+		return attemptFailed, err.Error()
 	}
 
-	logger.Info().
-		Str("order_number", order.Number).
+	logger.FromContext(ctx).Info().
 		Str("old_status", string(order.Status)).
 		Str("new_status", string(newStatus)).
 		Float64("accrual", info.Accrual).
@@ -126,40 +467,58 @@ func (p *OrderProcessor) processOrder(ctx context.Context, order entity.Order) {
 
 	err = p.orderRepo.UpdateStatus(ctx, order.Number, newStatus, info.Accrual)
 	if err != nil {
-		logger.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
-			Str("order_number", order.Number).
 			Str("new_status", string(newStatus)).
 			Msg("Failed to update order status in repository")
-		return
+		return attemptFailed, err.Error()
 	}
 
 	if newStatus == entity.OrderProcessed && info.Accrual > 0 {
-		logger.Info().
-			Str("order_number", order.Number).
+		metrics.AddPointsAccrued(info.Accrual)
+		logger.FromContext(ctx).Info().
 			Str("user_id", order.UserID).
 			Float64("accrual", info.Accrual).
-			Msg("Adding accrual to user balance")
-
-		err = p.userRepo.AddBalance(ctx, order.UserID, info.Accrual)
-		if err != nil {
-			logger.Error().
-				Err(err).
-				Str("order_number", order.Number).
-				Str("user_id", order.UserID).
-				Float64("accrual", info.Accrual).
-				Msg("Failed to add accrual to user balance")
-		} else {
-			logger.Info().
-				Str("order_number", order.Number).
-				Str("user_id", order.UserID).
-				Float64("accrual", info.Accrual).
-				Msg("Accrual successfully added to user balance")
-		}
+			Msg("Accrual credited to user balance")
 	}
 
-	logger.Info().
-		Str("order_number", order.Number).
+	logger.FromContext(ctx).Info().
 		Str("new_status", string(newStatus)).
 		Msg("Order processing completed")
+	return pendingOrFinished(newStatus), ""
+}
+
+// registerOrder pushes the order to the accrual system. ok is false when
+// polling has to wait for a later attempt.
+func (p *OrderProcessor) registerOrder(ctx context.Context, order entity.Order) (attemptOutcome, string, bool) {
+	err := p.registrar.RegisterOrder(ctx, order.Number, order.Goods)
+	var rateLimitErr *entity.AccrualRateLimitError
+	switch {
+	case err == nil, errors.Is(err, entity.ErrAccrualAlreadyRegistered):
+	case errors.As(err, &rateLimitErr), errors.Is(err, entity.ErrAccrualCircuitOpen):
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Msg("Accrual service unavailable, order registration will be retried later")
+		return attemptPostponed, "", false
+	default:
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Failed to register order in accrual system")
+		return attemptFailed, err.Error(), false
+	}
+
+	if err := p.orderRepo.MarkRegistered(ctx, order.Number); err != nil {
+		// Harmless: the next attempt registers again and gets a 409.
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Msg("Failed to mark order as registered")
+	}
+	return 0, "", true
+}
+
+func pendingOrFinished(status entity.OrderStatus) attemptOutcome {
+	if status.IsFinal() {
+		return attemptFinished
+	}
+	return attemptPending
 }
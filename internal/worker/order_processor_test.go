@@ -0,0 +1,720 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/config"
+	"gophemart/internal/transport/accrual"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOrderRepository struct {
+	repository.OrderRepository
+
+	mu       sync.Mutex
+	pending  []entity.Order
+	updated  map[string]entity.OrderStatus
+	balances map[string]float64
+	leases   map[string]time.Time
+	claims   map[string]int
+	retries  map[string]time.Time
+	parked   map[string]string
+}
+
+func newFakeOrderRepository(count int) *fakeOrderRepository {
+	r := &fakeOrderRepository{
+		updated:  make(map[string]entity.OrderStatus),
+		balances: make(map[string]float64),
+		leases:   make(map[string]time.Time),
+		claims:   make(map[string]int),
+		retries:  make(map[string]time.Time),
+		parked:   make(map[string]string),
+	}
+	for i := 0; i < count; i++ {
+		r.pending = append(r.pending, entity.Order{
+			Number: fmt.Sprintf("%d", 1000+i),
+			UserID: "1",
+			Status: entity.OrderNew,
+		})
+	}
+	return r
+}
+
+func (r *fakeOrderRepository) FindPending(context.Context) ([]entity.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []entity.Order
+	for _, o := range r.pending {
+		if _, done := r.updated[o.Number]; !done {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (r *fakeOrderRepository) CountPending(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, o := range r.pending {
+		_, parked := r.parked[o.Number]
+		if status, ok := r.updated[o.Number]; !parked && (!ok || status == entity.OrderProcessing) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeOrderRepository) ClaimPending(_ context.Context, limit int, lease time.Duration) ([]entity.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var orders []entity.Order
+	for _, o := range r.pending {
+		if len(orders) == limit {
+			break
+		}
+		if _, done := r.updated[o.Number]; done {
+			continue
+		}
+		if until, leased := r.leases[o.Number]; leased && until.After(now) {
+			continue
+		}
+		if _, parked := r.parked[o.Number]; parked {
+			continue
+		}
+		if next, ok := r.retries[o.Number]; ok && next.After(now) {
+			continue
+		}
+		until := now.Add(lease)
+		r.leases[o.Number] = until
+		r.claims[o.Number]++
+		o.LeaseExpiresAt = &until
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+func (r *fakeOrderRepository) MarkRegistered(_ context.Context, number string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for i := range r.pending {
+		if r.pending[i].Number == number {
+			r.pending[i].AccrualRegisteredAt = &now
+		}
+	}
+	return nil
+}
+
+// holdsLease mirrors the lease_expires_at guard of the SQL repository.
+func (r *fakeOrderRepository) holdsLease(number string, lease time.Time) bool {
+	until, ok := r.leases[number]
+	return ok && until.Equal(lease)
+}
+
+func (r *fakeOrderRepository) ReleaseClaim(_ context.Context, number string, lease time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.holdsLease(number, lease) {
+		return repository.ErrLeaseLost
+	}
+	delete(r.leases, number)
+	return nil
+}
+
+func (r *fakeOrderRepository) ScheduleRetry(
+	_ context.Context,
+	number string,
+	lease time.Time,
+	attempts int,
+	next time.Time,
+	_ string,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.holdsLease(number, lease) {
+		return repository.ErrLeaseLost
+	}
+	r.setAttempts(number, attempts)
+	r.retries[number] = next
+	delete(r.leases, number)
+	return nil
+}
+
+func (r *fakeOrderRepository) Park(_ context.Context, number string, lease time.Time, attempts int, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.holdsLease(number, lease) {
+		return repository.ErrLeaseLost
+	}
+	r.setAttempts(number, attempts)
+	r.parked[number] = lastError
+	delete(r.leases, number)
+	return nil
+}
+
+func (r *fakeOrderRepository) NextAttemptAt(context.Context) (*time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var next *time.Time
+	for number, at := range r.retries {
+		if _, parked := r.parked[number]; parked {
+			continue
+		}
+		if next == nil || at.Before(*next) {
+			at := at
+			next = &at
+		}
+	}
+	return next, nil
+}
+
+func (r *fakeOrderRepository) setAttempts(number string, attempts int) {
+	for i := range r.pending {
+		if r.pending[i].Number == number {
+			r.pending[i].AttemptCount = attempts
+		}
+	}
+}
+
+func (r *fakeOrderRepository) UpdateStatus(_ context.Context, number string, status entity.OrderStatus, accrual float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updated[number] = status
+	if status == entity.OrderProcessed {
+		for _, o := range r.pending {
+			if o.Number == number {
+				r.balances[o.UserID] += accrual
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrderRepository) updatedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.updated)
+}
+
+// newSlowAccrualServer answers every order as PROCESSED after latency.
+func newSlowAccrualServer(latency time.Duration, inFlight *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(inFlight, 1)
+		defer atomic.AddInt64(inFlight, -1)
+
+		time.Sleep(latency)
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entity.AccrualOrderInfo{
+			Order:   number,
+			Status:  entity.AccrualProcessed,
+			Accrual: 10,
+		})
+	}))
+}
+
+func runBatch(t *testing.T, workers, orders int, latency time.Duration) time.Duration {
+	t.Helper()
+
+	var inFlight int64
+	server := newSlowAccrualServer(latency, &inFlight)
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(orders)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      workers,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	jobs, stop := p.startWorkers(ctx)
+	start := time.Now()
+	p.processOrders(ctx, jobs)
+	elapsed := time.Since(start)
+	stop()
+
+	require.Equal(t, orders, orderRepo.updatedCount())
+	assert.InDelta(t, float64(orders*10), orderRepo.balances["1"], 0.001)
+	return elapsed
+}
+
+func TestOrderProcessor_ThroughputScalesWithWorkers(t *testing.T) {
+	const (
+		orders  = 16
+		latency = 50 * time.Millisecond
+	)
+
+	sequential := runBatch(t, 1, orders, latency)
+	parallel := runBatch(t, 8, orders, latency)
+
+	t.Logf("1 worker: %v, 8 workers: %v", sequential, parallel)
+	assert.GreaterOrEqual(t, sequential, time.Duration(orders)*latency)
+	assert.Less(t, parallel, sequential/3)
+}
+
+func TestOrderProcessor_BoundedConcurrency(t *testing.T) {
+	var inFlight, peak int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			old := atomic.LoadInt64(&peak)
+			if n <= old || atomic.CompareAndSwapInt64(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := NewOrderProcessor(newFakeOrderRepository(20), accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      3,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	jobs, stop := p.startWorkers(ctx)
+	p.processOrders(ctx, jobs)
+	stop()
+
+	assert.LessOrEqual(t, atomic.LoadInt64(&peak), int64(3))
+}
+
+func TestOrderProcessor_DrainsOnShutdown(t *testing.T) {
+	var inFlight int64
+	server := newSlowAccrualServer(200*time.Millisecond, &inFlight)
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(4)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      4,
+		OrderTimeout: time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&inFlight) == 4
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("order processor did not stop")
+	}
+	assert.Equal(t, 4, orderRepo.updatedCount(), "in-flight orders must complete during shutdown")
+}
+
+func TestOrderProcessor_RateLimitPausesWholeBatch(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(10)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	jobs, stop := p.startWorkers(ctx)
+	p.processOrders(ctx, jobs)
+	p.processOrders(ctx, jobs)
+	stop()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls), "a 429 must pause the remaining orders and the next cycle")
+	assert.Zero(t, orderRepo.updatedCount())
+}
+
+func TestOrderProcessor_ReplicasShareClaimedOrders(t *testing.T) {
+	var inFlight int64
+	server := newSlowAccrualServer(20*time.Millisecond, &inFlight)
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(20)
+	cfg := config.WorkerConfig{Workers: 2, OrderTimeout: time.Second, BatchSize: 5, LeaseDuration: time.Minute}
+	replicas := []*OrderProcessor{
+		NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), cfg),
+		NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), cfg),
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, p := range replicas {
+		wg.Add(1)
+		go func(p *OrderProcessor) {
+			defer wg.Done()
+			jobs, stop := p.startWorkers(ctx)
+			defer stop()
+			for orderRepo.updatedCount() < 20 {
+				p.processOrders(ctx, jobs)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	for number, claims := range orderRepo.claims {
+		assert.Equal(t, 1, claims, "order %s was claimed more than once", number)
+	}
+	assert.Empty(t, orderRepo.leases, "claims must be released after processing")
+}
+
+func TestOrderProcessor_LeaseCoversWholeBatch(t *testing.T) {
+	p := NewOrderProcessor(newFakeOrderRepository(0), accrual.NewFake(), config.WorkerConfig{
+		Workers:       4,
+		BatchSize:     100,
+		OrderTimeout:  15 * time.Second,
+		LeaseDuration: 5 * time.Minute,
+	})
+	// 25 rounds of 15s each plus one round of slack.
+	assert.Equal(t, 26*15*time.Second, p.leaseDuration)
+	assert.Equal(t, p.leaseDuration, p.MaxCycleDuration(), "the worker health check must tolerate a whole batch")
+}
+
+func TestOrderProcessor_StaleLeaseDoesNotOverwriteNewClaim(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(1)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	stale, err := orderRepo.ClaimPending(ctx, 1, -time.Second)
+	require.NoError(t, err)
+	fresh, err := orderRepo.ClaimPending(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, fresh, 1, "an expired lease must be claimable")
+
+	p.processWithDeadline(ctx, stale[0])
+
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	assert.Zero(t, orderRepo.pending[0].AttemptCount, "the stale attempt must not be recorded")
+	assert.Equal(t, *fresh[0].LeaseExpiresAt, orderRepo.leases["1000"], "the new claim must be kept")
+}
+
+func TestOrderProcessor_BacksOffAndParksPoisonOrders(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(1)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:        1,
+		OrderTimeout:   time.Second,
+		RetryBaseDelay: time.Hour,
+		RetryMaxDelay:  time.Hour,
+		MaxAttempts:    3,
+	})
+	p.jitter = func() float64 { return 1 }
+
+	ctx := context.Background()
+	jobs, stop := p.startWorkers(ctx)
+	defer stop()
+
+	p.processOrders(ctx, jobs)
+	p.processOrders(ctx, jobs)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls), "a failed order must not be polled before its backoff elapses")
+
+	orderRepo.mu.Lock()
+	next := orderRepo.retries["1000"]
+	assert.Equal(t, 1, orderRepo.pending[0].AttemptCount)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), next, time.Minute)
+	// Pretend the backoff elapsed.
+	orderRepo.retries["1000"] = time.Now()
+	orderRepo.mu.Unlock()
+
+	p.processOrders(ctx, jobs)
+	orderRepo.mu.Lock()
+	assert.Equal(t, 2, orderRepo.pending[0].AttemptCount)
+	assert.NotContains(t, orderRepo.parked, "1000")
+	orderRepo.retries["1000"] = time.Now()
+	orderRepo.mu.Unlock()
+
+	p.processOrders(ctx, jobs)
+	orderRepo.mu.Lock()
+	assert.Equal(t, 3, orderRepo.pending[0].AttemptCount)
+	assert.Equal(t, "order not registered in accrual system", orderRepo.parked["1000"])
+	orderRepo.mu.Unlock()
+
+	p.processOrders(ctx, jobs)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls), "parked orders must not be polled")
+}
+
+func TestOrderProcessor_MapsAccrualStatuses(t *testing.T) {
+	statuses := map[string]entity.AccrualStatus{
+		"1000": entity.AccrualRegistered,
+		"1001": "CANCELLED",
+		"1002": entity.AccrualProcessing,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entity.AccrualOrderInfo{Order: number, Status: statuses[number], Accrual: 5})
+	}))
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(3)
+	orderRepo.pending[2].Status = entity.OrderProcessed
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	orders, err := orderRepo.ClaimPending(ctx, len(orderRepo.pending), time.Minute)
+	require.NoError(t, err)
+	for _, order := range orders {
+		p.processWithDeadline(ctx, order)
+	}
+
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	assert.Equal(t, entity.OrderProcessing, orderRepo.updated["1000"], "REGISTERED must be stored as PROCESSING")
+	assert.NotContains(t, orderRepo.updated, "1001", "unknown statuses must not be stored")
+	assert.Equal(t, 1, orderRepo.pending[1].AttemptCount)
+	assert.NotContains(t, orderRepo.updated, "1002", "PROCESSED -> PROCESSING is illegal")
+	assert.Equal(t, 1, orderRepo.pending[2].AttemptCount)
+}
+
+func TestOrderProcessor_WakeProcessesImmediately(t *testing.T) {
+	var inFlight int64
+	server := newSlowAccrualServer(0, &inFlight)
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(0)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx, time.Hour)
+
+	// Let the start-up sweep find nothing, then upload an order.
+	time.Sleep(50 * time.Millisecond)
+	orderRepo.mu.Lock()
+	orderRepo.pending = append(orderRepo.pending, entity.Order{Number: "1000", UserID: "1", Status: entity.OrderNew})
+	orderRepo.mu.Unlock()
+	p.OrderUploaded(ctx, "1000")
+
+	require.Eventually(t, func() bool {
+		return orderRepo.updatedCount() == 1
+	}, time.Second, 5*time.Millisecond, "an uploaded order must not wait for the sweep")
+}
+
+func TestOrderProcessor_IdleRunDoesNotPoll(t *testing.T) {
+	orderRepo := &countingOrderRepository{fakeOrderRepository: newFakeOrderRepository(0)}
+	p := NewOrderProcessor(orderRepo, accrual.NewClient("http://127.0.0.1:0"), config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	assert.True(t, p.LastCycleAt().IsZero(), "no cycle before Run")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx, time.Hour)
+		close(done)
+	}()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&orderRepo.claimCalls), "only the start-up sweep may run while idle")
+	assert.WithinDuration(t, time.Now(), p.LastCycleAt(), time.Second, "the start-up sweep counts as a cycle")
+}
+
+func TestOrderProcessor_WakesForScheduledRetry(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	orderRepo := newFakeOrderRepository(1)
+	p := NewOrderProcessor(orderRepo, accrual.NewClient(server.URL), config.WorkerConfig{
+		Workers:        1,
+		OrderTimeout:   time.Second,
+		RetryBaseDelay: 200 * time.Millisecond,
+		RetryMaxDelay:  200 * time.Millisecond,
+	})
+	p.jitter = func() float64 { return 1 }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx, time.Hour)
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&calls) >= 2
+	}, 2*time.Second, 10*time.Millisecond, "a due retry must be polled without waiting for the sweep")
+}
+
+type countingOrderRepository struct {
+	*fakeOrderRepository
+	claimCalls int64
+}
+
+func (r *countingOrderRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]entity.Order, error) {
+	atomic.AddInt64(&r.claimCalls, 1)
+	return r.fakeOrderRepository.ClaimPending(ctx, limit, lease)
+}
+
+func TestOrderProcessor_OpenBreakerPostponesOrders(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := accrual.NewClient(server.URL,
+		accrual.WithRetry(accrual.RetryPolicy{MaxAttempts: 1}),
+		accrual.WithCircuitBreaker(accrual.NewCircuitBreaker(1, time.Hour)),
+	)
+	orderRepo := newFakeOrderRepository(3)
+	p := NewOrderProcessor(orderRepo, client, config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+		MaxAttempts:  1,
+	})
+
+	ctx := context.Background()
+	orders, err := orderRepo.ClaimPending(ctx, len(orderRepo.pending), time.Minute)
+	require.NoError(t, err)
+	for _, order := range orders {
+		p.processWithDeadline(ctx, order)
+	}
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls), "an open breaker must stop further requests")
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	assert.Equal(t, 1, orderRepo.pending[0].AttemptCount)
+	assert.Zero(t, orderRepo.pending[1].AttemptCount, "orders skipped by the breaker must not count towards parking")
+	assert.Zero(t, orderRepo.pending[2].AttemptCount)
+
+	until, paused := client.PausedUntil(time.Now())
+	assert.True(t, paused)
+	assert.True(t, until.After(time.Now().Add(59*time.Minute)))
+}
+
+func TestOrderProcessor_WithFakeProvider(t *testing.T) {
+	fake := accrual.NewFake()
+	fake.SetOrder("1000", 25, entity.AccrualRegistered, entity.AccrualProcessed)
+	fake.SetOrder("1001", 0, entity.AccrualInvalid)
+
+	orderRepo := newFakeOrderRepository(2)
+	p := NewOrderProcessor(orderRepo, fake, config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	orders, err := orderRepo.ClaimPending(ctx, len(orderRepo.pending), time.Minute)
+	require.NoError(t, err)
+	for _, order := range orders {
+		p.processWithDeadline(ctx, order)
+	}
+	orderRepo.mu.Lock()
+	assert.Equal(t, entity.OrderProcessing, orderRepo.updated["1000"])
+	assert.Equal(t, entity.OrderInvalid, orderRepo.updated["1001"])
+	orderRepo.mu.Unlock()
+
+	p.processWithDeadline(ctx, entity.Order{Number: "1000", UserID: "1", Status: entity.OrderProcessing})
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	assert.Equal(t, entity.OrderProcessed, orderRepo.updated["1000"])
+	assert.Equal(t, 3, fake.Calls())
+}
+
+func TestOrderProcessor_PushModeRegistersBeforePolling(t *testing.T) {
+	fake := accrual.NewFake()
+	fake.SetOrder("1000", 10, entity.AccrualProcessed)
+	fake.RegisterOrder(context.Background(), "1001", nil)
+	fake.FailNext("1002", &entity.AccrualRateLimitError{RetryAfter: time.Minute})
+
+	orderRepo := newFakeOrderRepository(3)
+	orderRepo.pending[0].Goods = []entity.Good{{Description: "Bork", Price: 100}}
+	p := NewOrderProcessor(orderRepo, fake, config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	}, WithRegistrar(fake))
+
+	ctx := context.Background()
+	orders, err := orderRepo.ClaimPending(ctx, len(orderRepo.pending), time.Minute)
+	require.NoError(t, err)
+	for _, order := range orders {
+		p.processWithDeadline(ctx, order)
+	}
+
+	goods, ok := fake.Registered("1000")
+	require.True(t, ok)
+	assert.Equal(t, []entity.Good{{Description: "Bork", Price: 100}}, goods)
+
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	assert.Equal(t, entity.OrderProcessed, orderRepo.updated["1000"])
+	assert.NotNil(t, orderRepo.pending[0].AccrualRegisteredAt)
+	assert.NotNil(t, orderRepo.pending[1].AccrualRegisteredAt, "an order the accrual system already knows counts as registered")
+	assert.Nil(t, orderRepo.pending[2].AccrualRegisteredAt)
+	assert.Zero(t, orderRepo.pending[2].AttemptCount, "a rate-limited registration is postponed, not failed")
+}
+
+func TestOrderProcessor_WrappedRateLimitPostponesOrder(t *testing.T) {
+	fake := accrual.NewFake()
+	fake.SetOrder("1000", 10, entity.AccrualProcessed)
+	fake.FailNext("1000", fmt.Errorf("poll: %w", &entity.AccrualRateLimitError{RetryAfter: time.Minute}))
+
+	orderRepo := newFakeOrderRepository(1)
+	p := NewOrderProcessor(orderRepo, fake, config.WorkerConfig{
+		Workers:      1,
+		OrderTimeout: time.Second,
+	})
+
+	ctx := context.Background()
+	orders, err := orderRepo.ClaimPending(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	p.processWithDeadline(ctx, orders[0])
+
+	orderRepo.mu.Lock()
+	defer orderRepo.mu.Unlock()
+	assert.Zero(t, orderRepo.pending[0].AttemptCount, "a wrapped rate limit error postpones the order instead of failing it")
+}
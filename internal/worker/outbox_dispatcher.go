@@ -0,0 +1,186 @@
+package worker
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/backoff"
+	"gophemart/internal/config"
+	"gophemart/internal/transport/events"
+	"gophemart/pkg/logger"
+	"time"
+)
+
+// outboxCleanupPeriod is how often published events past the retention period
+// are deleted.
+const outboxCleanupPeriod = time.Hour
+
+// OutboxDispatcher publishes outbox events. Each batch is published in ID
+// order, but IDs are assigned on insert rather than on commit, concurrent
+// dispatchers publish separate batches in parallel and failed events are
+// retried later, so consumers must not rely on the order. An event is marked
+// published only after the publisher accepted it, so delivery is
+// at-least-once; failed events are retried with backoff. Published events are
+// deleted once they are older than the retention period.
+type OutboxDispatcher struct {
+	outboxRepo     repository.OutboxRepository
+	publisher      events.Publisher
+	batchSize      int
+	publishTimeout time.Duration
+	retryBase      time.Duration
+	retryMax       time.Duration
+	jitter         func() float64
+	retention      time.Duration
+	lastCleanup    time.Time
+}
+
+func NewOutboxDispatcher(
+	outboxRepo repository.OutboxRepository,
+	publisher events.Publisher,
+	cfg config.OutboxConfig,
+) *OutboxDispatcher {
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = 50
+	}
+	publishTimeout := cfg.PublishTimeout
+	if publishTimeout <= 0 {
+		publishTimeout = 5 * time.Second
+	}
+	return &OutboxDispatcher{
+		outboxRepo:     outboxRepo,
+		publisher:      publisher,
+		batchSize:      batchSize,
+		publishTimeout: publishTimeout,
+		retryBase:      cfg.RetryBaseDelay,
+		retryMax:       cfg.RetryMaxDelay,
+		jitter:         backoff.Jitter,
+		retention:      cfg.Retention,
+	}
+}
+
+// Run dispatches due events every interval until ctx is cancelled. A full
+// batch is followed by the next one immediately. Between batches it deletes
+// old published events every outboxCleanupPeriod.
+func (d *OutboxDispatcher) Run(ctx context.Context, interval time.Duration) {
+	logger.FromContext(ctx).Info().
+		Dur("interval", interval).
+		Int("batch_size", d.batchSize).
+		Msg("Starting outbox dispatcher")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if d.dispatch(ctx) == d.batchSize && ctx.Err() == nil {
+			continue
+		}
+		if time.Since(d.lastCleanup) >= outboxCleanupPeriod {
+			d.cleanup(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.FromContext(ctx).Info().Msg("Outbox dispatcher stopped by context")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch publishes one batch and returns the number of events claimed.
+func (d *OutboxDispatcher) dispatch(ctx context.Context) int {
+	// The lease must outlast publishing the whole batch one event at a time.
+	lease := time.Duration(d.batchSize) * d.publishTimeout
+	batch, err := d.outboxRepo.ClaimBatch(ctx, d.batchSize, lease)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Failed to claim outbox events")
+		return 0
+	}
+
+	for i, event := range batch {
+		if ctx.Err() != nil {
+			d.releaseEvents(context.WithoutCancel(ctx), batch[i:])
+			break
+		}
+		d.publish(ctx, event)
+	}
+	return len(batch)
+}
+
+func (d *OutboxDispatcher) publish(ctx context.Context, event entity.OutboxEvent) {
+	publishCtx, cancel := context.WithTimeout(ctx, d.publishTimeout)
+	defer cancel()
+
+	err := d.publisher.Publish(publishCtx, events.Event{
+		ID:         event.ID,
+		Type:       event.Type,
+		OccurredAt: event.CreatedAt,
+		Payload:    event.Payload,
+	})
+
+	// Bookkeeping must survive shutdown, otherwise the event is re-sent.
+	ctx = context.WithoutCancel(ctx)
+	if err == nil {
+		if err := d.outboxRepo.MarkPublished(ctx, event.ID); err != nil {
+			logger.FromContext(ctx).Warn().
+				Err(err).
+				Uint("event_id", event.ID).
+				Msg("Failed to mark outbox event published, it will be sent again")
+		}
+		return
+	}
+
+	attempts := event.Attempts + 1
+	next := time.Now().Add(backoff.Delay(attempts, d.retryBase, d.retryMax, d.jitter))
+	logger.FromContext(ctx).Warn().
+		Err(err).
+		Uint("event_id", event.ID).
+		Str("event_type", event.Type).
+		Int("attempts", attempts).
+		Time("next_attempt_at", next).
+		Msg("Failed to publish outbox event")
+
+	if err := d.outboxRepo.ScheduleRetry(ctx, event.ID, attempts, next, err.Error()); err != nil {
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Uint("event_id", event.ID).
+			Msg("Failed to schedule outbox event retry, it will be retried after its lease")
+	}
+}
+
+// cleanup deletes events published before the retention period; a zero
+// retention keeps them.
+func (d *OutboxDispatcher) cleanup(ctx context.Context) {
+	d.lastCleanup = time.Now()
+	if d.retention <= 0 {
+		return
+	}
+	deleted, err := d.outboxRepo.DeletePublishedBefore(ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Failed to delete published outbox events")
+		return
+	}
+	if deleted > 0 {
+		logger.FromContext(ctx).Debug().
+			Int64("deleted", deleted).
+			Msg("Deleted published outbox events")
+	}
+}
+
+// releaseEvents makes unpublished events of an interrupted batch due again.
+func (d *OutboxDispatcher) releaseEvents(ctx context.Context, batch []entity.OutboxEvent) {
+	now := time.Now()
+	for _, event := range batch {
+		if err := d.outboxRepo.ScheduleRetry(ctx, event.ID, event.Attempts, now, event.LastError); err != nil {
+			logger.FromContext(ctx).Warn().
+				Err(err).
+				Uint("event_id", event.ID).
+				Msg("Failed to release outbox event, it will be retried after its lease")
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/config"
+	"gophemart/internal/transport/events"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOutboxRepository struct {
+	mu     sync.Mutex
+	events map[uint]*entity.OutboxEvent
+}
+
+func newFakeOutboxRepository(types ...string) *fakeOutboxRepository {
+	r := &fakeOutboxRepository{events: make(map[uint]*entity.OutboxEvent)}
+	for i, eventType := range types {
+		id := uint(i + 1)
+		r.events[id] = &entity.OutboxEvent{ID: id, Type: eventType, Payload: []byte(`{}`)}
+	}
+	return r
+}
+
+func (r *fakeOutboxRepository) ClaimBatch(_ context.Context, limit int, lease time.Duration) ([]entity.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var batch []entity.OutboxEvent
+	for _, e := range r.events {
+		if e.PublishedAt == nil && !e.NextAttemptAt.After(now) {
+			batch = append(batch, *e)
+		}
+	}
+	sort.Slice(batch, func(i, j int) bool { return batch[i].ID < batch[j].ID })
+	if len(batch) > limit {
+		batch = batch[:limit]
+	}
+	for _, e := range batch {
+		r.events[e.ID].NextAttemptAt = now.Add(lease)
+	}
+	return batch, nil
+}
+
+func (r *fakeOutboxRepository) MarkPublished(_ context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.events[id].PublishedAt = &now
+	return nil
+}
+
+func (r *fakeOutboxRepository) ScheduleRetry(_ context.Context, id uint, attempts int, next time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.events[id]
+	e.Attempts = attempts
+	e.NextAttemptAt = next
+	e.LastError = lastError
+	return nil
+}
+
+func (r *fakeOutboxRepository) DeletePublishedBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, e := range r.events {
+		if e.PublishedAt != nil && e.PublishedAt.Before(before) {
+			delete(r.events, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *fakeOutboxRepository) has(id uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.events[id]
+	return ok
+}
+
+func (r *fakeOutboxRepository) event(id uint) entity.OutboxEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.events[id]
+}
+
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []uint
+	failures  map[uint]int
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures[event.ID] > 0 {
+		p.failures[event.ID]--
+		return errors.New("webhook responded with status 503")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func TestOutboxDispatcher_PublishesInOrder(t *testing.T) {
+	repo := newFakeOutboxRepository(entity.EventOrderProcessed, entity.EventPointsAccrued, entity.EventPointsWithdrawn)
+	publisher := &recordingPublisher{}
+	d := NewOutboxDispatcher(repo, publisher, config.OutboxConfig{BatchSize: 2})
+
+	assert.Equal(t, 2, d.dispatch(context.Background()))
+	assert.Equal(t, 1, d.dispatch(context.Background()))
+	assert.Equal(t, 0, d.dispatch(context.Background()))
+
+	assert.Equal(t, []uint{1, 2, 3}, publisher.published)
+	for id := uint(1); id <= 3; id++ {
+		assert.NotNil(t, repo.event(id).PublishedAt)
+	}
+}
+
+func TestOutboxDispatcher_RetriesFailedEvents(t *testing.T) {
+	repo := newFakeOutboxRepository(entity.EventPointsWithdrawn)
+	publisher := &recordingPublisher{failures: map[uint]int{1: 2}}
+	d := NewOutboxDispatcher(repo, publisher, config.OutboxConfig{
+		RetryBaseDelay: time.Hour,
+		RetryMaxDelay:  time.Hour,
+	})
+	d.jitter = func() float64 { return 1 }
+
+	d.dispatch(context.Background())
+	event := repo.event(1)
+	assert.Nil(t, event.PublishedAt)
+	assert.Equal(t, 1, event.Attempts)
+	assert.Contains(t, event.LastError, "503")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), event.NextAttemptAt, time.Minute)
+
+	assert.Zero(t, d.dispatch(context.Background()), "a failed event must wait for its backoff")
+
+	// Pretend the backoff elapsed twice.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, repo.ScheduleRetry(context.Background(), 1, repo.event(1).Attempts, time.Now(), ""))
+		d.dispatch(context.Background())
+	}
+	event = repo.event(1)
+	assert.NotNil(t, event.PublishedAt)
+	assert.Equal(t, 2, event.Attempts)
+	assert.Equal(t, []uint{1}, publisher.published)
+}
+
+func TestOutboxDispatcher_DeletesOldPublishedEvents(t *testing.T) {
+	repo := newFakeOutboxRepository(entity.EventOrderProcessed, entity.EventPointsAccrued, entity.EventPointsWithdrawn)
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	repo.events[1].PublishedAt = &old
+	repo.events[2].PublishedAt = &recent
+	repo.events[3].CreatedAt = old
+	d := NewOutboxDispatcher(repo, &recordingPublisher{}, config.OutboxConfig{Retention: 24 * time.Hour})
+
+	d.cleanup(context.Background())
+
+	assert.False(t, repo.has(1), "published past the retention period")
+	assert.True(t, repo.has(2), "published within the retention period")
+	assert.True(t, repo.has(3), "unpublished events are kept however old they are")
+
+	d = NewOutboxDispatcher(repo, &recordingPublisher{}, config.OutboxConfig{})
+	repo.events[2].PublishedAt = &old
+	d.cleanup(context.Background())
+	assert.True(t, repo.has(2), "zero retention keeps published events")
+}
+
+func TestOutboxDispatcher_RunStopsOnShutdown(t *testing.T) {
+	repo := newFakeOutboxRepository(entity.EventOrderProcessed)
+	publisher := &recordingPublisher{}
+	d := NewOutboxDispatcher(repo, publisher, config.OutboxConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return repo.event(1).PublishedAt != nil
+	}, time.Second, 5*time.Millisecond, "pending events must be published on start")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("outbox dispatcher did not stop")
+	}
+}
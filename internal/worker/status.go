@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"fmt"
+	"gophemart/internal/app/entity"
+)
+
+// accrualStatuses maps accrual statuses onto the statuses shown to users.
+// REGISTERED means accrual knows the order but has not started calculating,
+// which users see as PROCESSING.
+var accrualStatuses = map[entity.AccrualStatus]entity.OrderStatus{
+	entity.AccrualRegistered: entity.OrderProcessing,
+	entity.AccrualProcessing: entity.OrderProcessing,
+	entity.AccrualInvalid:    entity.OrderInvalid,
+	entity.AccrualProcessed:  entity.OrderProcessed,
+}
+
+func toOrderStatus(accrualStatus entity.AccrualStatus) (entity.OrderStatus, error) {
+	status, ok := accrualStatuses[accrualStatus]
+	if !ok {
+		return "", fmt.Errorf("unknown accrual status %q", accrualStatus)
+	}
+	return status, nil
+}
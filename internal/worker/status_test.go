@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"gophemart/internal/app/entity"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToOrderStatus(t *testing.T) {
+	tests := []struct {
+		accrual entity.AccrualStatus
+		want    entity.OrderStatus
+	}{
+		{accrual: entity.AccrualRegistered, want: entity.OrderProcessing},
+		{accrual: entity.AccrualProcessing, want: entity.OrderProcessing},
+		{accrual: entity.AccrualInvalid, want: entity.OrderInvalid},
+		{accrual: entity.AccrualProcessed, want: entity.OrderProcessed},
+	}
+	for _, tt := range tests {
+		got, err := toOrderStatus(tt.accrual)
+		require.NoError(t, err, tt.accrual)
+		assert.Equal(t, tt.want, got, tt.accrual)
+	}
+
+	for _, unknown := range []entity.AccrualStatus{"", "NEW", "processed", "CANCELLED"} {
+		_, err := toOrderStatus(unknown)
+		assert.Error(t, err, unknown)
+	}
+}
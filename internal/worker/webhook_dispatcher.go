@@ -0,0 +1,213 @@
+package worker
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/app/repository"
+	"gophemart/internal/backoff"
+	"gophemart/internal/config"
+	"gophemart/internal/transport/webhook"
+	"gophemart/pkg/logger"
+	"sync"
+	"time"
+)
+
+// webhookCleanupPeriod is how often finished deliveries past the retention
+// period are deleted.
+const webhookCleanupPeriod = time.Hour
+
+// WebhookDispatcher sends queued webhook deliveries, retrying failures with
+// backoff until MaxAttempts, after which the delivery is marked FAILED.
+// Delivered and failed deliveries are deleted once they are older than the
+// retention period.
+type WebhookDispatcher struct {
+	webhookRepo repository.WebhookRepository
+	sender      *webhook.Sender
+	batchSize   int
+	concurrency int
+	timeout     time.Duration
+	retryBase   time.Duration
+	retryMax    time.Duration
+	maxAttempts int
+	jitter      func() float64
+	retention   time.Duration
+	lastCleanup time.Time
+}
+
+func NewWebhookDispatcher(webhookRepo repository.WebhookRepository, cfg config.WebhookConfig) *WebhookDispatcher {
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = 50
+	}
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var senderOpts []webhook.SenderOption
+	if cfg.AllowPrivateNetworks {
+		senderOpts = append(senderOpts, webhook.WithPrivateNetworks())
+	}
+	return &WebhookDispatcher{
+		webhookRepo: webhookRepo,
+		sender:      webhook.NewSender(timeout, senderOpts...),
+		batchSize:   batchSize,
+		concurrency: concurrency,
+		timeout:     timeout,
+		retryBase:   cfg.RetryBaseDelay,
+		retryMax:    cfg.RetryMaxDelay,
+		maxAttempts: maxAttempts,
+		jitter:      backoff.Jitter,
+		retention:   cfg.Retention,
+	}
+}
+
+// Run sends due deliveries every interval until ctx is cancelled. Between
+// batches it deletes old finished deliveries every webhookCleanupPeriod.
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	logger.FromContext(ctx).Info().
+		Dur("interval", interval).
+		Int("concurrency", d.concurrency).
+		Msg("Starting webhook dispatcher")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if d.dispatch(ctx) == d.batchSize && ctx.Err() == nil {
+			continue
+		}
+		if time.Since(d.lastCleanup) >= webhookCleanupPeriod {
+			d.cleanup(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.FromContext(ctx).Info().Msg("Webhook dispatcher stopped by context")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends one batch and returns the number of deliveries claimed.
+func (d *WebhookDispatcher) dispatch(ctx context.Context) int {
+	// Every delivery may take the full timeout and runs concurrency at a time.
+	lease := time.Duration(d.batchSize/d.concurrency+1) * d.timeout * 2
+	batch, err := d.webhookRepo.ClaimDeliveries(ctx, d.batchSize, lease)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Failed to claim webhook deliveries")
+		return 0
+	}
+
+	sem := make(chan struct{}, d.concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range batch {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(delivery entity.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d.deliver(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(batch)
+}
+
+// cleanup deletes finished deliveries created before the retention period; a
+// zero retention keeps them.
+func (d *WebhookDispatcher) cleanup(ctx context.Context) {
+	d.lastCleanup = time.Now()
+	if d.retention <= 0 {
+		return
+	}
+	deleted, err := d.webhookRepo.DeleteFinishedBefore(ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Msg("Failed to delete finished webhook deliveries")
+		return
+	}
+	if deleted > 0 {
+		logger.FromContext(ctx).Debug().
+			Int64("deleted", deleted).
+			Msg("Deleted finished webhook deliveries")
+	}
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery entity.WebhookDelivery) {
+	attempts := delivery.Attempts + 1
+	// Bookkeeping must survive shutdown, otherwise the attempt is lost.
+	bookCtx := context.WithoutCancel(ctx)
+
+	if delivery.Webhook == nil {
+		// The webhook was deleted after the delivery was claimed.
+		d.recordFailure(bookCtx, delivery, attempts, 0, "webhook deleted", nil)
+		return
+	}
+
+	statusCode, err := d.sender.Send(ctx, webhook.Delivery{
+		ID:        delivery.ID,
+		URL:       delivery.Webhook.URL,
+		Secret:    delivery.Webhook.Secret,
+		EventType: delivery.EventType,
+		Payload:   delivery.Payload,
+	})
+	if err == nil {
+		logger.FromContext(ctx).Debug().
+			Uint("delivery_id", delivery.ID).
+			Uint("webhook_id", delivery.WebhookID).
+			Int("status_code", statusCode).
+			Int("attempts", attempts).
+			Msg("Webhook delivered")
+		if err := d.webhookRepo.MarkDelivered(bookCtx, delivery.ID, attempts, statusCode); err != nil {
+			logger.FromContext(ctx).Warn().
+				Err(err).
+				Uint("delivery_id", delivery.ID).
+				Msg("Failed to mark webhook delivered, it will be sent again")
+		}
+		return
+	}
+
+	var next *time.Time
+	if attempts < d.maxAttempts {
+		at := time.Now().Add(backoff.Delay(attempts, d.retryBase, d.retryMax, d.jitter))
+		next = &at
+	}
+	logger.FromContext(ctx).Warn().
+		Err(err).
+		Uint("delivery_id", delivery.ID).
+		Uint("webhook_id", delivery.WebhookID).
+		Int("status_code", statusCode).
+		Int("attempts", attempts).
+		Bool("giving_up", next == nil).
+		Msg("Webhook delivery failed")
+	d.recordFailure(bookCtx, delivery, attempts, statusCode, err.Error(), next)
+}
+
+func (d *WebhookDispatcher) recordFailure(
+	ctx context.Context,
+	delivery entity.WebhookDelivery,
+	attempts, statusCode int,
+	lastError string,
+	next *time.Time,
+) {
+	if err := d.webhookRepo.RecordFailure(ctx, delivery.ID, attempts, statusCode, lastError, next); err != nil {
+		logger.FromContext(ctx).Warn().
+			Err(err).
+			Uint("delivery_id", delivery.ID).
+			Msg("Failed to record webhook delivery attempt, it will be retried after its lease")
+	}
+}
@@ -0,0 +1,222 @@
+package worker
+
+import (
+	"context"
+	"gophemart/internal/app/entity"
+	"gophemart/internal/config"
+	"gophemart/internal/transport/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWebhookRepository struct {
+	mu         sync.Mutex
+	deliveries map[uint]*entity.WebhookDelivery
+}
+
+func newFakeWebhookRepository(url, secret string, count int) *fakeWebhookRepository {
+	r := &fakeWebhookRepository{deliveries: make(map[uint]*entity.WebhookDelivery)}
+	hook := &entity.Webhook{ID: 1, UserID: "1", URL: url, Secret: secret}
+	for i := 1; i <= count; i++ {
+		r.deliveries[uint(i)] = &entity.WebhookDelivery{
+			ID:        uint(i),
+			WebhookID: hook.ID,
+			Webhook:   hook,
+			UserID:    hook.UserID,
+			EventType: entity.EventOrderStatusChanged,
+			Payload:   []byte(`{"order_number":"12345678903","status":"PROCESSED","accrual":500}`),
+			Status:    entity.DeliveryPending,
+		}
+	}
+	return r
+}
+
+func (r *fakeWebhookRepository) ClaimDeliveries(_ context.Context, limit int, lease time.Duration) ([]entity.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var batch []entity.WebhookDelivery
+	for _, d := range r.deliveries {
+		if len(batch) == limit {
+			break
+		}
+		if d.Status == entity.DeliveryPending && !d.NextAttemptAt.After(now) {
+			d.NextAttemptAt = now.Add(lease)
+			batch = append(batch, *d)
+		}
+	}
+	return batch, nil
+}
+
+func (r *fakeWebhookRepository) MarkDelivered(_ context.Context, id uint, attempts, statusCode int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.deliveries[id]
+	d.Status = entity.DeliveryDelivered
+	d.Attempts = attempts
+	d.LastStatusCode = statusCode
+	return nil
+}
+
+func (r *fakeWebhookRepository) RecordFailure(_ context.Context, id uint, attempts, statusCode int, lastError string, next *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.deliveries[id]
+	d.Attempts = attempts
+	d.LastStatusCode = statusCode
+	d.LastError = lastError
+	if next != nil {
+		d.NextAttemptAt = *next
+	} else {
+		d.Status = entity.DeliveryFailed
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepository) DeleteFinishedBefore(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, d := range r.deliveries {
+		if d.Status != entity.DeliveryPending && d.CreatedAt.Before(before) {
+			delete(r.deliveries, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *fakeWebhookRepository) Create(context.Context, *entity.Webhook) error {
+	return nil
+}
+
+func (r *fakeWebhookRepository) FindByUserID(context.Context, string) ([]entity.Webhook, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) Delete(context.Context, string, uint) error {
+	return nil
+}
+
+func (r *fakeWebhookRepository) FindDeliveries(context.Context, string, uint, int) ([]entity.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) delivery(id uint) entity.WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.deliveries[id]
+}
+
+// makeDue pretends the backoff of every pending delivery elapsed.
+func (r *fakeWebhookRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		d.NextAttemptAt = time.Time{}
+	}
+}
+
+func TestWebhookDispatcher_DeliversSignedPayloads(t *testing.T) {
+	var verified int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if webhook.Verify("merchant-secret-1", ts, body, r.Header.Get(webhook.HeaderSignature)) {
+			atomic.AddInt64(&verified, 1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	repo := newFakeWebhookRepository(server.URL, "merchant-secret-1", 3)
+	d := NewWebhookDispatcher(repo, config.WebhookConfig{Concurrency: 2, MaxAttempts: 3, AllowPrivateNetworks: true})
+
+	assert.Equal(t, 3, d.dispatch(context.Background()))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&verified))
+	for id := uint(1); id <= 3; id++ {
+		delivery := repo.delivery(id)
+		assert.Equal(t, entity.DeliveryDelivered, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusOK, delivery.LastStatusCode)
+	}
+}
+
+func TestWebhookDispatcher_RetriesThenGivesUp(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	repo := newFakeWebhookRepository(server.URL, "merchant-secret-1", 1)
+	d := NewWebhookDispatcher(repo, config.WebhookConfig{
+		RetryBaseDelay:       time.Hour,
+		RetryMaxDelay:        time.Hour,
+		MaxAttempts:          3,
+		AllowPrivateNetworks: true,
+	})
+
+	d.dispatch(context.Background())
+	delivery := repo.delivery(1)
+	assert.Equal(t, entity.DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusBadGateway, delivery.LastStatusCode)
+	assert.Contains(t, delivery.LastError, "502")
+	assert.True(t, delivery.NextAttemptAt.After(time.Now().Add(30*time.Minute)), "retry must back off")
+
+	assert.Zero(t, d.dispatch(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		repo.makeDue()
+		d.dispatch(context.Background())
+	}
+	delivery = repo.delivery(1)
+	assert.Equal(t, entity.DeliveryFailed, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+
+	repo.makeDue()
+	assert.Zero(t, d.dispatch(context.Background()), "failed deliveries are not retried")
+}
+
+func TestWebhookDispatcher_DeletedWebhookFails(t *testing.T) {
+	repo := newFakeWebhookRepository("http://127.0.0.1:0", "merchant-secret-1", 1)
+	repo.deliveries[1].Webhook = nil
+	d := NewWebhookDispatcher(repo, config.WebhookConfig{MaxAttempts: 5})
+
+	d.dispatch(context.Background())
+	delivery := repo.delivery(1)
+	require.Equal(t, entity.DeliveryFailed, delivery.Status)
+	assert.Equal(t, "webhook deleted", delivery.LastError)
+}
+
+func TestWebhookDispatcher_DeletesOldFinishedDeliveries(t *testing.T) {
+	repo := newFakeWebhookRepository("http://127.0.0.1:0", "merchant-secret-1", 4)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, d := range repo.deliveries {
+		d.CreatedAt = old
+	}
+	repo.deliveries[1].Status = entity.DeliveryDelivered
+	repo.deliveries[2].Status = entity.DeliveryFailed
+	repo.deliveries[3].Status = entity.DeliveryDelivered
+	repo.deliveries[3].CreatedAt = time.Now().Add(-time.Hour)
+	d := NewWebhookDispatcher(repo, config.WebhookConfig{Retention: 24 * time.Hour})
+
+	d.cleanup(context.Background())
+
+	assert.NotContains(t, repo.deliveries, uint(1), "delivered past the retention period")
+	assert.NotContains(t, repo.deliveries, uint(2), "failed past the retention period")
+	assert.Contains(t, repo.deliveries, uint(3), "delivered within the retention period")
+	assert.Contains(t, repo.deliveries, uint(4), "pending deliveries are kept however old they are")
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"gophemart/internal/app/entity"
 	"gophemart/pkg/logger"
@@ -8,15 +10,31 @@ import (
 	"time"
 )
 
+var models = []struct {
+	name  string
+	model interface{}
+}{
+	{"User", &entity.User{}},
+	{"Order", &entity.Order{}},
+	{"Withdrawal", &entity.Withdrawal{}},
+	{"IdempotencyRecord", &entity.IdempotencyRecord{}},
+	{"OutboxEvent", &entity.OutboxEvent{}},
+	{"Webhook", &entity.Webhook{}},
+	{"WebhookDelivery", &entity.WebhookDelivery{}},
+	{"UserEvent", &entity.UserEvent{}},
+}
+
+// preMigrations run before AutoMigrate of the named model and fail the
+// migration when existing data would not fit the new schema.
+var preMigrations = map[string]func(db *gorm.DB) error{
+	"Withdrawal": checkDuplicateWithdrawals,
+}
+
+// ErrDuplicateWithdrawals stops the migration that adds the unique index on
+// withdrawals.order_number while several withdrawals share an order number.
+var ErrDuplicateWithdrawals = errors.New("withdrawals with duplicate order numbers")
+
 func Migrate(db *gorm.DB) error {
-	models := []struct {
-		name  string
-		model interface{}
-	}{
-		{"User", &entity.User{}},
-		{"Order", &entity.Order{}},
-		{"Withdrawal", &entity.Withdrawal{}},
-	}
 
 	logger.Info().Msg("Starting database migration")
 	logger.Info().Int("model_count", len(models)).Msg("Models to migrate")
@@ -27,6 +45,16 @@ func Migrate(db *gorm.DB) error {
 			Str("model", m.name).
 			Msg("Migrating model")
 
+		if prepare, ok := preMigrations[m.name]; ok {
+			if err := prepare(db); err != nil {
+				logger.Error().
+					Err(err).
+					Str("model", m.name).
+					Msg("Existing data does not fit the new schema")
+				return fmt.Errorf("failed to migrate %s: %w", m.name, err)
+			}
+		}
+
 		if err := db.AutoMigrate(m.model); err != nil {
 			logger.Error().
 				Err(err).
@@ -45,3 +73,70 @@ func Migrate(db *gorm.DB) error {
 	logger.Info().Msg("Database migration completed successfully")
 	return nil
 }
+
+// checkDuplicateWithdrawals looks for duplicates before the unique index on
+// withdrawals.order_number is created on a table that predates it; otherwise
+// AutoMigrate fails with a bare constraint error. Withdrawals are money
+// movements, so duplicates are not resolved automatically: see "Миграции" in
+// README for the manual steps.
+func checkDuplicateWithdrawals(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&entity.Withdrawal{}) || migrator.HasIndex(&entity.Withdrawal{}, "OrderNumber") {
+		return nil
+	}
+
+	var duplicates []string
+	err := db.Model(&entity.Withdrawal{}).
+		Select("order_number").
+		Group("order_number").
+		Having("COUNT(*) > 1").
+		Order("order_number").
+		Pluck("order_number", &duplicates).Error
+	if err != nil {
+		return fmt.Errorf("failed to look for duplicate withdrawals: %w", err)
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	logger.Error().
+		Int("count", len(duplicates)).
+		Strs("order_number", duplicates).
+		Msg("Several withdrawals share an order number, resolve them before upgrading")
+	return fmt.Errorf("%w: %d order numbers", ErrDuplicateWithdrawals, len(duplicates))
+}
+
+// CheckMigrations reports the first model whose table is missing or lacks a
+// column of the model, for readiness probes. It catches a replica started
+// against a database that was migrated by an older release.
+func CheckMigrations(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+	migrator := db.Migrator()
+	for _, m := range models {
+		if !migrator.HasTable(m.model) {
+			return fmt.Errorf("table for %s is missing", m.name)
+		}
+
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m.model); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", m.name, err)
+		}
+		columnTypes, err := migrator.ColumnTypes(m.model)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", m.name, err)
+		}
+		columns := make(map[string]bool, len(columnTypes))
+		for _, c := range columnTypes {
+			columns[c.Name()] = true
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !columns[field.DBName] {
+				return fmt.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+	return nil
+}
@@ -6,6 +6,9 @@ import (
 	"gophemart/pkg/logger"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"log"
+	"os"
 	"time"
 )
 
@@ -20,6 +23,7 @@ func NewPostgresDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	start := time.Now()
 	db, err := gorm.Open(postgres.Open(cfg.PostgresDatabase.URI), &gorm.Config{
 		TranslateError: true,
+		Logger:         newGORMLogger(),
 	})
 	duration := time.Since(start)
 
@@ -43,6 +47,17 @@ func NewPostgresDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	return db, nil
 }
 
+// newGORMLogger logs statements without their arguments, which may hold
+// logins and order numbers.
+func newGORMLogger() gormlogger.Interface {
+	return gormlogger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), gormlogger.Config{
+		SlowThreshold:        200 * time.Millisecond,
+		LogLevel:             gormlogger.Warn,
+		Colorful:             true,
+		ParameterizedQueries: true,
+	})
+}
+
 func setupConnectionPool(db *gorm.DB, pgConfig config.PostgresDatabaseConfig) (*gorm.DB, error) {
 	logger.Info().
 		Int("max_open_conns", pgConfig.MaxOpenConns).
@@ -0,0 +1,25 @@
+package logger
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+// FromContext returns the logger stored in ctx by WithStr, or the global
+// logger if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return Get()
+}
+
+// WithStr returns a copy of ctx whose logger adds key=value to every event,
+// on top of the fields the logger in ctx already has.
+func WithStr(ctx context.Context, key, value string) context.Context {
+	l := &Logger{FromContext(ctx).With().Str(key, value).Logger()}
+	return context.WithValue(ctx, contextKey{}, l)
+}
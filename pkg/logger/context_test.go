@@ -0,0 +1,25 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext_FallsBackToGlobalLogger(t *testing.T) {
+	assert.Same(t, Get(), FromContext(context.Background()))
+}
+
+func TestWithStr_AddsFieldsToContextLogger(t *testing.T) {
+	ctx := WithStr(context.Background(), "request_id", "req-1")
+	ctx = WithStr(ctx, "user_id", "42")
+
+	var out bytes.Buffer
+	l := FromContext(ctx).Output(&out)
+	l.Info().Msg("hello")
+
+	assert.Contains(t, out.String(), `"request_id":"req-1"`)
+	assert.Contains(t, out.String(), `"user_id":"42"`)
+}
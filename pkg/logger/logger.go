@@ -1,7 +1,10 @@
 package logger
 
 import (
+	"fmt"
 	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -11,48 +14,240 @@ import (
 )
 
 var (
-	once     sync.Once
-	logger   zerolog.Logger
-	initDone bool
+	once       sync.Once
+	logger     Logger
+	initDone   bool
+	workDir    string
+	withCaller = true
+	// output is where events go after redaction, before text formatting.
+	output io.Writer = os.Stdout
 )
 
+// Logger adds the caller's function, file and line to every enabled event.
+type Logger struct {
+	zerolog.Logger
+}
+
+// Formats accepted in Config.Format.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Outputs accepted in Config.Output.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+)
+
+// Config describes how Setup builds the global logger.
+type Config struct {
+	Level  string
+	Format string
+	Output string
+	// File is used when Output is "file"; the file is rotated by size.
+	File FileConfig
+	// WithCaller adds the calling function, file and line to every event.
+	WithCaller bool
+	Sampling   SamplingConfig
+	Redaction  RedactionConfig
+}
+
+type FileConfig struct {
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+}
+
+// SamplingConfig thins out debug events: the first Burst events of every
+// Period are written, then only one in Every. Every <= 1 disables sampling.
+type SamplingConfig struct {
+	Burst  uint32
+	Period time.Duration
+	Every  uint32
+}
+
+// Init sets up a console logger on stdout that only removes secrets. It is a
+// no-op once the logger is set up.
 func Init(level zerolog.Level) {
 	once.Do(func() {
-		output := zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: time.RFC822,
-			FormatCaller: func(i interface{}) string {
-				if s, ok := i.(string); ok {
-					if index := strings.LastIndex(s, "/"); index != -1 {
-
-						return s[index+1:]
-					}
-					return s
-				}
-				return ""
-			},
-		}
-		logger = zerolog.New(output).
-			Level(level).
-			With().
-			Timestamp().
-			Logger()
+		zerolog.SetGlobalLevel(level)
+		r, _ := newRedactor(RedactionConfig{Mode: RedactOff})
+		output = &redactWriter{r: r, out: os.Stdout}
+		logger = Logger{newLogger(&redactWriter{r: r, out: consoleWriter(os.Stdout, false)})}
+		workDir, _ = os.Getwd()
 
 		initDone = true
 	})
 }
 
-func Get() *zerolog.Logger {
+// Setup replaces the global logger according to cfg. The returned function
+// closes the log file, if any.
+func Setup(cfg Config) (func() error, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer
+	closeOutput := func() error { return nil }
+	switch cfg.Output {
+	case "", OutputStdout:
+		out = os.Stdout
+	case OutputStderr:
+		out = os.Stderr
+	case OutputFile:
+		if cfg.File.Path == "" {
+			return nil, fmt.Errorf("log file path is required for %q output", OutputFile)
+		}
+		file := &lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    cfg.File.MaxSizeMB,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAge:     cfg.File.MaxAgeDays,
+			Compress:   cfg.File.Compress,
+		}
+		out, closeOutput = file, file.Close
+	default:
+		return nil, fmt.Errorf("unknown log output %q", cfg.Output)
+	}
+
+	raw := out
+	switch cfg.Format {
+	case "", FormatJSON:
+	case FormatText:
+		out = consoleWriter(out, cfg.Output == OutputFile)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	l := newLogger(&redactWriter{r: r, out: out})
+	if cfg.Sampling.Every > 1 {
+		l = l.Sample(zerolog.LevelSampler{
+			DebugSampler: &zerolog.BurstSampler{
+				Burst:       cfg.Sampling.Burst,
+				Period:      cfg.Sampling.Period,
+				NextSampler: &zerolog.BasicSampler{N: cfg.Sampling.Every},
+			},
+		})
+	}
+
+	once.Do(func() {})
+	zerolog.SetGlobalLevel(level)
+	logger = Logger{l}
+	output = &redactWriter{r: r, out: raw}
+	withCaller = cfg.WithCaller
+	workDir, _ = os.Getwd()
+	initDone = true
+	return closeOutput, nil
+}
+
+// newLogger leaves level filtering to the global level so that SetLevel
+// also applies to loggers already derived from the global one.
+func newLogger(out io.Writer) zerolog.Logger {
+	return zerolog.New(out).
+		Level(zerolog.TraceLevel).
+		With().
+		Timestamp().
+		Logger()
+}
+
+func consoleWriter(out io.Writer, noColor bool) zerolog.ConsoleWriter {
+	return zerolog.ConsoleWriter{
+		Out:        out,
+		NoColor:    noColor,
+		TimeFormat: time.RFC822,
+		FormatCaller: func(i interface{}) string {
+			if s, ok := i.(string); ok {
+				if index := strings.LastIndex(s, "/"); index != -1 {
+
+					return s[index+1:]
+				}
+				return s
+			}
+			return ""
+		},
+	}
+}
+
+// Writer returns the destination of the logger for other JSON logs, such as
+// the HTTP access log. Lines written to it are redacted like events, but not
+// formatted as text.
+func Writer() io.Writer {
+	Get()
+	return output
+}
+
+// ParseLevel accepts zerolog level names; an empty string means info.
+func ParseLevel(level string) (zerolog.Level, error) {
+	if level == "" {
+		return zerolog.InfoLevel, nil
+	}
+	l, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || l == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("unknown log level %q", level)
+	}
+	return l, nil
+}
+
+// Level returns the level below which events are dropped.
+func Level() zerolog.Level {
+	return zerolog.GlobalLevel()
+}
+
+// SetLevel changes the level of every logger at runtime.
+func SetLevel(level zerolog.Level) {
+	zerolog.SetGlobalLevel(level)
+}
+
+func Get() *Logger {
 	if !initDone {
 		Init(zerolog.InfoLevel)
 	}
 	return &logger
 }
 
-func WithCaller() *zerolog.Logger {
+func (l *Logger) Debug() *zerolog.Event {
+	return addCaller(l.Logger.Debug())
+}
+
+func (l *Logger) Info() *zerolog.Event {
+	return addCaller(l.Logger.Info())
+}
+
+func (l *Logger) Warn() *zerolog.Event {
+	return addCaller(l.Logger.Warn())
+}
+
+func (l *Logger) Error() *zerolog.Event {
+	return addCaller(l.Logger.Error())
+}
+
+func (l *Logger) Fatal() *zerolog.Event {
+	return addCaller(l.Logger.Fatal())
+}
+
+func (l *Logger) Panic() *zerolog.Event {
+	return addCaller(l.Logger.Panic())
+}
+
+// addCaller looks up the code that asked for the event, two frames up. It
+// is skipped for events below the logger's level and when caller info is
+// turned off.
+func addCaller(e *zerolog.Event) *zerolog.Event {
+	if !withCaller || !e.Enabled() {
+		return e
+	}
 	pc, file, line, ok := runtime.Caller(2)
 	if !ok {
-		return Get()
+		return e
 	}
 
 	var funcName string
@@ -60,41 +255,38 @@ func WithCaller() *zerolog.Logger {
 		funcName = filepath.Base(fun.Name())
 	}
 	relFile := file
-
-	if wd, err := os.Getwd(); err == nil {
-		if rel, err := filepath.Rel(wd, file); err == nil {
+	if workDir != "" {
+		if rel, err := filepath.Rel(workDir, file); err == nil {
 			relFile = rel
 		}
 	}
 
-	lg := Get().With().
+	return e.
 		Str("func", funcName).
 		Str("file", relFile).
-		Int("line", line).
-		Logger()
-	return &lg
+		Int("line", line)
 }
 
 func Debug() *zerolog.Event {
-	return WithCaller().Debug()
+	return addCaller(Get().Logger.Debug())
 }
 
 func Info() *zerolog.Event {
-	return WithCaller().Info()
+	return addCaller(Get().Logger.Info())
 }
 
 func Warn() *zerolog.Event {
-	return WithCaller().Warn()
+	return addCaller(Get().Logger.Warn())
 }
 
 func Error() *zerolog.Event {
-	return WithCaller().Error()
+	return addCaller(Get().Logger.Error())
 }
 
 func Fatal() *zerolog.Event {
-	return WithCaller().Fatal()
+	return addCaller(Get().Logger.Fatal())
 }
 
 func Panic() *zerolog.Event {
-	return WithCaller().Panic()
+	return addCaller(Get().Logger.Panic())
 }
@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupFileLogger(t *testing.T, cfg Config) string {
+	t.Helper()
+
+	previous, previousOutput, previousLevel, previousCaller := logger, output, Level(), withCaller
+	t.Cleanup(func() {
+		logger, output, withCaller = previous, previousOutput, previousCaller
+		SetLevel(previousLevel)
+	})
+
+	cfg.Output = OutputFile
+	cfg.File.Path = filepath.Join(t.TempDir(), "app.log")
+	closeLog, err := Setup(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeLog() })
+	return cfg.File.Path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestSetup_WritesJSONToFile(t *testing.T) {
+	path := setupFileLogger(t, Config{Level: "info", Format: FormatJSON, WithCaller: true})
+
+	Debug().Msg("dropped")
+	Info().Str("order", "12345678903").Msg("kept")
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"level":"info"`)
+	assert.Contains(t, lines[0], `"order":"12345678903"`)
+	assert.Contains(t, lines[0], `"func":"logger.TestSetup_WritesJSONToFile"`)
+}
+
+func TestSetup_OmitsCallerWhenDisabled(t *testing.T) {
+	path := setupFileLogger(t, Config{Level: "info", Format: FormatJSON})
+
+	Info().Msg("kept")
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 1)
+	assert.NotContains(t, lines[0], `"func"`)
+}
+
+func TestSetup_SamplesDebugEvents(t *testing.T) {
+	path := setupFileLogger(t, Config{
+		Level:    "debug",
+		Format:   FormatJSON,
+		Sampling: SamplingConfig{Burst: 2, Period: time.Hour, Every: 5},
+	})
+
+	for i := 0; i < 12; i++ {
+		Debug().Int("i", i).Msg("tick")
+	}
+	Info().Msg("never sampled")
+
+	// Two events of the burst, then every fifth of the remaining ten.
+	assert.Len(t, readLines(t, path), 2+2+1)
+}
+
+func TestSetLevel_AppliesToDerivedLoggers(t *testing.T) {
+	path := setupFileLogger(t, Config{Level: "warn", Format: FormatJSON})
+	derived := FromContext(WithStr(context.Background(), "request_id", "req-1"))
+
+	derived.Info().Msg("dropped")
+	SetLevel(zerolog.DebugLevel)
+	derived.Info().Msg("kept")
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"message":"kept"`)
+}
+
+func TestSetup_RejectsUnknownSettings(t *testing.T) {
+	_, err := Setup(Config{Level: "verbose"})
+	assert.Error(t, err)
+
+	_, err = Setup(Config{Format: "xml"})
+	assert.Error(t, err)
+
+	_, err = Setup(Config{Output: "syslog"})
+	assert.Error(t, err)
+
+	_, err = Setup(Config{Output: OutputFile})
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var personalFields = []string{"login", "ip", "remote_ip", "order", "order_number"}
+
+func redactLine(t *testing.T, cfg RedactionConfig, line string) string {
+	t.Helper()
+
+	r, err := newRedactor(cfg)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, r.redactEvent(&buf, []byte(line)))
+	return buf.String()
+}
+
+func TestRedactor_MasksPersonalFields(t *testing.T) {
+	out := redactLine(t, RedactionConfig{Mode: RedactMask, Fields: personalFields},
+		`{"level":"info","login":"alice","ip":"203.0.113.42","remote_ip":"2001:db8:1:2::1",`+
+			`"order_number":"12345678903","order":12345678903,"user_id":"7","message":"ok"}`)
+
+	assert.Equal(t, `{"level":"info","login":"a***","ip":"203.0.113.*","remote_ip":"2001:db8:1::*",`+
+		`"order_number":"***8903","order":"***8903","user_id":"7","message":"ok"}`, out)
+}
+
+func TestRedactor_HashesPersonalFields(t *testing.T) {
+	cfg := RedactionConfig{Mode: RedactHash, Fields: personalFields, HashKey: "k1"}
+	first := redactLine(t, cfg, `{"login":"alice"}`)
+	second := redactLine(t, cfg, `{"login":"alice"}`)
+	other := redactLine(t, RedactionConfig{Mode: RedactHash, Fields: personalFields, HashKey: "k2"}, `{"login":"alice"}`)
+
+	assert.Equal(t, first, second, "the same value hashes the same way")
+	assert.NotEqual(t, first, other, "the hash depends on the key")
+	assert.NotContains(t, first, "alice")
+	assert.Regexp(t, `^\{"login":"sha256:[0-9a-f]{16}"\}$`, first)
+}
+
+func TestRedactor_AlwaysRemovesSecrets(t *testing.T) {
+	for _, mode := range []string{RedactOff, RedactMask, RedactHash} {
+		t.Run(mode, func(t *testing.T) {
+			out := redactLine(t, RedactionConfig{Mode: mode, Fields: personalFields},
+				`{"password":"hunter2","claims":{"user_id":"7","access_token":"eyJ"},"Authorization":["Bearer x"],`+
+					`"error":"failed to connect to postgresql://postgres:s3cret@db:5432/app"}`)
+
+			assert.Equal(t, `{"password":"[REDACTED]","claims":{"user_id":"7","access_token":"[REDACTED]"},`+
+				`"Authorization":"[REDACTED]","error":"failed to connect to postgresql://postgres:xxxxx@db:5432/app"}`, out)
+		})
+	}
+}
+
+func TestRedactor_OffKeepsPersonalFields(t *testing.T) {
+	out := redactLine(t, RedactionConfig{Mode: RedactOff, Fields: personalFields}, `{"login":"alice","ip":"203.0.113.42"}`)
+
+	assert.Equal(t, `{"login":"alice","ip":"203.0.113.42"}`, out)
+}
+
+func TestNewRedactor_RejectsUnknownMode(t *testing.T) {
+	_, err := newRedactor(RedactionConfig{Mode: "encrypt"})
+	assert.Error(t, err)
+}
+
+func TestSetup_RedactsTextOutputAndWriter(t *testing.T) {
+	path := setupFileLogger(t, Config{
+		Level:     "info",
+		Format:    FormatText,
+		Redaction: RedactionConfig{Mode: RedactMask, Fields: personalFields},
+	})
+
+	Info().Str("login", "alice").Str("password", "hunter2").Msg("User logged in")
+	_, err := Writer().Write([]byte(`{"remote_ip":"203.0.113.42","status":200}` + "\n"))
+	require.NoError(t, err)
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "login=a***")
+	assert.NotContains(t, lines[0], "hunter2")
+	assert.Equal(t, `{"remote_ip":"203.0.113.*","status":200}`, lines[1])
+	assert.NotContains(t, strings.Join(lines, "\n"), "alice")
+}
+
+func TestRedactWriter_PassesCleanLinesThrough(t *testing.T) {
+	r, err := newRedactor(RedactionConfig{Mode: RedactMask, Fields: personalFields})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	w := &redactWriter{r: r, out: &out}
+	clean := `{"level":"info","user_id":"7",  "message":"cycle done"}` + "\n"
+	assert.False(t, r.needsRedaction([]byte(clean)))
+	_, err = w.Write([]byte(clean))
+	require.NoError(t, err)
+	assert.Equal(t, clean, out.String(), "lines without personal data must not be re-encoded")
+
+	out.Reset()
+	_, err = w.Write([]byte(`{"LOGIN":"alice"}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"LOGIN":"a***"}`+"\n", out.String(), "field names are matched case-insensitively")
+}
+
+func TestWriteString_MatchesEncodingJSON(t *testing.T) {
+	for _, s := range []string{
+		"", "plain", `quo"te`, `back\slash`, "new\nline\r\t", "\x00\x1f", "<html>&",
+		"ünïcödé", "line\u2028sep\u2029", "bad\xffutf8",
+	} {
+		var want bytes.Buffer
+		enc := json.NewEncoder(&want)
+		enc.SetEscapeHTML(false)
+		require.NoError(t, enc.Encode(s))
+
+		var got bytes.Buffer
+		writeString(&got, s)
+		assert.Equal(t, strings.TrimSuffix(want.String(), "\n"), got.String(), "%q", s)
+	}
+}